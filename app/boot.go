@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
@@ -17,114 +18,272 @@ import (
 	"go.yhsif.com/pandablog/app/lib/datastorage"
 	"go.yhsif.com/pandablog/app/lib/envdetect"
 	"go.yhsif.com/pandablog/app/lib/htmltemplate"
+	"go.yhsif.com/pandablog/app/lib/throttle"
 	"go.yhsif.com/pandablog/app/lib/websession"
 	"go.yhsif.com/pandablog/app/middleware"
+	"go.yhsif.com/pandablog/app/model"
 	"go.yhsif.com/pandablog/app/route"
 	"go.yhsif.com/pandablog/html"
 )
 
 var (
 	storageSitePath    = "storage/site.json"
+	storageSiteDir     = "storage/site"
 	storageSessionPath = "storage/session.bin"
 	sessionName        = "session"
 )
 
-// Boot -
-func Boot(ctx context.Context) (http.Handler, error) {
-	// Set the storage and session environment variables.
+// openStorage returns the bucket for the site, the legacy single object
+// storing the whole site, and the object storing the sessions, configured by
+// the environment variables.
+//
+// PBB_STORAGE_URL selects the backend, see datastorage.Open. Without it the
+// GCS bucket PBB_GCP_BUCKET_NAME is used, or the local filesystem when running
+// locally.
+func openStorage() (site datastorage.Bucket, legacy datastorage.Datastorer, session websession.Sessionstorer, err error) {
+	// Set the storage environment variables.
 	sitePath := os.Getenv("PBB_SITE_PATH")
 	if len(sitePath) > 0 {
 		storageSitePath = sitePath
 	}
 
+	siteDir := os.Getenv("PBB_SITE_DIR")
+	if len(siteDir) > 0 {
+		storageSiteDir = siteDir
+	}
+
 	sessionPath := os.Getenv("PBB_SESSION_PATH")
 	if len(sessionPath) > 0 {
 		storageSessionPath = sessionPath
 	}
 
-	sname := os.Getenv("PBB_SESSION_NAME")
-	if len(sname) > 0 {
-		sessionName = sname
+	if storageURL := os.Getenv("PBB_STORAGE_URL"); len(storageURL) > 0 {
+		bucket, err := datastorage.Open(storageURL)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		site = datastorage.Sub(bucket, storageSiteDir)
+		legacy = bucket.Object(storageSitePath)
+		session = datastorage.SessionStorage{Datastorer: bucket.Object(storageSessionPath)}
+		return site, legacy, session, nil
 	}
 
-	// Get the environment variables.
+	bucket := os.Getenv("PBB_GCP_BUCKET_NAME")
+	if len(bucket) == 0 {
+		return nil, nil, nil, fmt.Errorf("environment variable missing: %v or %v", "PBB_STORAGE_URL", "PBB_GCP_BUCKET_NAME")
+	}
+
+	if !envdetect.RunningLocalDev() {
+		// Use Google when running in GCP.
+		site = datastorage.NewGCPBucket(bucket, storageSiteDir)
+		legacy = datastorage.NewGCPStorage(bucket, storageSitePath)
+		session = datastorage.SessionStorage{Datastorer: datastorage.NewGCPStorage(bucket, storageSessionPath)}
+	} else {
+		// Use local filesytem when developing.
+		site = datastorage.NewLocalBucket(storageSiteDir)
+		legacy = datastorage.NewLocalStorage(storageSitePath)
+		session = datastorage.SessionStorage{Datastorer: datastorage.NewLocalStorage(storageSessionPath)}
+	}
+	return site, legacy, session, nil
+}
+
+// NewStorage returns the site storage configured by the environment
+// variables.
+func NewStorage(ctx context.Context) (*datastorage.Storage, error) {
+	site, legacy, _, err := openStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up the data storage provider, migrating the site from the legacy
+	// single object if needed.
+	return datastorage.New(ctx, site, legacy)
+}
+
+// newEncrypter returns the encrypter of the sessions, with the key in
+// PBB_SESSION_KEY and the old keys still accepted in PBB_SESSION_OLD_KEYS,
+// separated by commas.
+func newEncrypter() (*websession.EncryptedStorage, error) {
 	secretKey := os.Getenv("PBB_SESSION_KEY")
 	if len(secretKey) == 0 {
 		return nil, fmt.Errorf("environment variable missing: %v", "PBB_SESSION_KEY")
 	}
 
-	bucket := os.Getenv("PBB_GCP_BUCKET_NAME")
-	if len(bucket) == 0 {
-		return nil, fmt.Errorf("environment variable missing: %v", "PBB_GCP_BUCKET_NAME")
+	var oldKeys []string
+	for _, key := range strings.Split(os.Getenv("PBB_SESSION_OLD_KEYS"), ",") {
+		if key = strings.TrimSpace(key); len(key) > 0 {
+			oldKeys = append(oldKeys, key)
+		}
 	}
+	return websession.NewEncryptedStorage(secretKey, oldKeys...), nil
+}
 
-	allowHTML, err := strconv.ParseBool(os.Getenv("PBB_ALLOW_HTML"))
+// RotateSessionKey re-encrypts the sessions in the storage with the key in
+// PBB_SESSION_KEY, after it was changed with the previous key moved to
+// PBB_SESSION_OLD_KEYS. The old keys can be removed afterwards.
+//
+// Sessions stored in cookies cannot be re-encrypted, they are when they
+// change.
+func RotateSessionKey(ctx context.Context) error {
+	en, err := newEncrypter()
+	if err != nil {
+		return err
+	}
+	_, _, ss, err := openStorage()
 	if err != nil {
-		return nil, fmt.Errorf("environment variable not able to parse as bool: %v", "PBB_ALLOW_HTML")
+		return err
 	}
 
-	// Create new store object with the defaults.
-	var ds datastorage.Datastorer
-	var ss websession.Sessionstorer
+	sd := new(websession.SessionDatabase)
+	return sd.Update(ctx, ss, en, func(*websession.SessionDatabase) bool {
+		return true
+	})
+}
 
-	if !envdetect.RunningLocalDev() {
-		// Use Google when running in GCP.
-		ds = datastorage.NewGCPStorage(bucket, storageSitePath)
-		ss = datastorage.NewGCPStorage(bucket, storageSessionPath)
-	} else {
-		// Use local filesytem when developing.
-		ds = datastorage.NewLocalStorage(storageSitePath)
-		ss = datastorage.NewLocalStorage(storageSessionPath)
+// Boot sets up the storage, sessions and routes, and returns the handler of
+// the web server and the function to call on shutdown, which writes back the
+// pending session changes.
+//
+// PBB_SESSION_STORE selects where the sessions are stored: "storage", the
+// default, keeps them in the storage next to the site, and "cookie" keeps them
+// encrypted in the session cookies.
+func Boot(ctx context.Context) (handler http.Handler, shutdown func(context.Context) error, err error) {
+	// Set the session environment variables.
+	sname := os.Getenv("PBB_SESSION_NAME")
+	if len(sname) > 0 {
+		sessionName = sname
 	}
 
-	// Set up the data storage provider.
-	storage, err := datastorage.New(ds)
+	// Get the environment variables.
+	en, err := newEncrypter()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// Set up the session storage provider.
-	en := websession.NewEncryptedStorage(secretKey)
-	store, err := websession.NewJSONSession(ss, en)
+	allowHTML, err := strconv.ParseBool(os.Getenv("PBB_ALLOW_HTML"))
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("environment variable not able to parse as bool: %v", "PBB_ALLOW_HTML")
+	}
+
+	// Set up the data storage provider, migrating the site from the legacy
+	// single object if needed.
+	siteBucket, legacy, ss, err := openStorage()
+	if err != nil {
+		return nil, nil, err
+	}
+	storage, err := datastorage.New(ctx, siteBucket, legacy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lifetime, err := durationEnv("PBB_SESSION_LIFETIME", 24*time.Hour)
+	if err != nil {
+		return nil, nil, err
+	}
+	idleTimeout, err := durationEnv("PBB_SESSION_IDLE_TIMEOUT", 0)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Initialize a new session manager and configure the session lifetime.
+	// The cookies are only persisted for the sessions with remember me.
 	sessionManager := scs.New()
-	sessionManager.Lifetime = 24 * time.Hour
+	sessionManager.Lifetime = lifetime
+	sessionManager.IdleTimeout = idleTimeout
 	sessionManager.Cookie.Persist = false
 	if !envdetect.RunningLocalDev() {
 		sessionManager.Cookie.Secure = true
 	}
+
+	// Set up the session storage provider, selected by PBB_SESSION_STORE.
+	var store scs.Store
+	var cookieStore *websession.CookieStore
+	shutdown = func(context.Context) error { return nil }
+	switch mode := os.Getenv("PBB_SESSION_STORE"); mode {
+	case "", "storage":
+		jsonStore, err := websession.NewJSONSession(ss, en)
+		if err != nil {
+			return nil, nil, err
+		}
+		store, shutdown = jsonStore, jsonStore.Close
+	case "cookie":
+		cookieStore = websession.NewCookieStore(
+			en,
+			sessionManager.Cookie.Name,
+			func(ctx context.Context) (int64, error) {
+				site, err := storage.Site.Load(ctx)
+				if err != nil {
+					return 0, err
+				}
+				return site.SessionGeneration, nil
+			},
+			func(ctx context.Context) error {
+				return storage.Update(ctx, func(site *model.Site) error {
+					site.SessionGeneration++
+					return nil
+				})
+			},
+		)
+		store = cookieStore
+	default:
+		return nil, nil, fmt.Errorf("environment variable PBB_SESSION_STORE has unknown value %q, want %q or %q", mode, "storage", "cookie")
+	}
+
 	sessionManager.Store = store
 	sess := websession.New(sessionName, sessionManager)
 
 	// Set up the template engine.
 	tm := html.NewTemplateManager(storage, sess)
-	tmpl := htmltemplate.New(tm, allowHTML)
+	tmpl := htmltemplate.New(tm, allowHTML, func(name string) (model.Media, bool) {
+		// Markdown is rendered without a request context, but the site is
+		// almost always cached.
+		site, err := storage.Site.Load(context.Background())
+		if err != nil {
+			slog.Error("Failed to load site", "err", err)
+			return model.Media{}, false
+		}
+		return site.MediaByName(name)
+	})
 
 	// Load blocklist
 	b := loadBlocklist(ctx)
 
+	// Keep the failed login attempts in memory, or also in the storage to
+	// share them with all the instances, selected by
+	// PBB_LOGIN_THROTTLE_STORE.
+	var throttleStore throttle.Store
+	switch mode := os.Getenv("PBB_LOGIN_THROTTLE_STORE"); mode {
+	case "", "memory":
+	case "storage":
+		throttleStore = storage.ThrottleStore()
+	default:
+		return nil, nil, fmt.Errorf("environment variable PBB_LOGIN_THROTTLE_STORE has unknown value %q, want %q or %q", mode, "memory", "storage")
+	}
+
 	// Setup the routes.
-	c, err := route.Register(storage, sess, tmpl, b)
+	c, err := route.Register(storage, sess, tmpl, b, throttleStore)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Set up the router and middleware.
 	site, err := c.Storage.Site.Load(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	var mw http.Handler
 	mw = c.Router
-	h := middleware.NewHandler(c.Render, c.Sess, c.Router, site.URL, site.Scheme)
+	mw = c.LegacyRedirect(mw)
+	h := middleware.NewHandler(c.Render, c.Sess, c.Storage, c.Router, site.URL, site.Scheme)
 	mw = h.Redirect(mw)
 	mw = middleware.Head(mw)
+	mw = h.Authorize(mw)
 	mw = h.DisallowAnon(mw)
+	mw = h.TrackSession(mw)
 	mw = sessionManager.LoadAndSave(mw)
+	if cookieStore != nil {
+		mw = cookieStore.Middleware(mw)
+	}
 	mw = b.Middleware(mw)
 	mw = middleware.LogRequest(mw)
 	mw = middleware.Gzip(mw)
@@ -138,7 +297,21 @@ func Boot(ctx context.Context) (http.Handler, error) {
 		}),
 	))
 
-	return mux, nil
+	return mux, shutdown, nil
+}
+
+// durationEnv returns the duration in the environment variable name, or def
+// if it's not set.
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	s := os.Getenv(name)
+	if len(s) == 0 {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("environment variable not able to parse as duration: %v", name)
+	}
+	return d, nil
 }
 
 func loadBlocklist(ctx context.Context) blocklist.Blocklist {
@@ -0,0 +1,193 @@
+// Package account looks up the users who can log in to the dashboard.
+package account
+
+import (
+	"encoding/base64"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"go.yhsif.com/pandablog/app/lib/passhash"
+	"go.yhsif.com/pandablog/app/lib/totp"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// Owner returns the user configured by PBB_USERNAME and PBB_PASSWORD_HASH,
+// an admin that cannot be changed from the users of the dashboard. The MFA key
+// in PBB_MFA_KEY and the recovery codes in PBB_MFA_RECOVERY_CODES only apply to
+// this user. The owner can change the password and MFA key in the dashboard,
+// see Lookup and MFAKey.
+func Owner() (model.UserWithName, bool) {
+	username := os.Getenv("PBB_USERNAME")
+	if len(username) == 0 {
+		return model.UserWithName{}, false
+	}
+
+	// The hash is base64 encoded to avoid the dollar signs in the
+	// environment variable.
+	hash, err := base64.StdEncoding.DecodeString(os.Getenv("PBB_PASSWORD_HASH"))
+	if err != nil {
+		slog.Error("Environment variable not able to decode as base64: PBB_PASSWORD_HASH", "err", err)
+	}
+	return model.UserWithName{
+		User: model.User{
+			PasswordHash: string(hash),
+			Role:         model.RoleAdmin,
+		},
+		Username: username,
+	}, true
+}
+
+// IsOwner reports whether username is the one of Owner.
+func IsOwner(username string) bool {
+	owner, ok := Owner()
+	return ok && owner.Username == username
+}
+
+// Lookup returns the user with username, either Owner or a user stored in
+// site. The password of Owner changed in the dashboard replaces
+// PBB_PASSWORD_HASH, until the environment variable changes.
+func Lookup(site *model.Site, username string) (model.UserWithName, bool) {
+	if owner, ok := Owner(); ok && owner.Username == username {
+		creds := site.OwnerCredentials()
+		if creds.PasswordHash != "" && creds.EnvPasswordHash == os.Getenv("PBB_PASSWORD_HASH") {
+			owner.PasswordHash = creds.PasswordHash
+		}
+		return owner, true
+	}
+	return site.UserByName(username)
+}
+
+// PasswordFromEnv reports whether the password hash of the user with username
+// is the one in PBB_PASSWORD_HASH, which cannot be changed by the server.
+func PasswordFromEnv(site *model.Site, username string) bool {
+	owner, ok := Owner()
+	if !ok || owner.Username != username {
+		return false
+	}
+	user, _ := Lookup(site, username)
+	return user.PasswordHash == owner.PasswordHash
+}
+
+// SetPassword replaces the password hash of the user with username in site.
+// Call it in storage.Update to persist it.
+func SetPassword(site *model.Site, username, hash string) {
+	if IsOwner(username) {
+		creds := site.OwnerCredentials()
+		creds.PasswordHash = hash
+		creds.EnvPasswordHash = os.Getenv("PBB_PASSWORD_HASH")
+		site.UpdateOwnerCredentials(creds)
+		return
+	}
+	if user, ok := site.UserByName(username); ok {
+		user.PasswordHash = hash
+		site.UpdateUser(username, &user.User)
+	}
+}
+
+// MFAKey returns the TOTP secret of the user with username, or "" if MFA is
+// not enabled for them. For Owner, PBB_MFA_KEY is used unless MFA was changed
+// in the dashboard since it was set.
+func MFAKey(site *model.Site, username string) string {
+	mfa := site.UserMFA(username)
+	if !IsOwner(username) {
+		return mfa.Key
+	}
+	env := os.Getenv("PBB_MFA_KEY")
+	if creds := site.OwnerCredentials(); creds.MFAChanged && creds.EnvMFAKey == env {
+		return mfa.Key
+	}
+	return env
+}
+
+// SetMFAKey enables MFA with the TOTP secret for the user with username in
+// site, with the hashes of new recovery codes and the time step of the code
+// used to confirm it, or disables MFA if key is "". Call it in storage.Update
+// to persist it.
+func SetMFAKey(site *model.Site, username, key string, step int64, recoveryCodes []string) {
+	mfa := site.UserMFA(username)
+	mfa.Key = key
+	mfa.LastStep = step
+	mfa.RecoveryCodes = recoveryCodes
+	site.UpdateUserMFA(username, &mfa)
+	if IsOwner(username) {
+		creds := site.OwnerCredentials()
+		creds.MFAChanged = true
+		creds.EnvMFAKey = os.Getenv("PBB_MFA_KEY")
+		site.UpdateOwnerCredentials(creds)
+	}
+}
+
+// HasMFA reports whether MFA is enabled for any user, so the login page asks
+// for the MFA code.
+func HasMFA(site *model.Site) bool {
+	if owner, ok := Owner(); ok && MFAKey(site, owner.Username) != "" {
+		return true
+	}
+	return site.HasMFAKeys()
+}
+
+// envRecoveryCodes returns the hashes of the recovery codes of Owner in
+// PBB_MFA_RECOVERY_CODES, separated by commas.
+func envRecoveryCodes() []string {
+	var hashes []string
+	for h := range strings.SplitSeq(os.Getenv("PBB_MFA_RECOVERY_CODES"), ",") {
+		if h = strings.TrimSpace(h); len(h) > 0 {
+			hashes = append(hashes, h)
+		}
+	}
+	return hashes
+}
+
+// RecoveryCodesLeft returns the number of unused recovery codes of the user.
+func RecoveryCodesLeft(site *model.Site, username string) int {
+	mfa := site.UserMFA(username)
+	n := len(mfa.RecoveryCodes)
+	if IsOwner(username) {
+		for _, h := range envRecoveryCodes() {
+			if !slices.Contains(mfa.UsedRecoveryCodes, h) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// VerifyMFA checks code, either a TOTP code or a recovery code of the user
+// with username, and records it in the MFA state of the user in site so it
+// cannot be used again. Call it in storage.Update to persist the state.
+func VerifyMFA(site *model.Site, username, code string) (recovery bool, ok bool) {
+	mfa := site.UserMFA(username)
+	if step, ok := totp.Verify(code, MFAKey(site, username), mfa.LastStep); ok {
+		mfa.LastStep = step
+		site.UpdateUserMFA(username, &mfa)
+		return false, true
+	}
+
+	hash := totp.HashRecoveryCode(code)
+	if i := slices.Index(mfa.RecoveryCodes, hash); i >= 0 {
+		mfa.RecoveryCodes = slices.Delete(mfa.RecoveryCodes, i, i+1)
+		site.UpdateUserMFA(username, &mfa)
+		return true, true
+	}
+	if IsOwner(username) && slices.Contains(envRecoveryCodes(), hash) &&
+		!slices.Contains(mfa.UsedRecoveryCodes, hash) {
+		mfa.UsedRecoveryCodes = append(mfa.UsedRecoveryCodes, hash)
+		site.UpdateUserMFA(username, &mfa)
+		return true, true
+	}
+	return false, false
+}
+
+// Authenticate returns the user with username if password matches.
+func Authenticate(site *model.Site, username, password string) (model.UserWithName, bool) {
+	user, ok := Lookup(site, username)
+	if !ok || len(user.PasswordHash) == 0 {
+		return model.UserWithName{}, false
+	}
+	if !passhash.MatchString(user.PasswordHash, password) {
+		return model.UserWithName{}, false
+	}
+	return user, true
+}
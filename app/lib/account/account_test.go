@@ -0,0 +1,186 @@
+package account_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/account"
+	"go.yhsif.com/pandablog/app/lib/passhash"
+	"go.yhsif.com/pandablog/app/lib/totp"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+func TestVerifyMFARecoveryCodes(t *testing.T) {
+	t.Setenv("PBB_USERNAME", "owner")
+	t.Setenv("PBB_MFA_KEY", "2SH3V3GDW7ZNMGYE")
+	t.Setenv("PBB_MFA_RECOVERY_CODES", totp.HashRecoveryCode("aaaaa-bbbbb")+", "+totp.HashRecoveryCode("ccccc-ddddd"))
+
+	site := new(model.Site)
+	codes, hashes := totp.GenerateRecoveryCodes()
+	site.UpdateUserMFA("owner", &model.MFA{RecoveryCodes: hashes})
+	if got, want := account.RecoveryCodesLeft(site, "owner"), len(codes)+2; got != want {
+		t.Errorf("RecoveryCodesLeft got %d want %d", got, want)
+	}
+
+	for _, c := range []struct {
+		label    string
+		username string
+		code     string
+		ok       bool
+	}{
+		{label: "env", username: "owner", code: "AAAAA-BBBBB", ok: true},
+		{label: "env-reused", username: "owner", code: "aaaaabbbbb"},
+		{label: "stored", username: "owner", code: codes[0], ok: true},
+		{label: "stored-reused", username: "owner", code: codes[0]},
+		{label: "wrong", username: "owner", code: "eeeee-fffff"},
+		{label: "not-owner", username: "other", code: "ccccc-ddddd"},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			recovery, ok := account.VerifyMFA(site, c.username, c.code)
+			if ok != c.ok || recovery != c.ok {
+				t.Errorf("VerifyMFA got %v, %v want %v, %v", recovery, ok, c.ok, c.ok)
+			}
+		})
+	}
+	if got, want := account.RecoveryCodesLeft(site, "owner"), len(codes); got != want {
+		t.Errorf("RecoveryCodesLeft got %d want %d", got, want)
+	}
+	if got := account.MFAKey(site, "other"); got != "" {
+		t.Errorf("MFAKey of other user got %q want empty", got)
+	}
+}
+
+func TestOwnerCredentials(t *testing.T) {
+	envHash := func(password string) string {
+		hash, err := passhash.HashString(password)
+		if err != nil {
+			t.Fatalf("HashString failed: %v", err)
+		}
+		return base64.StdEncoding.EncodeToString([]byte(hash))
+	}
+	t.Setenv("PBB_USERNAME", "owner")
+	t.Setenv("PBB_PASSWORD_HASH", envHash("env"))
+	t.Setenv("PBB_MFA_KEY", "2SH3V3GDW7ZNMGYE")
+
+	site := new(model.Site)
+	site.UpdateUser("other", &model.User{Role: model.RoleAuthor})
+	for _, c := range []struct {
+		label string
+		// change changes the credentials before checking them.
+		change   func()
+		username string
+		password string
+		mfaKey   string
+	}{
+		{
+			label:    "env",
+			change:   func() {},
+			username: "owner",
+			password: "env",
+			mfaKey:   "2SH3V3GDW7ZNMGYE",
+		},
+		{
+			label: "dashboard",
+			change: func() {
+				hash, _ := passhash.HashString("dashboard")
+				account.SetPassword(site, "owner", hash)
+				account.SetMFAKey(site, "owner", "JBSWY3DPEHPK3PXP", 1, nil)
+			},
+			username: "owner",
+			password: "dashboard",
+			mfaKey:   "JBSWY3DPEHPK3PXP",
+		},
+		{
+			label: "dashboard-disabled",
+			change: func() {
+				account.SetMFAKey(site, "owner", "", 0, nil)
+			},
+			username: "owner",
+			password: "dashboard",
+		},
+		{
+			label: "env-changed",
+			change: func() {
+				t.Setenv("PBB_PASSWORD_HASH", envHash("new env"))
+				t.Setenv("PBB_MFA_KEY", "MFRGGZDFMZTWQ2LK")
+			},
+			username: "owner",
+			password: "new env",
+			mfaKey:   "MFRGGZDFMZTWQ2LK",
+		},
+		{
+			label: "user",
+			change: func() {
+				hash, _ := passhash.HashString("user")
+				account.SetPassword(site, "other", hash)
+				account.SetMFAKey(site, "other", "JBSWY3DPEHPK3PXP", 1, nil)
+			},
+			username: "other",
+			password: "user",
+			mfaKey:   "JBSWY3DPEHPK3PXP",
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			c.change()
+			if _, ok := account.Authenticate(site, c.username, c.password); !ok {
+				t.Errorf("Authenticate with %q failed", c.password)
+			}
+			if got := account.MFAKey(site, c.username); got != c.mfaKey {
+				t.Errorf("MFAKey got %q want %q", got, c.mfaKey)
+			}
+		})
+	}
+	if !account.HasMFA(site) {
+		t.Error("HasMFA got false want true")
+	}
+}
+
+func TestPasswordFromEnv(t *testing.T) {
+	hash, _ := passhash.HashString("env")
+	t.Setenv("PBB_USERNAME", "owner")
+	t.Setenv("PBB_PASSWORD_HASH", base64.StdEncoding.EncodeToString([]byte(hash)))
+
+	site := new(model.Site)
+	site.UpdateUser("other", &model.User{Role: model.RoleAuthor, PasswordHash: hash})
+	if !account.PasswordFromEnv(site, "owner") {
+		t.Error("PasswordFromEnv of owner got false want true")
+	}
+	if account.PasswordFromEnv(site, "other") {
+		t.Error("PasswordFromEnv of other got true want false")
+	}
+	dashboard, _ := passhash.HashString("dashboard")
+	account.SetPassword(site, "owner", dashboard)
+	if account.PasswordFromEnv(site, "owner") {
+		t.Error("PasswordFromEnv of owner changed in the dashboard got true want false")
+	}
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	t.Setenv("PBB_USERNAME", "owner")
+
+	site := new(model.Site)
+	site.UpdateUser("alice", &model.User{Role: model.RoleAuthor})
+	for _, username := range []string{"owner", "alice", "deleted"} {
+		token, id := account.GenerateToken()
+		site.UpdateToken(id, &model.Token{Username: username, Scope: model.ScopeWrite})
+
+		t.Run(username, func(t *testing.T) {
+			got, user, ok := account.AuthenticateToken(site, token)
+			if username == "deleted" {
+				if ok {
+					t.Error("AuthenticateToken of a deleted user succeeded")
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("AuthenticateToken failed")
+			}
+			if got.ID != id || user.Username != username {
+				t.Errorf("AuthenticateToken got %q of %q want %q of %q", got.ID, user.Username, id, username)
+			}
+			if _, _, ok := account.AuthenticateToken(site, token+"x"); ok {
+				t.Error("AuthenticateToken with a wrong token succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package account
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// tokenPrefix makes the tokens easy to find by secret scanners.
+const tokenPrefix = "pbb_"
+
+// GenerateToken returns a new personal access token for the API, and its hash
+// to store as its id.
+func GenerateToken() (token string, id string) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	token = tokenPrefix + base64.RawURLEncoding.EncodeToString(key)
+	return token, HashToken(token)
+}
+
+// IsToken reports whether token looks like a personal access token, so it's
+// never sent elsewhere to verify.
+func IsToken(token string) bool {
+	return strings.HasPrefix(token, tokenPrefix)
+}
+
+// HashToken returns the hash of the token to store. The tokens have 256
+// random bits, so they don't need a slow password hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuthenticateToken returns the token and its user if the token is stored in
+// site, and its user still exists.
+func AuthenticateToken(site *model.Site, token string) (model.TokenWithID, model.UserWithName, bool) {
+	if !IsToken(token) {
+		return model.TokenWithID{}, model.UserWithName{}, false
+	}
+	id := HashToken(token)
+	t, ok := site.TokenByID(id)
+	if !ok {
+		return model.TokenWithID{}, model.UserWithName{}, false
+	}
+	user, ok := Lookup(site, t.Username)
+	if !ok {
+		return model.TokenWithID{}, model.UserWithName{}, false
+	}
+	return model.TokenWithID{Token: t, ID: id}, user, true
+}
@@ -0,0 +1,65 @@
+package datastorage
+
+import (
+	"hash/fnv"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+// Bucket is a collection of named objects, for example a GCS bucket or a
+// directory on the filesystem.
+type Bucket interface {
+	// Object returns the object with the given slash-separated name.
+	Object(name string) Datastorer
+}
+
+// GCPBucket represents objects under a prefix in a Google Cloud Storage
+// bucket.
+type GCPBucket struct {
+	bucket string
+	prefix string
+}
+
+// NewGCPBucket returns a Google Cloud Storage bucket given a bucket name and
+// a prefix for all the object paths.
+func NewGCPBucket(bucket string, prefix string) *GCPBucket {
+	return &GCPBucket{
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+// Object returns the object with the given name under the prefix.
+func (b *GCPBucket) Object(name string) Datastorer {
+	return NewGCPStorage(b.bucket, path.Join(b.prefix, name))
+}
+
+// localLocks is the number of locks shared by the objects of a LocalBucket.
+const localLocks = 64
+
+// LocalBucket represents files in a directory on the filesystem.
+type LocalBucket struct {
+	dir string
+
+	// locks are shared by the objects with the same name, picked by the hash
+	// of the name, so they don't have to be kept for every name.
+	locks [localLocks]sync.Mutex
+}
+
+// NewLocalBucket returns a local bucket given a directory path.
+func NewLocalBucket(dir string) *LocalBucket {
+	return &LocalBucket{
+		dir: dir,
+	}
+}
+
+// Object returns the file with the given name under the directory.
+func (b *LocalBucket) Object(name string) Datastorer {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return &LocalStorage{
+		path: filepath.Join(b.dir, filepath.FromSlash(name)),
+		lock: &b.locks[h.Sum32()%localLocks],
+	}
+}
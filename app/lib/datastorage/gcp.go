@@ -3,12 +3,23 @@ package datastorage
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
-	"time"
+	"net/http"
+	"strconv"
+	"sync"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 )
 
+// gcpClient is the Google Cloud Storage client shared by all GCPStorage
+// objects in the process, created on first use.
+var gcpClient = sync.OnceValues(func() (*storage.Client, error) {
+	return storage.NewClient(context.Background())
+})
+
 // GCPStorage represents a Google Cloud Storage object.
 type GCPStorage struct {
 	bucket string
@@ -24,56 +35,125 @@ func NewGCPStorage(bucket string, object string) *GCPStorage {
 	}
 }
 
+func (s *GCPStorage) handle() (*storage.ObjectHandle, error) {
+	client, err := gcpClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Bucket(s.bucket).Object(s.object), nil
+}
+
 // Load downloads an object from a bucket and returns an error if it cannot
 // be read.
-func (s *GCPStorage) Load() ([]byte, error) {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+func (s *GCPStorage) Load(ctx context.Context) ([]byte, error) {
+	data, _, err := s.LoadGeneration(ctx)
+	return data, err
+}
+
+// Save uploads an object to a bucket and returns an error if it cannot be
+// written.
+func (s *GCPStorage) Save(ctx context.Context, b []byte) error {
+	obj, err := s.handle()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer client.Close()
 
-	ctx, cancel := context.WithTimeout(ctx, time.Second*50)
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
-	rc, err := client.Bucket(s.bucket).Object(s.object).NewReader(ctx)
+	// Upload an object with storage.Writer.
+	wc := obj.NewWriter(ctx)
+	if _, err = io.Copy(wc, bytes.NewReader(b)); err != nil {
+		wc.Close()
+		return err
+	}
+	return wc.Close()
+}
+
+// Delete deletes an object from a bucket.
+func (s *GCPStorage) Delete(ctx context.Context) error {
+	obj, err := s.handle()
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return gcpNotExist(obj.Delete(ctx))
+}
+
+// LoadGeneration downloads an object from a bucket along with its generation.
+func (s *GCPStorage) LoadGeneration(ctx context.Context) ([]byte, string, error) {
+	obj, err := s.handle()
+	if err != nil {
+		return nil, "", err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rc, err := obj.NewReader(ctx)
+	if err != nil {
+		return nil, "", gcpNotExist(err)
 	}
 	defer rc.Close()
 
 	data, err := io.ReadAll(rc)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return data, nil
+	return data, strconv.FormatInt(rc.Attrs.Generation, 10), nil
 }
 
-// Save uploads an object to a bucket and returns an error if it cannot be
-// written.
-func (s *GCPStorage) Save(b []byte) error {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		return err
+// SaveIfGeneration uploads an object to a bucket with a generation
+// precondition, and returns ErrConflict if the object in the bucket is no
+// longer at generation.
+func (s *GCPStorage) SaveIfGeneration(ctx context.Context, b []byte, generation string) (string, error) {
+	conds := storage.Conditions{DoesNotExist: true}
+	if generation != "" {
+		gen, err := strconv.ParseInt(generation, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid generation %q: %w", generation, err)
+		}
+		conds = storage.Conditions{GenerationMatch: gen}
 	}
-	defer client.Close()
 
-	f := bytes.NewReader(b)
+	obj, err := s.handle()
+	if err != nil {
+		return "", err
+	}
 
-	ctx, cancel := context.WithTimeout(ctx, time.Second*50)
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	// Upload an object with storage.Writer.
-	wc := client.Bucket(s.bucket).Object(s.object).NewWriter(ctx)
-	if _, err = io.Copy(wc, f); err != nil {
-		return err
+	wc := obj.If(conds).NewWriter(ctx)
+	if _, err = io.Copy(wc, bytes.NewReader(b)); err != nil {
+		wc.Close()
+		return "", gcpConflict(err)
 	}
 	if err := wc.Close(); err != nil {
-		return err
+		return "", gcpConflict(err)
 	}
 
-	return nil
+	return strconv.FormatInt(wc.Attrs().Generation, 10), nil
+}
+
+// gcpConflict translates failed precondition errors from GCS into ErrConflict.
+func gcpConflict(err error) error {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+	return err
+}
+
+// gcpNotExist wraps storage.ErrObjectNotExist errors with ErrNotExist.
+func gcpNotExist(err error) error {
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("%w: %w", ErrNotExist, err)
+	}
+	return err
 }
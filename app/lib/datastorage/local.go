@@ -1,32 +1,125 @@
 package datastorage
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
 )
 
 // LocalStorage represents a file on the filesytem.
 type LocalStorage struct {
 	path string
+
+	// lock serializes SaveIfGeneration so the check and the write are atomic
+	// within the process.
+	lock *sync.Mutex
 }
 
 // NewLocalStorage returns a local storage object given a file path.
 func NewLocalStorage(path string) *LocalStorage {
 	return &LocalStorage{
 		path: path,
+		lock: new(sync.Mutex),
 	}
 }
 
 // Load returns a file contents from the filesystem.
-func (s *LocalStorage) Load() ([]byte, error) {
+func (s *LocalStorage) Load(ctx context.Context) ([]byte, error) {
 	b, err := os.ReadFile(s.path)
 	if err != nil {
-		return nil, err
+		return nil, localNotExist(err)
 	}
 
 	return b, nil
 }
 
 // Save writes a file to the filesystem and returns an error if one occurs.
-func (s *LocalStorage) Save(b []byte) error {
+//
+// Missing parent directories are created.
+func (s *LocalStorage) Save(ctx context.Context, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
 	return os.WriteFile(s.path, b, 0644)
 }
+
+// Delete removes a file from the filesystem.
+func (s *LocalStorage) Delete(ctx context.Context) error {
+	return localNotExist(os.Remove(s.path))
+}
+
+// LoadGeneration returns a file contents from the filesystem, along with a
+// hash of the contents as its generation.
+func (s *LocalStorage) LoadGeneration(ctx context.Context) ([]byte, string, error) {
+	b, err := s.Load(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return b, localGeneration(b), nil
+}
+
+// SaveIfGeneration writes a file to the filesystem if its contents still
+// matches generation, otherwise it returns ErrConflict.
+//
+// The file is written to a temporary file first then renamed, so readers never
+// see a partially written file.
+func (s *LocalStorage) SaveIfGeneration(ctx context.Context, b []byte, generation string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	current, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if generation != "" {
+			return "", ErrConflict
+		}
+	case err != nil:
+		return "", err
+	default:
+		if localGeneration(current) != generation {
+			return "", ErrConflict
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		return "", err
+	}
+	return localGeneration(b), nil
+}
+
+// localNotExist wraps os.ErrNotExist errors with ErrNotExist.
+func localNotExist(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %w", ErrNotExist, err)
+	}
+	return err
+}
+
+// localGeneration returns the generation of a local file with contents b.
+func localGeneration(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,45 @@
+package datastorage_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/datastorage"
+)
+
+func TestLocalStorageSaveIfGeneration(t *testing.T) {
+	ctx := context.Background()
+	ls := datastorage.NewLocalStorage(filepath.Join(t.TempDir(), "site.json"))
+
+	gen, err := ls.SaveIfGeneration(ctx, []byte("foo"), "")
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if _, err := ls.SaveIfGeneration(ctx, []byte("bar"), ""); !errors.Is(err, datastorage.ErrConflict) {
+		t.Errorf("SaveIfGeneration on existing file got error %v want %v", err, datastorage.ErrConflict)
+	}
+
+	b, loaded, err := ls.LoadGeneration(ctx)
+	if err != nil {
+		t.Fatalf("LoadGeneration failed: %v", err)
+	}
+	if got, want := string(b), "foo"; got != want {
+		t.Errorf("LoadGeneration got %q want %q", got, want)
+	}
+	if loaded != gen {
+		t.Errorf("LoadGeneration got generation %q want %q", loaded, gen)
+	}
+
+	newGen, err := ls.SaveIfGeneration(ctx, []byte("bar"), gen)
+	if err != nil {
+		t.Fatalf("SaveIfGeneration failed: %v", err)
+	}
+	if _, err := ls.SaveIfGeneration(ctx, []byte("baz"), gen); !errors.Is(err, datastorage.ErrConflict) {
+		t.Errorf("SaveIfGeneration with old generation got error %v want %v", err, datastorage.ErrConflict)
+	}
+	if _, err := ls.SaveIfGeneration(ctx, []byte("baz"), newGen); err != nil {
+		t.Errorf("SaveIfGeneration with new generation failed: %v", err)
+	}
+}
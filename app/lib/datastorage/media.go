@@ -0,0 +1,118 @@
+package datastorage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"go.yhsif.com/pandablog/app/lib/imagevariant"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// mediaPrefix is the prefix of the media objects in the bucket.
+const mediaPrefix = "media/"
+
+// SaveMedia stores data as a new media uploaded by the user uploader, named
+// after filename with a number added if the name is already used, and returns
+// the name used.
+//
+// The EXIF GPS data is removed from images, and resized variants are stored
+// along with JPEG and PNG images.
+func (s *Storage) SaveMedia(ctx context.Context, uploader, filename, contentType string, data []byte) (string, error) {
+	data = imagevariant.StripGPS(contentType, data)
+	img, err := imagevariant.Resize(contentType, data)
+	if err != nil {
+		// Still keep the file, only without the variants.
+		slog.WarnContext(ctx, "Failed to resize image", "err", err, "filename", filename)
+	}
+
+	object := mediaPrefix + strconv.FormatInt(time.Now().UnixNano(), 36)
+	media := model.Media{
+		Object:      object,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Uploaded:    time.Now(),
+		Uploader:    uploader,
+		Width:       img.Width,
+		Height:      img.Height,
+	}
+	if err := s.bucket.Object(object).Save(ctx, data); err != nil {
+		return "", err
+	}
+	for _, v := range img.Variants {
+		name := object + "-" + strconv.Itoa(v.Width)
+		if err := s.bucket.Object(name).Save(ctx, v.Data); err != nil {
+			s.deleteObjects(ctx, media.Objects())
+			return "", err
+		}
+		media.Variants = append(media.Variants, model.MediaVariant{
+			Object: name,
+			Width:  v.Width,
+			Height: v.Height,
+		})
+	}
+
+	var name string
+	if err := s.Update(ctx, func(site *model.Site) error {
+		name = site.UniqueMediaName(model.CleanMediaName(filename))
+		site.UpdateMedia(name, &media)
+		return nil
+	}); err != nil {
+		s.deleteObjects(ctx, media.Objects())
+		return "", err
+	}
+	return name, nil
+}
+
+// LoadMedia reads the contents of media, or its variant of the given width if
+// width is not 0. It returns ErrNotExist if there is no such variant.
+func (s *Storage) LoadMedia(ctx context.Context, media model.Media, width int) ([]byte, error) {
+	object := media.Object
+	if width != 0 {
+		v, ok := media.Variant(width)
+		if !ok {
+			return nil, fmt.Errorf("variant %d of media: %w", width, ErrNotExist)
+		}
+		object = v.Object
+	}
+	return s.bucket.Object(object).Load(ctx)
+}
+
+// RenameMedia renames media from to to, with a number added if to is already
+// used, and returns the name used. It returns ErrNotExist if from does not
+// exist.
+func (s *Storage) RenameMedia(ctx context.Context, from, to string) (string, error) {
+	var name string
+	err := s.Update(ctx, func(site *model.Site) error {
+		media, ok := site.MediaByName(from)
+		if !ok {
+			return fmt.Errorf("media %q: %w", from, ErrNotExist)
+		}
+		site.UpdateMedia(from, nil)
+		name = site.UniqueMediaName(model.CleanMediaName(to))
+		site.UpdateMedia(name, &media)
+		return nil
+	})
+	return name, err
+}
+
+// DeleteMedia deletes media name. It returns ErrNotExist if it does not
+// exist.
+func (s *Storage) DeleteMedia(ctx context.Context, name string) error {
+	var objects []string
+	if err := s.Update(ctx, func(site *model.Site) error {
+		media, ok := site.MediaByName(name)
+		if !ok {
+			return fmt.Errorf("media %q: %w", name, ErrNotExist)
+		}
+		objects = media.Objects()
+		site.UpdateMedia(name, nil)
+		return nil
+	}); err != nil {
+		return err
+	}
+	s.deleteObjects(ctx, objects)
+	return nil
+}
@@ -0,0 +1,69 @@
+package datastorage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/datastorage"
+)
+
+func TestStorageMedia(t *testing.T) {
+	ctx := context.Background()
+	bucket := datastorage.NewMemoryBucket()
+	s, err := datastorage.New(ctx, bucket, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	name, err := s.SaveMedia(ctx, "alice", "My Photo.PNG", "image/png", []byte("foo"))
+	if err != nil {
+		t.Fatalf("SaveMedia failed: %v", err)
+	}
+	if want := "My-Photo.png"; name != want {
+		t.Errorf("SaveMedia got name %q want %q", name, want)
+	}
+	name, err = s.SaveMedia(ctx, "alice", "My Photo.PNG", "image/png", []byte("bar"))
+	if err != nil {
+		t.Fatalf("SaveMedia failed: %v", err)
+	}
+	if want := "My-Photo-1.png"; name != want {
+		t.Errorf("SaveMedia on existing name got name %q want %q", name, want)
+	}
+
+	name, err = s.RenameMedia(ctx, name, "other.png")
+	if err != nil {
+		t.Fatalf("RenameMedia failed: %v", err)
+	}
+	site, err := s.Site.Load(ctx)
+	if err != nil {
+		t.Fatalf("Failed to load site: %v", err)
+	}
+	media, ok := site.MediaByName(name)
+	if !ok {
+		t.Fatalf("Renamed media %q not found", name)
+	}
+	if got, want := media.Uploader, "alice"; got != want {
+		t.Errorf("Uploader got %q want %q", got, want)
+	}
+	b, err := s.LoadMedia(ctx, media, 0)
+	if err != nil {
+		t.Fatalf("LoadMedia failed: %v", err)
+	}
+	if got, want := string(b), "bar"; got != want {
+		t.Errorf("LoadMedia got %q want %q", got, want)
+	}
+
+	if err := s.DeleteMedia(ctx, name); err != nil {
+		t.Fatalf("DeleteMedia failed: %v", err)
+	}
+	if _, err := s.LoadMedia(ctx, media, 0); !errors.Is(err, datastorage.ErrNotExist) {
+		t.Errorf("LoadMedia after delete got error %v want %v", err, datastorage.ErrNotExist)
+	}
+	if err := s.DeleteMedia(ctx, name); !errors.Is(err, datastorage.ErrNotExist) {
+		t.Errorf("DeleteMedia on deleted media got error %v want %v", err, datastorage.ErrNotExist)
+	}
+	if _, err := s.RenameMedia(ctx, name, "foo.png"); !errors.Is(err, datastorage.ErrNotExist) {
+		t.Errorf("RenameMedia on deleted media got error %v want %v", err, datastorage.ErrNotExist)
+	}
+}
@@ -0,0 +1,117 @@
+package datastorage
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+)
+
+// MemoryStorage represents an object kept in memory, in a MemoryBucket.
+type MemoryStorage struct {
+	bucket *MemoryBucket
+	name   string
+}
+
+// NewMemoryStorage returns an empty in-memory object.
+func NewMemoryStorage() *MemoryStorage {
+	return NewMemoryBucket().Object("").(*MemoryStorage)
+}
+
+// Load returns the contents of the object.
+func (s *MemoryStorage) Load(ctx context.Context) ([]byte, error) {
+	b, _, err := s.LoadGeneration(ctx)
+	return b, err
+}
+
+// Save replaces the contents of the object.
+func (s *MemoryStorage) Save(ctx context.Context, b []byte) error {
+	s.bucket.lock.Lock()
+	defer s.bucket.lock.Unlock()
+
+	s.set(b)
+	return nil
+}
+
+// Delete removes the object.
+func (s *MemoryStorage) Delete(ctx context.Context) error {
+	s.bucket.lock.Lock()
+	defer s.bucket.lock.Unlock()
+
+	if _, ok := s.bucket.objects[s.name]; !ok {
+		return ErrNotExist
+	}
+	delete(s.bucket.objects, s.name)
+	return nil
+}
+
+// LoadGeneration returns the contents of the object along with its
+// generation, a counter increased on every write to the bucket.
+func (s *MemoryStorage) LoadGeneration(ctx context.Context) ([]byte, string, error) {
+	s.bucket.lock.RLock()
+	defer s.bucket.lock.RUnlock()
+
+	obj, ok := s.bucket.objects[s.name]
+	if !ok {
+		return nil, "", ErrNotExist
+	}
+	return bytes.Clone(obj.data), strconv.FormatInt(obj.generation, 10), nil
+}
+
+// SaveIfGeneration replaces the contents of the object if it's still at
+// generation, otherwise it returns ErrConflict.
+func (s *MemoryStorage) SaveIfGeneration(ctx context.Context, b []byte, generation string) (string, error) {
+	s.bucket.lock.Lock()
+	defer s.bucket.lock.Unlock()
+
+	current := ""
+	if obj, ok := s.bucket.objects[s.name]; ok {
+		current = strconv.FormatInt(obj.generation, 10)
+	}
+	if current != generation {
+		return "", ErrConflict
+	}
+	return strconv.FormatInt(s.set(b), 10), nil
+}
+
+// set replaces the contents and returns the new generation, s.bucket.lock must
+// be held.
+func (s *MemoryStorage) set(b []byte) int64 {
+	// The generations are unique in the bucket, so an object deleted and
+	// created again doesn't match the generations read before.
+	s.bucket.generation++
+	s.bucket.objects[s.name] = memoryObject{
+		data:       bytes.Clone(b),
+		generation: s.bucket.generation,
+	}
+	return s.bucket.generation
+}
+
+// memoryObject is the contents of an object in a MemoryBucket.
+type memoryObject struct {
+	data       []byte
+	generation int64
+}
+
+// MemoryBucket represents objects kept in memory, for tests and ephemeral
+// previews.
+type MemoryBucket struct {
+	lock       sync.RWMutex
+	objects    map[string]memoryObject
+	generation int64
+}
+
+// NewMemoryBucket returns an empty in-memory bucket.
+func NewMemoryBucket() *MemoryBucket {
+	return &MemoryBucket{
+		objects: make(map[string]memoryObject),
+	}
+}
+
+// Object returns the object with the given name.
+func (b *MemoryBucket) Object(name string) Datastorer {
+	return &MemoryStorage{
+		bucket: b,
+		name:   name,
+	}
+}
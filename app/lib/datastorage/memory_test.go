@@ -0,0 +1,103 @@
+package datastorage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/datastorage"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	ctx := context.Background()
+	ms := datastorage.NewMemoryStorage()
+
+	if _, err := ms.Load(ctx); !errors.Is(err, datastorage.ErrNotExist) {
+		t.Errorf("Load on new object got error %v want %v", err, datastorage.ErrNotExist)
+	}
+	if _, err := ms.SaveIfGeneration(ctx, []byte("foo"), "1"); !errors.Is(err, datastorage.ErrConflict) {
+		t.Errorf("SaveIfGeneration on new object got error %v want %v", err, datastorage.ErrConflict)
+	}
+
+	gen, err := ms.SaveIfGeneration(ctx, []byte(""), "")
+	if err != nil {
+		t.Fatalf("Failed to create object: %v", err)
+	}
+	b, loaded, err := ms.LoadGeneration(ctx)
+	if err != nil {
+		t.Fatalf("LoadGeneration failed: %v", err)
+	}
+	if len(b) != 0 || loaded != gen {
+		t.Errorf("LoadGeneration got %q, %q want %q, %q", b, loaded, "", gen)
+	}
+
+	if err := ms.Save(ctx, []byte("bar")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := ms.SaveIfGeneration(ctx, []byte("baz"), gen); !errors.Is(err, datastorage.ErrConflict) {
+		t.Errorf("SaveIfGeneration with old generation got error %v want %v", err, datastorage.ErrConflict)
+	}
+
+	if err := ms.Delete(ctx); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := ms.Delete(ctx); !errors.Is(err, datastorage.ErrNotExist) {
+		t.Errorf("Delete on deleted object got error %v want %v", err, datastorage.ErrNotExist)
+	}
+}
+
+func TestMemoryBucket(t *testing.T) {
+	ctx := context.Background()
+	bucket := datastorage.NewMemoryBucket()
+
+	gen, err := bucket.Object("foo").SaveIfGeneration(ctx, []byte("foo"), "")
+	if err != nil {
+		t.Fatalf("Failed to create object: %v", err)
+	}
+	if b, err := bucket.Object("foo").Load(ctx); err != nil || string(b) != "foo" {
+		t.Errorf("Load got %q, %v want %q, nil", b, err, "foo")
+	}
+	if err := bucket.Object("foo").Delete(ctx); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := bucket.Object("foo").Save(ctx, []byte("bar")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := bucket.Object("foo").SaveIfGeneration(ctx, []byte("baz"), gen); !errors.Is(err, datastorage.ErrConflict) {
+		t.Errorf("SaveIfGeneration with generation before Delete got error %v want %v", err, datastorage.ErrConflict)
+	}
+}
+
+func TestStorageNewSite(t *testing.T) {
+	ctx := context.Background()
+	bucket := datastorage.NewMemoryBucket()
+	s, err := datastorage.New(ctx, bucket, bucket.Object("site.json"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if err := s.Update(ctx, func(site *model.Site) error {
+		site.UpdatePost("foo", &model.Post{URL: "foo", Content: "content"})
+		return nil
+	}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// A new Storage on the same bucket sees the post.
+	s, err = datastorage.New(ctx, bucket, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	site, err := s.Site.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	post, _, err := site.PostByID(ctx, "foo")
+	if err != nil {
+		t.Fatalf("PostByID failed: %v", err)
+	}
+	if got, want := post.Content, "content"; got != want {
+		t.Errorf("Content got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+package datastorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Opener opens the bucket for a storage URL with a registered scheme.
+type Opener func(u *url.URL) (Bucket, error)
+
+var (
+	openersLock sync.RWMutex
+	openers     = make(map[string]Opener)
+)
+
+func init() {
+	Register("file", openLocal)
+	Register("gs", openGCP)
+	Register("mem", openMemory)
+	Register("s3", openS3)
+}
+
+// Register makes a storage URL scheme available to Open.
+func Register(scheme string, open Opener) {
+	openersLock.Lock()
+	defer openersLock.Unlock()
+
+	openers[strings.ToLower(scheme)] = open
+}
+
+// Open returns the bucket for a storage URL.
+//
+// The built-in schemes are:
+//
+//   - file:///var/pandablog, or file:storage for a relative path: files in a
+//     directory.
+//   - gs://bucket/prefix: objects under a prefix in a Google Cloud Storage
+//     bucket.
+//   - s3://bucket/prefix?endpoint=http://localhost:9000&region=auto: objects
+//     under a prefix in an S3-compatible bucket, with the credentials from the
+//     AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables. The
+//     endpoint defaults to AWS S3, and custom endpoints use path-style URLs.
+//   - mem://: objects in memory, lost when the process exits.
+func Open(rawURL string) (Bucket, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage URL %q: %w", rawURL, err)
+	}
+
+	openersLock.RLock()
+	open, ok := openers[strings.ToLower(u.Scheme)]
+	openersLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage URL %q, supported schemes: %s", rawURL, strings.Join(schemes(), ", "))
+	}
+	return open(u)
+}
+
+func schemes() []string {
+	openersLock.RLock()
+	defer openersLock.RUnlock()
+
+	arr := make([]string, 0, len(openers))
+	for scheme := range openers {
+		arr = append(arr, scheme)
+	}
+	sort.Strings(arr)
+	return arr
+}
+
+func openLocal(u *url.URL) (Bucket, error) {
+	dir := u.Opaque
+	if dir == "" {
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, fmt.Errorf("unsupported host %q in file URL, use file:///path or file:relative/path", u.Host)
+		}
+		dir = u.Path
+	}
+	if dir == "" {
+		return nil, errors.New("missing path in file URL")
+	}
+	return NewLocalBucket(filepath.FromSlash(dir)), nil
+}
+
+func openGCP(u *url.URL) (Bucket, error) {
+	if u.Host == "" {
+		return nil, errors.New("missing bucket name in gs URL")
+	}
+	return NewGCPBucket(u.Host, strings.Trim(u.Path, "/")), nil
+}
+
+func openMemory(*url.URL) (Bucket, error) {
+	return NewMemoryBucket(), nil
+}
+
+// Sub returns the objects under a prefix in bucket.
+func Sub(bucket Bucket, prefix string) Bucket {
+	return subBucket{
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+type subBucket struct {
+	bucket Bucket
+	prefix string
+}
+
+func (b subBucket) Object(name string) Datastorer {
+	return b.bucket.Object(path.Join(b.prefix, name))
+}
+
+// SessionStorage is an object used to store sessions, where a missing object
+// is loaded as empty, so new buckets need no initial session file.
+type SessionStorage struct {
+	Datastorer
+}
+
+// Load returns the contents of the object, or nil if it does not exist.
+func (s SessionStorage) Load(ctx context.Context) ([]byte, error) {
+	b, err := s.Datastorer.Load(ctx)
+	if errors.Is(err, ErrNotExist) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Update changes the object with fn, calling it again with the new contents
+// when it was changed by someone else in the meantime. fn gets nil if the
+// object does not exist, and the object is not written if fn returns nil.
+func (s SessionStorage) Update(ctx context.Context, fn func(data []byte) ([]byte, error)) error {
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		b, generation, err := s.LoadGeneration(ctx)
+		if errors.Is(err, ErrNotExist) {
+			b, generation, err = nil, "", nil
+		}
+		if err != nil {
+			return err
+		}
+		b, err = fn(b)
+		if err != nil || b == nil {
+			return err
+		}
+
+		_, err = s.SaveIfGeneration(ctx, b, generation)
+		if errors.Is(err, ErrConflict) {
+			continue
+		}
+		return err
+	}
+	return ErrConflict
+}
@@ -0,0 +1,120 @@
+package datastorage_test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/datastorage"
+)
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		label string
+		url   string
+		want  string
+	}{
+		{
+			label: "file",
+			url:   "file://" + filepath.ToSlash(dir),
+			want:  "*datastorage.LocalStorage",
+		},
+		{
+			label: "relative-file",
+			url:   "file:storage",
+			want:  "*datastorage.LocalStorage",
+		},
+		{
+			label: "gs",
+			url:   "gs://bucket/prefix",
+			want:  "*datastorage.GCPStorage",
+		},
+		{
+			label: "s3",
+			url:   "s3://bucket/prefix?endpoint=http://localhost:9000",
+			want:  "*datastorage.S3Storage",
+		},
+		{
+			label: "mem",
+			url:   "mem://",
+			want:  "*datastorage.MemoryStorage",
+		},
+		{
+			label: "file-host",
+			url:   "file://example.com/dir",
+		},
+		{
+			label: "gs-no-bucket",
+			url:   "gs:///prefix",
+		},
+		{
+			label: "s3-no-bucket",
+			url:   "s3:///prefix",
+		},
+		{
+			label: "unknown",
+			url:   "ftp://example.com",
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			bucket, err := datastorage.Open(c.url)
+			if c.want == "" {
+				if err == nil {
+					t.Errorf("Open(%q) got nil error", c.url)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open(%q) failed: %v", c.url, err)
+			}
+			if got := typeName(bucket.Object("site.json")); got != c.want {
+				t.Errorf("Open(%q) got object type %q want %q", c.url, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	ctx := context.Background()
+	mem := datastorage.NewMemoryBucket()
+	datastorage.Register("test", func(u *url.URL) (datastorage.Bucket, error) {
+		return mem, nil
+	})
+	bucket, err := datastorage.Open("test://whatever")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := bucket.Object("foo").Save(ctx, []byte("bar")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if b, err := mem.Object("foo").Load(ctx); err != nil || string(b) != "bar" {
+		t.Errorf("Load got %q, %v want %q, nil", b, err, "bar")
+	}
+}
+
+func TestSub(t *testing.T) {
+	ctx := context.Background()
+	mem := datastorage.NewMemoryBucket()
+	if err := datastorage.Sub(mem, "storage/site").Object("index.json").Save(ctx, []byte("foo")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if b, err := mem.Object("storage/site/index.json").Load(ctx); err != nil || string(b) != "foo" {
+		t.Errorf("Load got %q, %v want %q, nil", b, err, "foo")
+	}
+}
+
+func TestSessionStorage(t *testing.T) {
+	ctx := context.Background()
+	ss := datastorage.SessionStorage{Datastorer: datastorage.NewMemoryStorage()}
+	b, err := ss.Load(ctx)
+	if err != nil || b != nil {
+		t.Errorf("Load on missing object got %q, %v want nil, nil", b, err)
+	}
+}
+
+func typeName(v any) string {
+	return fmt.Sprintf("%T", v)
+}
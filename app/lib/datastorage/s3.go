@@ -0,0 +1,386 @@
+package datastorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// S3Config is the configuration of an S3-compatible object storage bucket.
+type S3Config struct {
+	// Bucket is the name of the bucket.
+	Bucket string
+	// Region is the region used to sign requests, default to "us-east-1".
+	Region string
+	// Endpoint is the URL of the S3 API, for example "http://localhost:9000"
+	// for MinIO. Default to AWS S3 in Region.
+	Endpoint string
+	// PathStyle puts the bucket in the path of the URLs instead of the host
+	// name, which most S3-compatible services need.
+	PathStyle bool
+
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// HTTPClient is the client to send requests with, default to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// S3ConfigFromEnv returns the S3 configuration for bucket with the region,
+// endpoint and credentials from the standard AWS environment variables.
+func S3ConfigFromEnv(bucket string) S3Config {
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	return S3Config{
+		Bucket:          bucket,
+		Region:          region,
+		Endpoint:        endpoint,
+		PathStyle:       endpoint != "",
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+func (c S3Config) region() string {
+	if c.Region == "" {
+		return "us-east-1"
+	}
+	return c.Region
+}
+
+// objectURL returns the URL of the object with the given key.
+func (c S3Config) objectURL(key string) (*url.URL, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + c.region() + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: %w", endpoint, err)
+	}
+	if c.PathStyle {
+		u.Path = path.Join("/", u.Path, c.Bucket, key)
+	} else {
+		u.Host = c.Bucket + "." + u.Host
+		u.Path = path.Join("/", u.Path, key)
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	return u, nil
+}
+
+// S3Storage represents an object in an S3-compatible object storage bucket.
+type S3Storage struct {
+	config S3Config
+	key    string
+}
+
+// NewS3Storage returns an S3 object given the bucket configuration and the
+// object key.
+func NewS3Storage(config S3Config, key string) *S3Storage {
+	return &S3Storage{
+		config: config,
+		key:    key,
+	}
+}
+
+// Load downloads an object from a bucket and returns an error if it cannot
+// be read.
+func (s *S3Storage) Load(ctx context.Context) ([]byte, error) {
+	b, _, err := s.LoadGeneration(ctx)
+	return b, err
+}
+
+// Save uploads an object to a bucket and returns an error if it cannot be
+// written.
+func (s *S3Storage) Save(ctx context.Context, b []byte) error {
+	_, err := s.put(ctx, b, nil)
+	return err
+}
+
+// Delete deletes an object from a bucket.
+//
+// S3 does not report whether the object existed, so it never returns
+// ErrNotExist.
+func (s *S3Storage) Delete(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	resp, err := s.do(ctx, http.MethodDelete, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return s3Error(resp)
+}
+
+// LoadGeneration downloads an object from a bucket along with its ETag as
+// the generation.
+func (s *S3Storage) LoadGeneration(ctx context.Context) ([]byte, string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	resp, err := s.do(ctx, http.MethodGet, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if err := s3Error(resp); err != nil {
+		return nil, "", err
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// SaveIfGeneration uploads an object to a bucket if its ETag still matches
+// generation, otherwise it returns ErrConflict.
+func (s *S3Storage) SaveIfGeneration(ctx context.Context, b []byte, generation string) (string, error) {
+	header := make(http.Header)
+	if generation == "" {
+		header.Set("If-None-Match", "*")
+	} else {
+		header.Set("If-Match", generation)
+	}
+	return s.put(ctx, b, header)
+}
+
+func (s *S3Storage) put(ctx context.Context, b []byte, header http.Header) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	resp, err := s.do(ctx, http.MethodPut, b, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := s3Error(resp); err != nil {
+		return "", err
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+func (s *S3Storage) do(ctx context.Context, method string, body []byte, header http.Header) (*http.Response, error) {
+	u, err := s.config.objectURL(s.key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.config.sign(req, body, time.Now())
+
+	client := s.config.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// s3Error returns the error for a failed response, translating missing
+// objects into ErrNotExist and failed preconditions into ErrConflict.
+func s3Error(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err := fmt.Errorf("s3: %s %s: %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, bytes.TrimSpace(body))
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %w", ErrNotExist, err)
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// 409 is returned when a conflicting conditional write is in flight.
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+	return err
+}
+
+// S3Bucket represents objects under a prefix in an S3-compatible object
+// storage bucket.
+type S3Bucket struct {
+	config S3Config
+	prefix string
+}
+
+// NewS3Bucket returns an S3 bucket given its configuration and a prefix for
+// all the object keys.
+func NewS3Bucket(config S3Config, prefix string) *S3Bucket {
+	return &S3Bucket{
+		config: config,
+		prefix: prefix,
+	}
+}
+
+// Object returns the object with the given name under the prefix.
+func (b *S3Bucket) Object(name string) Datastorer {
+	return NewS3Storage(b.config, path.Join(b.prefix, name))
+}
+
+func openS3(u *url.URL) (Bucket, error) {
+	if u.Host == "" {
+		return nil, errors.New("missing bucket name in s3 URL")
+	}
+	config := S3ConfigFromEnv(u.Host)
+	query := u.Query()
+	if endpoint := query.Get("endpoint"); endpoint != "" {
+		config.Endpoint = endpoint
+		config.PathStyle = true
+	}
+	if region := query.Get("region"); region != "" {
+		config.Region = region
+	}
+	switch query.Get("path_style") {
+	case "true":
+		config.PathStyle = true
+	case "false":
+		config.PathStyle = false
+	}
+	return NewS3Bucket(config, strings.Trim(u.Path, "/")), nil
+}
+
+const (
+	s3Algorithm  = "AWS4-HMAC-SHA256"
+	s3DateLayout = "20060102T150405Z"
+)
+
+// sign signs req with AWS Signature Version 4, if the config has
+// credentials.
+//
+// All the headers in req.Header are signed, along with the host.
+func (c S3Config) sign(req *http.Request, body []byte, now time.Time) {
+	if c.AccessKeyID == "" {
+		return
+	}
+
+	now = now.UTC()
+	date := now.Format(s3DateLayout)
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", date)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := now.Format("20060102") + "/" + c.region() + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		date,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + c.SecretAccessKey)
+	for _, part := range strings.Split(scope, "/") {
+		key = s3HMAC(key, part)
+	}
+	signature := hex.EncodeToString(s3HMAC(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, c.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var parts []string
+	for _, k := range keys {
+		values := slices.Clone(query[k])
+		slices.Sort(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3EscapePath(p string) string {
+	return s3Escape(p, false)
+}
+
+// s3Escape percent-encodes s the way AWS Signature Version 4 expects, which
+// is stricter than url.PathEscape and url.QueryEscape.
+func s3Escape(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			sb.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
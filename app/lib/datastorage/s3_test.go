@@ -0,0 +1,185 @@
+package datastorage_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/datastorage"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// fakeS3 is a minimal fake of the S3 API with path-style URLs and
+// conditional writes.
+type fakeS3 struct {
+	t      *testing.T
+	bucket string
+
+	lock    sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T, bucket string) *httptest.Server {
+	f := &fakeS3{
+		t:       t,
+		bucket:  bucket,
+		objects: make(map[string][]byte),
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func etag(b []byte) string {
+	sum := md5.Sum(b)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	current, exists := f.objects[key]
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", etag(current))
+		w.Write(current)
+
+	case http.MethodPut:
+		if match := r.Header.Get("If-None-Match"); match == "*" && exists {
+			http.Error(w, "PreconditionFailed", http.StatusPreconditionFailed)
+			return
+		}
+		if match := r.Header.Get("If-Match"); match != "" && (!exists || match != etag(current)) {
+			http.Error(w, "PreconditionFailed", http.StatusPreconditionFailed)
+			return
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			f.t.Errorf("Failed to read body: %v", err)
+		}
+		f.objects[key] = b
+		w.Header().Set("ETag", etag(b))
+
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func openFakeS3(t *testing.T) datastorage.Bucket {
+	t.Helper()
+	srv := newFakeS3(t, "bucket")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	bucket, err := datastorage.Open("s3://bucket/prefix?region=auto&endpoint=" + srv.URL)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	return bucket
+}
+
+func TestS3Storage(t *testing.T) {
+	ctx := context.Background()
+	s := openFakeS3(t).Object("site.json")
+
+	if _, err := s.Load(ctx); !errors.Is(err, datastorage.ErrNotExist) {
+		t.Errorf("Load on missing object got error %v want %v", err, datastorage.ErrNotExist)
+	}
+
+	gen, err := s.SaveIfGeneration(ctx, []byte("foo"), "")
+	if err != nil {
+		t.Fatalf("Failed to create object: %v", err)
+	}
+	if _, err := s.SaveIfGeneration(ctx, []byte("bar"), ""); !errors.Is(err, datastorage.ErrConflict) {
+		t.Errorf("SaveIfGeneration on existing object got error %v want %v", err, datastorage.ErrConflict)
+	}
+
+	b, loaded, err := s.LoadGeneration(ctx)
+	if err != nil {
+		t.Fatalf("LoadGeneration failed: %v", err)
+	}
+	if string(b) != "foo" || loaded != gen {
+		t.Errorf("LoadGeneration got %q, %q want %q, %q", b, loaded, "foo", gen)
+	}
+
+	if _, err := s.SaveIfGeneration(ctx, []byte("bar"), gen); err != nil {
+		t.Fatalf("SaveIfGeneration failed: %v", err)
+	}
+	if _, err := s.SaveIfGeneration(ctx, []byte("baz"), gen); !errors.Is(err, datastorage.ErrConflict) {
+		t.Errorf("SaveIfGeneration with old generation got error %v want %v", err, datastorage.ErrConflict)
+	}
+
+	if err := s.Delete(ctx); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := s.Load(ctx); !errors.Is(err, datastorage.ErrNotExist) {
+		t.Errorf("Load on deleted object got error %v want %v", err, datastorage.ErrNotExist)
+	}
+}
+
+func TestS3StorageUpdate(t *testing.T) {
+	ctx := context.Background()
+	bucket := openFakeS3(t)
+	s, err := datastorage.New(ctx, bucket, bucket.Object("site.json"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if err := s.Update(ctx, func(site *model.Site) error {
+		site.UpdatePost("foo", &model.Post{URL: "foo", Content: "content"})
+		return nil
+	}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	s, err = datastorage.New(ctx, bucket, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	site, err := s.Site.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	post, _, err := site.PostByID(ctx, "foo")
+	if err != nil {
+		t.Fatalf("PostByID failed: %v", err)
+	}
+	if got, want := post.Content, "content"; got != want {
+		t.Errorf("Content got %q want %q", got, want)
+	}
+}
+
+func TestS3StorageCanceled(t *testing.T) {
+	s := openFakeS3(t).Object("site.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.Load(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Load with canceled context got error %v want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,199 @@
+package datastorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+
+	"go.yhsif.com/pandablog/app/lib/envdetect"
+)
+
+// ErrSchemaTooNew is returned when the site was written by a newer version
+// with a schema this version does not know, so it must not be overwritten.
+var ErrSchemaTooNew = errors.New("datastorage: site was written by a newer version, please upgrade")
+
+// schemaVersionKey is the JSON key of model.Site.SchemaVersion.
+const schemaVersionKey = "schemaVersion"
+
+// Migration upgrades the site document by one schema version.
+type Migration struct {
+	// Description describes the change, for the logs.
+	Description string
+	// Migrate modifies the decoded JSON document in place. Numbers are
+	// json.Number.
+	Migrate func(doc map[string]any) error
+}
+
+// migrations are the schema migrations in order. The schema version of a
+// document is the number of migrations applied to it, so new migrations must
+// only be appended.
+//
+// Only the changes that transform the stored data need a migration. New
+// fields don't, as the keys older versions don't know are kept when they write
+// the site back, see keepUnknown.
+var migrations = []Migration{
+	{
+		Description: "Backfill the default scheme and login URL",
+		Migrate: func(doc map[string]any) error {
+			for key, value := range map[string]string{
+				"scheme":   "http",
+				"loginurl": "admin",
+			} {
+				if s, _ := doc[key].(string); s == "" {
+					doc[key] = value
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// SchemaVersion returns the current schema version of the site.
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// migrateSchema upgrades the JSON document of the site to the current schema
+// version, and reports whether it was changed.
+//
+// It returns ErrSchemaTooNew if the document has a newer schema version.
+func migrateSchema(ctx context.Context, b []byte) ([]byte, bool, error) {
+	var doc map[string]any
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, false, err
+	}
+	if doc == nil {
+		doc = make(map[string]any)
+	}
+
+	var version int
+	if v, ok := doc[schemaVersionKey]; ok {
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, false, fmt.Errorf("invalid schema version %v", v)
+		}
+		i, err := n.Int64()
+		if err != nil || i < 0 {
+			return nil, false, fmt.Errorf("invalid schema version %v", v)
+		}
+		version = int(i)
+	}
+	switch {
+	case version > SchemaVersion():
+		return nil, false, fmt.Errorf("%w: schema version %d, supported %d", ErrSchemaTooNew, version, SchemaVersion())
+	case version == SchemaVersion():
+		return b, false, nil
+	}
+
+	for i, m := range migrations[version:] {
+		to := version + i + 1
+		if err := m.Migrate(doc); err != nil {
+			return nil, false, fmt.Errorf("failed to migrate site to schema version %d (%s): %w", to, m.Description, err)
+		}
+		slog.InfoContext(ctx, "Migrated site schema", "version", to, "migration", m.Description)
+	}
+	doc[schemaVersionKey] = SchemaVersion()
+
+	b, err := marshal(doc)
+	return b, true, err
+}
+
+// keepUnknown adds the keys in the objects of the stored JSON document old,
+// decoded into the type t, that t doesn't know to the new document b encoded
+// from t, so the fields added by newer versions are not lost when an older
+// version writes the document back. Objects are matched by their keys in the
+// structs and maps, not in the arrays.
+func keepUnknown(old, b []byte, t reflect.Type) ([]byte, error) {
+	merged, changed, err := mergeUnknown(old, b, t)
+	if err != nil || !changed {
+		return b, err
+	}
+	if envdetect.RunningLocalDev() {
+		var buf bytes.Buffer
+		err := json.Indent(&buf, merged, "", "    ")
+		return buf.Bytes(), err
+	}
+	return merged, nil
+}
+
+func mergeUnknown(old, b []byte, t reflect.Type) ([]byte, bool, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var known map[string]reflect.Type
+	switch t.Kind() {
+	case reflect.Struct:
+		known = jsonFields(t)
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return b, false, nil
+		}
+	default:
+		return b, false, nil
+	}
+
+	var oldDoc, doc map[string]json.RawMessage
+	if json.Unmarshal(old, &oldDoc) != nil || json.Unmarshal(b, &doc) != nil || oldDoc == nil || doc == nil {
+		// Not objects on both sides, nothing to keep.
+		return b, false, nil
+	}
+	var changed bool
+	for key, value := range oldDoc {
+		var ft reflect.Type
+		if known == nil {
+			ft = t.Elem()
+		} else if ft = known[key]; ft == nil {
+			doc[key] = value
+			changed = true
+			continue
+		}
+		current, ok := doc[key]
+		if !ok {
+			continue
+		}
+		merged, c, err := mergeUnknown(value, current, ft)
+		if err != nil {
+			return nil, false, err
+		}
+		if c {
+			doc[key] = merged
+			changed = true
+		}
+	}
+	if !changed {
+		return b, false, nil
+	}
+	merged, err := json.Marshal(doc)
+	return merged, true, err
+}
+
+// jsonFields returns the types of the fields of the struct type t by their
+// JSON keys, including the fields of the embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			// Its fields are visible fields too.
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
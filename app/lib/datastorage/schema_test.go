@@ -0,0 +1,204 @@
+package datastorage_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/datastorage"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+func TestStorageSchemaMigration(t *testing.T) {
+	ctx := context.Background()
+	bucket := datastorage.NewMemoryBucket()
+	index := bucket.Object("index.json")
+	if err := index.Save(ctx, []byte(`{"title":"foo","posts":{},"postObjects":{}}`)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	s, err := datastorage.New(ctx, bucket, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	site, err := s.Site.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got, want := site.Title, "foo"; got != want {
+		t.Errorf("Title got %q want %q", got, want)
+	}
+	if got, want := site.LoginURL, "admin"; got != want {
+		t.Errorf("LoginURL got %q want %q", got, want)
+	}
+
+	// The migrated index is written back once.
+	b, generation, err := index.LoadGeneration(ctx)
+	if err != nil {
+		t.Fatalf("LoadGeneration failed: %v", err)
+	}
+	var doc struct {
+		SchemaVersion int    `json:"schemaVersion"`
+		Scheme        string `json:"scheme"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("Failed to parse index: %v", err)
+	}
+	if doc.SchemaVersion != datastorage.SchemaVersion() || doc.Scheme != "http" {
+		t.Errorf("Stored index got schema version %d, scheme %q want %d, %q", doc.SchemaVersion, doc.Scheme, datastorage.SchemaVersion(), "http")
+	}
+
+	if _, err := datastorage.New(ctx, bucket, nil); err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, got, err := index.LoadGeneration(ctx); err != nil || got != generation {
+		t.Errorf("Index rewritten without migration, generation got %q want %q (%v)", got, generation, err)
+	}
+}
+
+func TestStorageSchemaDefaults(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []struct {
+		label      string
+		stored     string
+		scheme     string
+		loginURL   string
+		fromLegacy bool
+	}{
+		{
+			label:      "legacy",
+			stored:     `{"title":"foo","posts":{}}`,
+			scheme:     "http",
+			loginURL:   "admin",
+			fromLegacy: true,
+		},
+		{
+			label:    "index",
+			stored:   `{"title":"foo","posts":{},"postObjects":{}}`,
+			scheme:   "http",
+			loginURL: "admin",
+		},
+		{
+			// Only the migrations set the defaults, not every load.
+			label:  "migrated",
+			stored: fmt.Sprintf(`{"schemaVersion":%d,"title":"foo","posts":{},"postObjects":{}}`, datastorage.SchemaVersion()),
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			bucket := datastorage.NewMemoryBucket()
+			var legacy datastorage.Datastorer
+			object := bucket.Object("index.json")
+			if c.fromLegacy {
+				legacy = datastorage.NewMemoryStorage()
+				object = legacy
+			}
+			if err := object.Save(ctx, []byte(c.stored)); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+
+			s, err := datastorage.New(ctx, bucket, legacy)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			site, err := s.Site.Load(ctx)
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if site.Scheme != c.scheme || site.LoginURL != c.loginURL {
+				t.Errorf("Scheme, LoginURL got %q, %q want %q, %q", site.Scheme, site.LoginURL, c.scheme, c.loginURL)
+			}
+		})
+	}
+}
+
+func TestStorageSchemaTooNew(t *testing.T) {
+	ctx := context.Background()
+	newer := fmt.Appendf(nil, `{"schemaVersion":%d,"posts":{},"futureField":true}`, datastorage.SchemaVersion()+1)
+
+	bucket := datastorage.NewMemoryBucket()
+	if err := bucket.Object("index.json").Save(ctx, newer); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := datastorage.New(ctx, bucket, nil); !errors.Is(err, datastorage.ErrSchemaTooNew) {
+		t.Errorf("New got error %v want %v", err, datastorage.ErrSchemaTooNew)
+	}
+	if b, err := bucket.Object("index.json").Load(ctx); err != nil || string(b) != string(newer) {
+		t.Errorf("Index got %q, %v want %q unchanged", b, err, newer)
+	}
+
+	legacy := datastorage.NewMemoryBucket()
+	if err := legacy.Object("site.json").Save(ctx, newer); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := datastorage.New(ctx, legacy, legacy.Object("site.json")); !errors.Is(err, datastorage.ErrSchemaTooNew) {
+		t.Errorf("New with legacy site got error %v want %v", err, datastorage.ErrSchemaTooNew)
+	}
+}
+
+func TestStorageKeepUnknown(t *testing.T) {
+	ctx := context.Background()
+	bucket := datastorage.NewMemoryBucket()
+	index := bucket.Object("index.json")
+	stored := fmt.Appendf(nil, `{
+		"schemaVersion": %d,
+		"title": "foo",
+		"futureSetting": {"a": 1},
+		"redirects": {"/old": "1"},
+		"posts": {"1": {"title": "post", "futurePostField": "x"}},
+		"users": {"alice": {"role": "author", "futureUserField": true}},
+		"postObjects": {"1": "posts/1/a.json"}
+	}`, datastorage.SchemaVersion())
+	if err := index.Save(ctx, stored); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	s, err := datastorage.New(ctx, bucket, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := s.Update(ctx, func(site *model.Site) error {
+		site.Title = "bar"
+		site.Redirects = nil
+		return nil
+	}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	b, err := index.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var doc struct {
+		Title         string          `json:"title"`
+		FutureSetting map[string]int  `json:"futureSetting"`
+		Redirects     json.RawMessage `json:"redirects"`
+		Posts         map[string]struct {
+			Title           string `json:"title"`
+			FuturePostField string `json:"futurePostField"`
+		} `json:"posts"`
+		Users map[string]struct {
+			Role            string `json:"role"`
+			FutureUserField bool   `json:"futureUserField"`
+		} `json:"users"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("Failed to parse index: %v", err)
+	}
+	if doc.Title != "bar" {
+		t.Errorf("Title got %q want %q", doc.Title, "bar")
+	}
+	if got := doc.FutureSetting["a"]; got != 1 {
+		t.Errorf("futureSetting got %v want a: 1", doc.FutureSetting)
+	}
+	if doc.Redirects != nil {
+		t.Errorf("Deleted redirects came back: %s", doc.Redirects)
+	}
+	if p := doc.Posts["1"]; p.Title != "post" || p.FuturePostField != "x" {
+		t.Errorf("Post got %+v want the title and futurePostField", p)
+	}
+	if u := doc.Users["alice"]; u.Role != "author" || !u.FutureUserField {
+		t.Errorf("User got %+v want the role and futureUserField", u)
+	}
+}
@@ -3,7 +3,16 @@ package datastorage
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
 	"os"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -13,44 +22,116 @@ import (
 	"go.yhsif.com/pandablog/app/model"
 )
 
+var (
+	// ErrConflict is returned when an object was changed by someone else after
+	// it was loaded.
+	ErrConflict = errors.New("datastorage: object was modified concurrently")
+
+	// ErrNotExist is returned when an object does not exist.
+	ErrNotExist = errors.New("datastorage: object does not exist")
+)
+
 // Datastorer reads and writes data to an object.
+//
+// A generation is an opaque string identifying a version of the object, with
+// empty string meaning that the object does not exist yet.
+//
+// Operations on remote objects end at the earlier of the deadline of ctx and
+// PBB_STORAGE_TIMEOUT (default 50s).
 type Datastorer interface {
-	Save([]byte) error
-	Load() ([]byte, error)
+	Save(ctx context.Context, data []byte) error
+	Load(ctx context.Context) ([]byte, error)
+	Delete(ctx context.Context) error
+
+	// LoadGeneration reads the object along with its current generation.
+	LoadGeneration(ctx context.Context) (data []byte, generation string, err error)
+	// SaveIfGeneration writes the object only if its current generation still
+	// matches generation, otherwise it returns ErrConflict.
+	SaveIfGeneration(ctx context.Context, data []byte, generation string) (newGeneration string, err error)
 }
 
 // Storage represents a writable and readable object.
+//
+// The site is stored in a bucket as a small index object with the site
+// settings and post metadata, and one object per post revision with the post
+// contents, which are loaded lazily.
 type Storage struct {
 	Site *stalecache.Cache[model.Site]
 
-	datastorer Datastorer
-	reload     atomic.Int32
+	bucket    Bucket
+	revisions int
+	reload    atomic.Int32
+}
+
+// Revision is a prior revision of a post.
+type Revision struct {
+	ID      string
+	Updated time.Time
 }
 
 const (
 	defaultCacheTTL = 1 * time.Minute
 	cacheTTLEnv     = "PBB_CACHE_TTL"
+
+	defaultPostRevisions = 10
+	postRevisionsEnv     = "PBB_POST_REVISIONS"
+
+	// maxUpdateAttempts is the number of times Update tries before giving up
+	// on ErrConflict.
+	maxUpdateAttempts = 5
+
+	// indexObject is the name of the index object in the bucket.
+	indexObject = "index.json"
+	// postsPrefix is the prefix of the post objects in the bucket.
+	postsPrefix = "posts/"
 )
 
+// siteIndex is the format of the index object.
+type siteIndex struct {
+	*model.Site
+
+	// Posts shadows Site.Posts, to store post metadata without contents.
+	Posts map[string]model.Post `json:"posts"`
+
+	// PostObjects maps post ids to the names of the objects storing the
+	// current revisions of the posts.
+	PostObjects map[string]string `json:"postObjects"`
+
+	// PostRevisions maps post ids to their prior revisions, newest first.
+	PostRevisions map[string][]postRevision `json:"postRevisions,omitempty"`
+
+	// stored is the index as it was loaded, to keep the keys this version
+	// doesn't know when writing it back.
+	stored []byte
+}
+
+// postRevision is a prior revision of a post in the index object.
+type postRevision struct {
+	Object  string    `json:"object"`
+	Updated time.Time `json:"updated"`
+}
+
+// ID returns the id of the revision, which is the base name of its object.
+func (r postRevision) ID() string {
+	return strings.TrimSuffix(path.Base(r.Object), ".json")
+}
+
 func validateSite(site *model.Site) {
 	// Set the defaults for the site object.
 	// Save to storage. Ensure the posts exists first so it doesn't error.
 	if site.Posts == nil {
 		site.Posts = make(map[string]model.Post)
 	}
-	// Ensure redirects don't try to happen if the scheme is empty.
-	if site.Scheme == "" {
-		site.Scheme = "http"
-	}
-	// Ensure it's set to the login page works.
-	if site.LoginURL == "" {
-		site.LoginURL = "admin"
-	}
+	// The default scheme and login URL are backfilled by the migrations.
 }
 
-// New returns a writable and readable site object. Returns an error if the
-// object cannot be initially read.
-func New(ds Datastorer) (*Storage, error) {
+// New returns a writable and readable site object stored in bucket. Returns an
+// error if the object cannot be initially read.
+//
+// If the site index does not exist in bucket yet, it's migrated from legacy,
+// the single object storing the whole site used by previous versions, or a new
+// empty site is created if legacy is nil or does not exist either.
+func New(ctx context.Context, bucket Bucket, legacy Datastorer) (*Storage, error) {
 	ttlString := os.Getenv(cacheTTLEnv)
 	ttl := defaultCacheTTL
 	if ttlString != "" {
@@ -58,24 +139,21 @@ func New(ds Datastorer) (*Storage, error) {
 			ttl = newTTL
 		}
 	}
+	revisions := defaultPostRevisions
+	if n, err := strconv.Atoi(os.Getenv(postRevisionsEnv)); err == nil && n >= 0 {
+		revisions = n
+	}
 	s := &Storage{
-		datastorer: ds,
+		bucket:    bucket,
+		revisions: revisions,
 	}
 	s.Site = stalecache.New(
-		func(context.Context) (*model.Site, error) {
-			b, err := s.datastorer.Load()
+		func(ctx context.Context) (*model.Site, error) {
+			index, _, err := s.load(ctx)
 			if err != nil {
 				return nil, err
 			}
-
-			site := new(model.Site)
-			err = json.Unmarshal(b, site)
-			if err != nil {
-				return nil, err
-			}
-
-			validateSite(site)
-			return site, nil
+			return index.Site, nil
 		},
 		stalecache.WithTTL[model.Site](ttl),
 		stalecache.WithValidator(func(context.Context, *model.Site, time.Time) (fresh bool) {
@@ -83,38 +161,339 @@ func New(ds Datastorer) (*Storage, error) {
 		}),
 	)
 
-	if _, err := s.Site.Load(context.Background()); err != nil {
+	if err := s.migrate(ctx, legacy); err != nil {
+		return nil, err
+	}
+	if _, err := s.Site.Load(ctx); err != nil {
 		return nil, err
 	}
 
 	return s, nil
 }
 
-// Save writes the site object to the data storage and returns an error if it
-// cannot be written.
-func (s *Storage) Save(site *model.Site) error {
-	var b []byte
-	var err error
+// migrate writes the site stored in legacy, or an empty site, into the bucket
+// if the site index does not exist yet.
+func (s *Storage) migrate(ctx context.Context, legacy Datastorer) error {
+	_, err := s.bucket.Object(indexObject).Load(ctx)
+	if !errors.Is(err, ErrNotExist) {
+		return err
+	}
+
+	// Start a new site when there is nothing to migrate.
+	b := []byte("{}")
+	if legacy != nil {
+		b, err = legacy.Load(ctx)
+		switch {
+		case errors.Is(err, ErrNotExist):
+			b = []byte("{}")
+		case err != nil:
+			return fmt.Errorf("failed to load legacy site for migration: %w", err)
+		}
+	}
+	b, _, err = migrateSchema(ctx, b)
+	if err != nil {
+		return fmt.Errorf("failed to migrate legacy site: %w", err)
+	}
+	site := new(model.Site)
+	if err := json.Unmarshal(b, site); err != nil {
+		return fmt.Errorf("failed to parse legacy site for migration: %w", err)
+	}
+	validateSite(site)
 
-	if envdetect.RunningLocalDev() {
-		// Indent so the data is easy to read.
-		b, err = json.MarshalIndent(site, "", "    ")
-	} else {
-		b, err = json.Marshal(site)
+	objects := make(map[string]string, len(site.Posts))
+	for id, post := range site.Posts {
+		name, err := s.savePost(ctx, id, post)
+		if err != nil {
+			s.deleteObjects(ctx, slices.Collect(maps.Values(objects)))
+			return err
+		}
+		objects[id] = name
 	}
 
+	b, err = marshalIndex(&siteIndex{Site: site, PostObjects: objects})
 	if err != nil {
 		return err
 	}
-
-	if err := s.datastorer.Save(b); err != nil {
+	if _, err := s.bucket.Object(indexObject).SaveIfGeneration(ctx, b, ""); err != nil {
+		s.deleteObjects(ctx, slices.Collect(maps.Values(objects)))
+		if errors.Is(err, ErrConflict) {
+			// Someone else migrated it first.
+			return nil
+		}
 		return err
 	}
-	s.Site.Update(site)
 
+	slog.InfoContext(ctx, "Migrated legacy site to per-post storage", "posts", len(objects))
 	return nil
 }
 
+// load reads the site index and its generation from the bucket, bypassing the
+// cache.
+//
+// If the index has an older schema version, it's migrated and written back.
+func (s *Storage) load(ctx context.Context) (*siteIndex, string, error) {
+	b, generation, err := s.loadIndex(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	site := new(model.Site)
+	index := &siteIndex{Site: site, stored: b}
+	err = json.Unmarshal(b, index)
+	if err != nil {
+		return nil, "", err
+	}
+	site.Posts = index.Posts
+	if index.PostObjects == nil {
+		index.PostObjects = make(map[string]string)
+	}
+	if index.PostRevisions == nil {
+		index.PostRevisions = make(map[string][]postRevision)
+	}
+
+	validateSite(site)
+	objects := index.PostObjects
+	site.SetContentLoader(func(ctx context.Context, id string) (string, error) {
+		post, err := s.loadPost(ctx, id, objects[id])
+		return post.Content, err
+	})
+	return index, generation, nil
+}
+
+// loadIndex reads the site index at the current schema version and its
+// generation from the bucket.
+func (s *Storage) loadIndex(ctx context.Context) ([]byte, string, error) {
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		b, generation, err := s.bucket.Object(indexObject).LoadGeneration(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		b, migrated, err := migrateSchema(ctx, b)
+		if err != nil || !migrated {
+			return b, generation, err
+		}
+
+		generation, err = s.bucket.Object(indexObject).SaveIfGeneration(ctx, b, generation)
+		if errors.Is(err, ErrConflict) {
+			// Someone else changed it, migrate their version instead.
+			continue
+		}
+		return b, generation, err
+	}
+	return nil, "", ErrConflict
+}
+
+// loadPost loads post id from object name.
+//
+// If the object no longer exists, the index used is stale, so it invalidates
+// the site cache and tries again with the object from the latest index.
+func (s *Storage) loadPost(ctx context.Context, id, name string) (model.Post, error) {
+	var post model.Post
+	b, err := s.bucket.Object(name).Load(ctx)
+	if errors.Is(err, ErrNotExist) {
+		s.InvalidateSite()
+		var index *siteIndex
+		index, _, err = s.load(ctx)
+		if err != nil {
+			return post, err
+		}
+		b, err = s.bucket.Object(index.PostObjects[id]).Load(ctx)
+	}
+	if err != nil {
+		return post, err
+	}
+
+	err = json.Unmarshal(b, &post)
+	return post, err
+}
+
+// Update loads the latest site object from the data storage, calls fn to
+// modify it, and writes it back.
+//
+// If the site object was changed by someone else before it's written back,
+// Update reloads it and calls fn again, so fn could be called multiple times
+// and must only depend on the site passed in. It returns ErrConflict if it
+// still cannot write after a few attempts. If fn returns an error, the update
+// is aborted and that error is returned as-is.
+//
+// The replaced revisions of the updated posts are kept as prior revisions, up
+// to PBB_POST_REVISIONS (default 10) per post.
+func (s *Storage) Update(ctx context.Context, fn func(*model.Site) error) error {
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		index, generation, err := s.load(ctx)
+		if err != nil {
+			return err
+		}
+		site := index.Site
+		previous := maps.Clone(site.Posts)
+
+		if err := fn(site); err != nil {
+			return err
+		}
+
+		// Write the new revisions of the changed posts first, so the index
+		// never references a missing object.
+		var written, removed []string
+		for _, id := range site.ChangedPostIDs() {
+			post, ok, err := site.PostByID(ctx, id)
+			if err != nil {
+				s.deleteObjects(ctx, written)
+				return err
+			}
+
+			old, existed := index.PostObjects[id]
+			if !ok {
+				// Deleted, remove all its revisions.
+				if existed {
+					removed = append(removed, old)
+				}
+				for _, r := range index.PostRevisions[id] {
+					removed = append(removed, r.Object)
+				}
+				delete(index.PostObjects, id)
+				delete(index.PostRevisions, id)
+				continue
+			}
+
+			name, err := s.savePost(ctx, id, post)
+			if err != nil {
+				s.deleteObjects(ctx, written)
+				return err
+			}
+			written = append(written, name)
+			index.PostObjects[id] = name
+
+			if existed {
+				revisions := append([]postRevision{{
+					Object:  old,
+					Updated: previous[id].Updated,
+				}}, index.PostRevisions[id]...)
+				if len(revisions) > s.revisions {
+					for _, r := range revisions[s.revisions:] {
+						removed = append(removed, r.Object)
+					}
+					revisions = revisions[:s.revisions]
+				}
+				if len(revisions) > 0 {
+					index.PostRevisions[id] = revisions
+				} else {
+					delete(index.PostRevisions, id)
+				}
+			}
+		}
+
+		b, err := marshalIndex(index)
+		if err != nil {
+			s.deleteObjects(ctx, written)
+			return err
+		}
+		if _, err := s.bucket.Object(indexObject).SaveIfGeneration(ctx, b, generation); err != nil {
+			s.deleteObjects(ctx, written)
+			if errors.Is(err, ErrConflict) {
+				slog.WarnContext(
+					ctx,
+					"Site was modified concurrently, retrying",
+					"attempt", attempt,
+				)
+				continue
+			}
+			return err
+		}
+		s.deleteObjects(ctx, removed)
+		s.Site.Update(site)
+		return nil
+	}
+	return ErrConflict
+}
+
+// Revisions returns the prior revisions of post id, newest first.
+func (s *Storage) Revisions(ctx context.Context, id string) ([]Revision, error) {
+	index, _, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]Revision, 0, len(index.PostRevisions[id]))
+	for _, r := range index.PostRevisions[id] {
+		revisions = append(revisions, Revision{
+			ID:      r.ID(),
+			Updated: r.Updated,
+		})
+	}
+	return revisions, nil
+}
+
+// Revision loads a prior revision of post id. It returns ErrNotExist if the
+// revision does not exist.
+func (s *Storage) Revision(ctx context.Context, id string, revision string) (model.Post, error) {
+	index, _, err := s.load(ctx)
+	if err != nil {
+		return model.Post{}, err
+	}
+
+	for _, r := range index.PostRevisions[id] {
+		if r.ID() != revision {
+			continue
+		}
+		b, err := s.bucket.Object(r.Object).Load(ctx)
+		if err != nil {
+			return model.Post{}, err
+		}
+		var post model.Post
+		err = json.Unmarshal(b, &post)
+		return post, err
+	}
+	return model.Post{}, fmt.Errorf("revision %q of post %q: %w", revision, id, ErrNotExist)
+}
+
+// savePost writes a new revision of post id to the bucket and returns the name
+// of the object.
+func (s *Storage) savePost(ctx context.Context, id string, post model.Post) (string, error) {
+	b, err := marshal(post)
+	if err != nil {
+		return "", err
+	}
+	name := postsPrefix + id + "/" + strconv.FormatInt(time.Now().UnixNano(), 36) + ".json"
+	if err := s.bucket.Object(name).Save(ctx, b); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// deleteObjects deletes objects from the bucket, only logging the errors as
+// the leftover objects are harmless.
+func (s *Storage) deleteObjects(ctx context.Context, names []string) {
+	for _, name := range names {
+		if err := s.bucket.Object(name).Delete(ctx); err != nil {
+			slog.WarnContext(ctx, "Failed to delete object", "err", err, "name", name)
+		}
+	}
+}
+
+// marshalIndex encodes the index object with post contents stripped, at the
+// current schema version, with the unknown keys of the stored index kept.
+func marshalIndex(index *siteIndex) ([]byte, error) {
+	index.Site.SchemaVersion = SchemaVersion()
+	index.Posts = make(map[string]model.Post, len(index.Site.Posts))
+	for id, post := range index.Site.Posts {
+		post.Content = ""
+		index.Posts[id] = post
+	}
+	b, err := marshal(index)
+	if err != nil || index.stored == nil {
+		return b, err
+	}
+	return keepUnknown(index.stored, b, reflect.TypeFor[siteIndex]())
+}
+
+func marshal(v any) ([]byte, error) {
+	if envdetect.RunningLocalDev() {
+		// Indent so the data is easy to read.
+		return json.MarshalIndent(v, "", "    ")
+	}
+	return json.Marshal(v)
+}
+
 // InvalidateSite invalidates the site cache and force a reload on next load.
 func (s *Storage) InvalidateSite() {
 	s.reload.Store(1)
@@ -0,0 +1,157 @@
+package datastorage_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/datastorage"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+func TestStorageMigrate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	legacyPath := filepath.Join(dir, "site.json")
+	const legacy = `{"title":"foo","posts":{"id":{"title":"bar","url":"bar","content":"baz"}}}`
+	if err := os.WriteFile(legacyPath, []byte(legacy), 0644); err != nil {
+		t.Fatalf("Failed to write %q: %v", legacyPath, err)
+	}
+
+	bucket := datastorage.NewLocalBucket(filepath.Join(dir, "site"))
+	s, err := datastorage.New(ctx, bucket, datastorage.NewLocalStorage(legacyPath))
+	if err != nil {
+		t.Fatalf("datastorage.New failed: %v", err)
+	}
+
+	// Remove the legacy file to make sure it's no longer used.
+	if err := os.Remove(legacyPath); err != nil {
+		t.Fatalf("Failed to remove %q: %v", legacyPath, err)
+	}
+	s, err = datastorage.New(ctx, bucket, datastorage.NewLocalStorage(legacyPath))
+	if err != nil {
+		t.Fatalf("datastorage.New after migration failed: %v", err)
+	}
+
+	site, err := s.Site.Load(ctx)
+	if err != nil {
+		t.Fatalf("Failed to load site: %v", err)
+	}
+	if got, want := site.Title, "foo"; got != want {
+		t.Errorf("Title got %q want %q", got, want)
+	}
+	if got, want := site.Posts["id"].Content, ""; got != want {
+		t.Errorf("Content before PostByID got %q want %q", got, want)
+	}
+	p, err := site.PostBySlug(ctx, "bar")
+	if err != nil {
+		t.Fatalf("PostBySlug failed: %v", err)
+	}
+	if got, want := p.Content, "baz"; got != want {
+		t.Errorf("Content got %q want %q", got, want)
+	}
+}
+
+func TestStorageUpdate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	legacyPath := filepath.Join(dir, "site.json")
+	if err := os.WriteFile(legacyPath, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to write %q: %v", legacyPath, err)
+	}
+	bucket := datastorage.NewLocalBucket(filepath.Join(dir, "site"))
+	s, err := datastorage.New(ctx, bucket, datastorage.NewLocalStorage(legacyPath))
+	if err != nil {
+		t.Fatalf("datastorage.New failed: %v", err)
+	}
+
+	for _, content := range []string{"foo", "bar"} {
+		if err := s.Update(ctx, func(site *model.Site) error {
+			site.UpdatePost("id", &model.Post{Content: content})
+			return nil
+		}); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+
+		// Use a new Storage to bypass the cache.
+		s2, err := datastorage.New(ctx, bucket, nil)
+		if err != nil {
+			t.Fatalf("datastorage.New failed: %v", err)
+		}
+		site, err := s2.Site.Load(ctx)
+		if err != nil {
+			t.Fatalf("Failed to load site: %v", err)
+		}
+		p, ok, err := site.PostByID(ctx, "id")
+		if err != nil || !ok {
+			t.Fatalf("PostByID got %v, %v", ok, err)
+		}
+		if got, want := p.Content, content; got != want {
+			t.Errorf("Content got %q want %q", got, want)
+		}
+	}
+
+	revisions, err := s.Revisions(ctx, "id")
+	if err != nil {
+		t.Fatalf("Revisions failed: %v", err)
+	}
+	if got, want := len(revisions), 1; got != want {
+		t.Fatalf("Got %d revisions want %d", got, want)
+	}
+	p, err := s.Revision(ctx, "id", revisions[0].ID)
+	if err != nil {
+		t.Fatalf("Revision failed: %v", err)
+	}
+	if got, want := p.Content, "foo"; got != want {
+		t.Errorf("Revision content got %q want %q", got, want)
+	}
+}
+
+func TestStorageUpdatePruneRevisions(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("PBB_POST_REVISIONS", "1")
+
+	dir := t.TempDir()
+	legacyPath := filepath.Join(dir, "site.json")
+	if err := os.WriteFile(legacyPath, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to write %q: %v", legacyPath, err)
+	}
+	bucket := datastorage.NewLocalBucket(filepath.Join(dir, "site"))
+	s, err := datastorage.New(ctx, bucket, datastorage.NewLocalStorage(legacyPath))
+	if err != nil {
+		t.Fatalf("datastorage.New failed: %v", err)
+	}
+
+	for _, content := range []string{"foo", "bar", "baz"} {
+		if err := s.Update(ctx, func(site *model.Site) error {
+			site.UpdatePost("id", &model.Post{Content: content})
+			return nil
+		}); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+	}
+
+	// Only the current and one prior revision should be kept.
+	objects, err := os.ReadDir(filepath.Join(dir, "site", "posts", "id"))
+	if err != nil {
+		t.Fatalf("Failed to read post dir: %v", err)
+	}
+	if got, want := len(objects), 2; got != want {
+		t.Errorf("Got %d post objects want %d", got, want)
+	}
+
+	if err := s.Update(ctx, func(site *model.Site) error {
+		site.UpdatePost("id", nil)
+		return nil
+	}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	objects, err = os.ReadDir(filepath.Join(dir, "site", "posts", "id"))
+	if err != nil {
+		t.Fatalf("Failed to read post dir: %v", err)
+	}
+	if got, want := len(objects), 0; got != want {
+		t.Errorf("Got %d post objects after delete want %d", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package datastorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"go.yhsif.com/pandablog/app/lib/throttle"
+)
+
+// throttleObject is the name of the object of the failed login attempts in
+// the bucket. They are kept out of the site index, so failed logins don't
+// rewrite it.
+const throttleObject = "throttle.json"
+
+// ThrottleStore keeps the failed login attempts in their own object in the
+// bucket, shared by all the instances.
+type ThrottleStore struct {
+	object Datastorer
+}
+
+// ThrottleStore returns the store of the failed login attempts in the bucket
+// of s.
+func (s *Storage) ThrottleStore() *ThrottleStore {
+	return &ThrottleStore{object: s.bucket.Object(throttleObject)}
+}
+
+// load reads the entries with the generation of the object.
+func (s *ThrottleStore) load(ctx context.Context) (map[string]throttle.Entry, string, error) {
+	entries := make(map[string]throttle.Entry)
+	b, generation, err := s.object.LoadGeneration(ctx)
+	if errors.Is(err, ErrNotExist) {
+		return entries, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, "", err
+	}
+	return entries, generation, nil
+}
+
+// Entries returns the stored entries by their keys.
+func (s *ThrottleStore) Entries(ctx context.Context) (map[string]throttle.Entry, error) {
+	entries, _, err := s.load(ctx)
+	return entries, err
+}
+
+// UpdateEntries changes the stored entries with fn, retrying when they were
+// changed by another instance, and only writes them if fn returns true.
+func (s *ThrottleStore) UpdateEntries(ctx context.Context, fn func(entries map[string]throttle.Entry) bool) error {
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		entries, generation, err := s.load(ctx)
+		if err != nil {
+			return err
+		}
+		if !fn(entries) {
+			return nil
+		}
+
+		b, err := json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		if _, err := s.object.SaveIfGeneration(ctx, b, generation); err != nil {
+			if errors.Is(err, ErrConflict) {
+				slog.WarnContext(
+					ctx,
+					"Failed login attempts were modified concurrently, retrying",
+					"attempt", attempt,
+				)
+				continue
+			}
+			return err
+		}
+		return nil
+	}
+	return ErrConflict
+}
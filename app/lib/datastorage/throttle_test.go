@@ -0,0 +1,57 @@
+package datastorage_test
+
+import (
+	"context"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/datastorage"
+	"go.yhsif.com/pandablog/app/lib/throttle"
+)
+
+func TestThrottleStore(t *testing.T) {
+	ctx := context.Background()
+	bucket := datastorage.NewMemoryBucket()
+	s, err := datastorage.New(ctx, bucket, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	store := s.ThrottleStore()
+	_, generation, err := bucket.Object("index.json").LoadGeneration(ctx)
+	if err != nil {
+		t.Fatalf("LoadGeneration failed: %v", err)
+	}
+
+	entries, err := store.Entries(ctx)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Entries of a new store got %v, %v want empty", entries, err)
+	}
+
+	err = store.UpdateEntries(ctx, func(entries map[string]throttle.Entry) bool {
+		entries["user:alice"] = throttle.Entry{Failures: 1}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("UpdateEntries failed: %v", err)
+	}
+	// Not written when unchanged.
+	err = store.UpdateEntries(ctx, func(entries map[string]throttle.Entry) bool {
+		entries["user:bob"] = throttle.Entry{Failures: 1}
+		return false
+	})
+	if err != nil {
+		t.Fatalf("UpdateEntries failed: %v", err)
+	}
+
+	entries, err = s.ThrottleStore().Entries(ctx)
+	if err != nil {
+		t.Fatalf("Entries failed: %v", err)
+	}
+	if len(entries) != 1 || entries["user:alice"].Failures != 1 {
+		t.Errorf("Entries got %v want alice with 1 failure", entries)
+	}
+
+	// Kept out of the site index.
+	if _, got, err := bucket.Object("index.json").LoadGeneration(ctx); err != nil || got != generation {
+		t.Errorf("Site index changed by the failed login attempts: %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package datastorage
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout = 50 * time.Second
+	timeoutEnv     = "PBB_STORAGE_TIMEOUT"
+)
+
+// timeout is the timeout of every operation on remote objects, from
+// PBB_STORAGE_TIMEOUT (default 50s).
+var timeout = sync.OnceValue(func() time.Duration {
+	if s := os.Getenv(timeoutEnv); s != "" {
+		d, err := time.ParseDuration(s)
+		if err == nil && d > 0 {
+			return d
+		}
+		slog.Warn("Invalid storage timeout, using the default", "env", timeoutEnv, "value", s, "default", defaultTimeout)
+	}
+	return defaultTimeout
+})
+
+// withTimeout returns ctx with the storage operation timeout applied, so an
+// operation ends at the earlier of the deadline of ctx and the timeout.
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, timeout())
+}
@@ -0,0 +1,213 @@
+// Package export exports a site as Markdown files with YAML front matter.
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// SiteFile is the name of the file with the site settings in the archive.
+const SiteFile = "site.yaml"
+
+// PostsDir is the directory of the post files in the archive.
+const PostsDir = "posts/"
+
+// FrontMatter is the YAML front matter of an exported post.
+type FrontMatter struct {
+	Title     string    `yaml:"title"`
+	Slug      string    `yaml:"slug"`
+	Canonical string    `yaml:"canonical,omitempty"`
+	Timestamp time.Time `yaml:"timestamp"`
+	Lang      string    `yaml:"lang,omitempty"`
+	Author    string    `yaml:"author,omitempty"`
+	Tags      []string  `yaml:"tags,omitempty"`
+	Page      bool      `yaml:"page"`
+	Published bool      `yaml:"published"`
+}
+
+// NewFrontMatter returns the front matter of post.
+func NewFrontMatter(post model.Post) FrontMatter {
+	fm := FrontMatter{
+		Title:     post.Title,
+		Slug:      post.URL,
+		Canonical: post.Canonical,
+		Timestamp: post.Timestamp,
+		Lang:      post.Lang,
+		Author:    post.Author,
+		Page:      post.Page,
+		Published: post.Published,
+	}
+	for _, t := range post.Tags {
+		fm.Tags = append(fm.Tags, t.Name)
+	}
+	return fm
+}
+
+// Markdown returns the Markdown file of post, with YAML front matter.
+func Markdown(post model.Post) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(NewFrontMatter(post)); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("---\n")
+	buf.WriteString(post.Content)
+	if !strings.HasSuffix(post.Content, "\n") {
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// SiteSettings are the public settings of a site in SiteFile. Only the
+// fields listed here are exported, so the credentials and other state added to
+// model.Site are left out unless they are added here too.
+//
+// The keys are the same as the ones used in the storage.
+type SiteSettings struct {
+	Title             string    `yaml:"title"`
+	Subtitle          string    `yaml:"subtitle"`
+	Author            string    `yaml:"author"`
+	FediCreator       string    `yaml:"fedicreator"`
+	Favicon           string    `yaml:"favicon"`
+	Description       string    `yaml:"description"`
+	Scheme            string    `yaml:"scheme"`
+	URL               string    `yaml:"url"`
+	HomeURL           string    `yaml:"homeurl"`
+	LoginURL          string    `yaml:"loginurl"`
+	GoogleAnalyticsID string    `yaml:"googleanalytics"`
+	DisqusID          string    `yaml:"disqus"`
+	CactusSiteName    string    `yaml:"cactus"`
+	Created           time.Time `yaml:"created"`
+	Updated           time.Time `yaml:"updated"`
+	Content           string    `yaml:"content"`
+	Styles            string    `yaml:"styles"`
+	StylesAppend      bool      `yaml:"stylesappend"`
+	StackEdit         bool      `yaml:"stackedit"`
+	Prism             bool      `yaml:"prism"`
+	ISODate           bool      `yaml:"isodate"`
+	Lang              string    `yaml:"lang"`
+
+	BridgyFedDomain  string `yaml:"bridgyFedDomain"`
+	BridgyFedWeb     string `yaml:"bridgyFedWeb"`
+	WebmentionDomain string `yaml:"webmentionDomain,omitempty"`
+	IndieLoginURI    string `yaml:"indieLoginURI,omitempty"`
+
+	Footer    *string           `yaml:"footer"`
+	Redirects map[string]string `yaml:"redirects,omitempty"`
+}
+
+// NewSiteSettings returns the public settings of site.
+func NewSiteSettings(site *model.Site) SiteSettings {
+	return SiteSettings{
+		Title:             site.Title,
+		Subtitle:          site.Subtitle,
+		Author:            site.Author,
+		FediCreator:       site.FediCreator,
+		Favicon:           site.Favicon,
+		Description:       site.Description,
+		Scheme:            site.Scheme,
+		URL:               site.URL,
+		HomeURL:           site.HomeURL,
+		LoginURL:          site.LoginURL,
+		GoogleAnalyticsID: site.GoogleAnalyticsID,
+		DisqusID:          site.DisqusID,
+		CactusSiteName:    site.CactusSiteName,
+		Created:           site.Created,
+		Updated:           site.Updated,
+		Content:           site.Content,
+		Styles:            site.Styles,
+		StylesAppend:      site.StylesAppend,
+		StackEdit:         site.StackEdit,
+		Prism:             site.Prism,
+		ISODate:           site.ISODate,
+		Lang:              site.Lang,
+		BridgyFedDomain:   site.BridgyFedDomain,
+		BridgyFedWeb:      site.BridgyFedWeb,
+		WebmentionDomain:  site.WebmentionDomain,
+		IndieLoginURI:     site.IndieLoginURI,
+		Footer:            site.Footer,
+		Redirects:         site.Redirects,
+	}
+}
+
+// SiteYAML returns the public settings of site as YAML, see SiteSettings.
+func SiteYAML(site *model.Site) ([]byte, error) {
+	return yaml.Marshal(NewSiteSettings(site))
+}
+
+// Zip writes site and all its posts into w as a zip archive, with SiteFile
+// for the site settings and one Markdown file per post under PostsDir.
+//
+// The post files are named after their slugs, or their ids if the slug cannot
+// be used as a file name.
+func Zip(ctx context.Context, w io.Writer, site *model.Site) error {
+	zw := zip.NewWriter(w)
+
+	b, err := SiteYAML(site)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(zw, SiteFile, site.Updated, b); err != nil {
+		return err
+	}
+
+	posts := site.PostsAndPages(false)
+	// Sort by creation to have stable file names on slug collisions.
+	slices.SortStableFunc(posts, func(a, b model.PostWithID) int {
+		return a.Created.Compare(b.Created)
+	})
+	names := make(map[string]bool, len(posts))
+	for _, p := range posts {
+		post, ok, err := site.PostByID(ctx, p.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		name := post.URL
+		if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") || names[name] {
+			name = p.ID
+		}
+		names[name] = true
+
+		b, err := Markdown(post)
+		if err != nil {
+			return fmt.Errorf("failed to export post %q: %w", p.ID, err)
+		}
+		if err := writeFile(zw, PostsDir+name+".md", post.Updated, b); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeFile(zw *zip.Writer, name string, modified time.Time, b []byte) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	return err
+}
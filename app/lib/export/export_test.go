@@ -0,0 +1,177 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"go.yhsif.com/pandablog/app/lib/export"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+func TestMarkdown(t *testing.T) {
+	post := model.Post{
+		Title:     "Foo: bar",
+		URL:       "foo",
+		Timestamp: time.Date(2024, 5, 26, 0, 0, 0, 0, time.UTC),
+		Content:   "# Hello",
+		Published: true,
+		Tags:      model.TagList{{Name: "a"}, {Name: "b"}},
+	}
+	b, err := export.Markdown(post)
+	if err != nil {
+		t.Fatalf("Markdown failed: %v", err)
+	}
+	const want = `---
+title: 'Foo: bar'
+slug: foo
+timestamp: 2024-05-26T00:00:00Z
+tags:
+  - a
+  - b
+page: false
+published: true
+---
+# Hello
+`
+	if got := string(b); got != want {
+		t.Errorf("Markdown got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestZip(t *testing.T) {
+	site := &model.Site{
+		Title: "site",
+		Posts: map[string]model.Post{
+			"1": {URL: "foo", Content: "1", Created: time.Unix(1, 0)},
+			"2": {URL: "foo", Content: "2", Created: time.Unix(2, 0)},
+			"3": {URL: "../bar", Content: "3"},
+		},
+		Users: map[string]model.User{
+			"alice": {PasswordHash: "secret", Role: model.RoleAuthor},
+		},
+	}
+	var buf bytes.Buffer
+	if err := export.Zip(context.Background(), &buf, site); err != nil {
+		t.Fatalf("Zip failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %q: %v", f.Name, err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %q: %v", f.Name, err)
+		}
+		files[f.Name] = string(b)
+	}
+	for _, name := range []string{"site.yaml", "posts/foo.md", "posts/2.md", "posts/3.md"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("%q not in zip, got %d files", name, len(files))
+		}
+	}
+	if strings.Contains(files["site.yaml"], "secret") {
+		t.Errorf("site.yaml contains the password hash:\n%s", files["site.yaml"])
+	}
+	if got, want := files["posts/2.md"][len(files["posts/2.md"])-2:], "2\n"; got != want {
+		t.Errorf("posts/2.md ends with %q want %q", got, want)
+	}
+}
+
+func TestSiteYAML(t *testing.T) {
+	const secret = "secret"
+	footer := "footer"
+	site := &model.Site{
+		SchemaVersion:     1,
+		Title:             "title",
+		Subtitle:          "subtitle",
+		Author:            "author",
+		FediCreator:       "@a@example.com",
+		Favicon:           "🐼",
+		Description:       "description",
+		Scheme:            "https",
+		URL:               "example.com",
+		HomeURL:           "/",
+		LoginURL:          "/login",
+		GoogleAnalyticsID: "G-1",
+		DisqusID:          "disqus",
+		CactusSiteName:    "cactus",
+		Created:           time.Unix(1, 0),
+		Updated:           time.Unix(2, 0),
+		Content:           "home",
+		Styles:            "body {}",
+		StylesAppend:      true,
+		StackEdit:         true,
+		Prism:             true,
+		ISODate:           true,
+		Lang:              "en",
+		BridgyFedDomain:   "fed.brid.gy",
+		BridgyFedWeb:      "web.brid.gy",
+		WebmentionDomain:  "webmention.io",
+		IndieLoginURI:     "https://indielogin.com/auth",
+		Footer:            &footer,
+		Redirects:         map[string]string{"/old": "1"},
+		Media:             map[string]model.Media{"a.png": {Object: "media/a.png"}},
+		SessionGeneration: 42,
+		Users: map[string]model.User{
+			"alice": {PasswordHash: secret, Role: model.RoleAuthor},
+		},
+		Passkeys: map[string]model.Passkey{
+			"id": {Username: "alice", PublicKey: []byte(secret)},
+		},
+		MFA: map[string]model.MFA{
+			"alice": {Key: secret, RecoveryCodes: []string{secret}},
+		},
+		Owner: model.OwnerCredentials{
+			PasswordHash:    secret,
+			EnvPasswordHash: secret,
+			EnvMFAKey:       secret,
+		},
+		Tokens: map[string]model.Token{
+			secret: {Username: "alice", Name: "token"},
+		},
+		Posts: map[string]model.Post{
+			"1": {URL: "foo", Content: secret},
+		},
+	}
+
+	b, err := export.SiteYAML(site)
+	if err != nil {
+		t.Fatalf("SiteYAML failed: %v", err)
+	}
+	got := string(b)
+	for _, s := range []string{
+		secret,
+		base64.StdEncoding.EncodeToString([]byte(secret)),
+		"users:",
+		"passkeys:",
+		"mfa:",
+		"owner:",
+		"tokens:",
+		"posts:",
+		"sessionGeneration",
+		"schemaVersion",
+	} {
+		if strings.Contains(got, s) {
+			t.Errorf("SiteYAML contains %q:\n%s", s, got)
+		}
+	}
+	for _, s := range []string{"title: title", "disqus: disqus", "footer: footer", "/old: \"1\""} {
+		if !strings.Contains(got, s) {
+			t.Errorf("SiteYAML does not contain %q:\n%s", s, got)
+		}
+	}
+}
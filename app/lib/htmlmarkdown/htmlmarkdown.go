@@ -0,0 +1,307 @@
+// Package htmlmarkdown converts HTML, for example the contents of posts from
+// other blogs, to Markdown.
+package htmlmarkdown
+
+import (
+	"bytes"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	blankLines = regexp.MustCompile(`\n[ \t]*\n(?:[ \t]*\n)+`)
+	lineStart  = regexp.MustCompile(`(?m)^([ \t]*)([#>])`)
+	spaces     = regexp.MustCompile(`[ \t\r\n]+`)
+)
+
+var escaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	`*`, `\*`,
+	`_`, `\_`,
+	`[`, `\[`,
+	`]`, `\]`,
+	`<`, `\<`,
+)
+
+// Convert converts an HTML fragment to Markdown.
+//
+// Common formatting, links, images, lists, quotes, code blocks and tables are
+// converted. Embedded media like iframes and videos are kept as HTML, while
+// scripts, styles and comments are dropped. Line breaks in text are kept, so
+// content without paragraph tags, like WordPress posts, keeps its paragraphs.
+func Convert(s string) (string, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(s), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, n := range nodes {
+		sb.WriteString(convert(n))
+	}
+	md := blankLines.ReplaceAllString(sb.String(), "\n\n")
+	return strings.TrimSpace(md), nil
+}
+
+func convert(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return lineStart.ReplaceAllString(escaper.Replace(n.Data), `$1\$2`)
+	case html.ElementNode:
+	default:
+		return children(n)
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Noscript, atom.Template:
+		return ""
+
+	case atom.Iframe, atom.Video, atom.Audio, atom.Embed, atom.Object:
+		var buf bytes.Buffer
+		html.Render(&buf, n)
+		return block(buf.String())
+
+	case atom.P, atom.Div, atom.Figure, atom.Section, atom.Article, atom.Header, atom.Footer:
+		return block(children(n))
+
+	case atom.Br:
+		return "\\\n"
+
+	case atom.Hr:
+		return block("---")
+
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		return block(strings.Repeat("#", level) + " " + inline(children(n)))
+
+	case atom.Strong, atom.B:
+		return wrap(children(n), "**")
+
+	case atom.Em, atom.I:
+		return wrap(children(n), "*")
+
+	case atom.Del, atom.S, atom.Strike:
+		return wrap(children(n), "~~")
+
+	case atom.Code, atom.Kbd, atom.Tt:
+		return code(text(n))
+
+	case atom.Pre:
+		return block("```" + language(n) + "\n" + strings.Trim(text(n), "\n") + "\n```")
+
+	case atom.A:
+		content := children(n)
+		href := attr(n, "href")
+		if href == "" || strings.TrimSpace(content) == "" {
+			return content
+		}
+		return "[" + inline(content) + "](" + link(href) + ")"
+
+	case atom.Img:
+		src := attr(n, "src")
+		if src == "" {
+			return ""
+		}
+		return "![" + inline(escaper.Replace(attr(n, "alt"))) + "](" + link(src) + ")"
+
+	case atom.Blockquote:
+		content := strings.TrimSpace(blankLines.ReplaceAllString(children(n), "\n\n"))
+		lines := strings.Split(content, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		return block(strings.Join(lines, "\n"))
+
+	case atom.Ul, atom.Ol:
+		return block(list(n))
+
+	case atom.Table:
+		return block(table(n))
+
+	default:
+		return children(n)
+	}
+}
+
+func children(n *html.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(convert(c))
+	}
+	return sb.String()
+}
+
+// text returns the raw text inside n.
+func text(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.DataAtom == atom.Br {
+			sb.WriteString("\n")
+			continue
+		}
+		sb.WriteString(text(c))
+	}
+	return sb.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+func block(s string) string {
+	return "\n\n" + strings.Trim(s, "\n") + "\n\n"
+}
+
+// inline makes s fit on a single line.
+func inline(s string) string {
+	s = strings.ReplaceAll(s, "\\\n", " ")
+	return strings.TrimSpace(spaces.ReplaceAllString(s, " "))
+}
+
+// wrap wraps s in the emphasis delimiter, keeping surrounding spaces outside
+// of the delimiters.
+func wrap(s, delim string) string {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return s
+	}
+	start := strings.Index(s, trimmed)
+	return s[:start] + delim + trimmed + delim + s[start+len(trimmed):]
+}
+
+func code(s string) string {
+	s = inline(s)
+	if s == "" {
+		return ""
+	}
+	delim := "`"
+	for strings.Contains(s, delim) {
+		delim += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return delim + s + delim
+}
+
+// language returns the language of a pre block from the class of the code
+// element inside it, for example "language-go".
+func language(n *html.Node) string {
+	for _, node := range []*html.Node{n, n.FirstChild} {
+		if node == nil || node.Type != html.ElementNode {
+			continue
+		}
+		for class := range strings.FieldsSeq(attr(node, "class")) {
+			if lang, ok := strings.CutPrefix(class, "language-"); ok {
+				return lang
+			}
+			if lang, ok := strings.CutPrefix(class, "lang-"); ok {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+func link(url string) string {
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(url)
+}
+
+func list(n *html.Node) string {
+	ordered := n.DataAtom == atom.Ol
+	index := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil && ordered {
+		index = start
+	}
+
+	var items []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if ordered {
+			marker = strconv.Itoa(index) + ". "
+			index++
+		}
+		content := strings.TrimSpace(blankLines.ReplaceAllString(children(c), "\n\n"))
+		indent := strings.Repeat(" ", len(marker))
+		lines := strings.Split(content, "\n")
+		for i, line := range lines {
+			switch {
+			case i == 0:
+				lines[i] = marker + line
+			case line != "":
+				lines[i] = indent + line
+			}
+		}
+		items = append(items, strings.Join(lines, "\n"))
+	}
+	return strings.Join(items, "\n")
+}
+
+func table(n *html.Node) string {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if c.DataAtom != atom.Tr {
+				walk(c)
+				continue
+			}
+			var row []string
+			for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+					row = append(row, strings.ReplaceAll(inline(children(cell)), "|", `\|`))
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	var columns int
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	var sb strings.Builder
+	writeRow := func(row []string) {
+		for i := range columns {
+			var cell string
+			if i < len(row) {
+				cell = row[i]
+			}
+			sb.WriteString("| " + cell + " ")
+		}
+		sb.WriteString("|\n")
+	}
+	writeRow(rows[0])
+	writeRow(slices.Repeat([]string{"---"}, columns))
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+	return sb.String()
+}
@@ -0,0 +1,81 @@
+package htmlmarkdown_test
+
+import (
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/htmlmarkdown"
+)
+
+func TestConvert(t *testing.T) {
+	for _, c := range []struct {
+		label string
+		html  string
+		want  string
+	}{
+		{
+			label: "wpautop",
+			html:  "First line\nsecond line\n\nSecond <strong>paragraph</strong>.",
+			want:  "First line\nsecond line\n\nSecond **paragraph**.",
+		},
+		{
+			label: "paragraphs",
+			html:  "<!-- wp:paragraph -->\n<p>Hello <em>world</em><br>again</p>\n<!-- /wp:paragraph -->\n\n<p>Bye</p>",
+			want:  "Hello *world*\\\nagain\n\nBye",
+		},
+		{
+			label: "escape",
+			html:  "<p># not a heading, 2*3 and a_b [x]</p>",
+			want:  `\# not a heading, 2\*3 and a\_b \[x\]`,
+		},
+		{
+			label: "heading",
+			html:  "<h2>Some\n<a href=\"/x\">title</a></h2><p>text</p>",
+			want:  "## Some [title](/x)\n\ntext",
+		},
+		{
+			label: "link and image",
+			html:  `<a href="https://example.com/a (b)"><img src="/i.png" alt="An image"></a>`,
+			want:  "[![An image](/i.png)](https://example.com/a%20%28b%29)",
+		},
+		{
+			label: "emphasis spaces",
+			html:  "a<b> bold </b>b",
+			want:  "a **bold** b",
+		},
+		{
+			label: "code",
+			html:  "<p>Run <code>go test ./...</code></p><pre><code class=\"language-go\">func main() {\n\tfmt.Println(\"*\")\n}\n</code></pre>",
+			want:  "Run `go test ./...`\n\n```go\nfunc main() {\n\tfmt.Println(\"*\")\n}\n```",
+		},
+		{
+			label: "lists",
+			html:  "<ul><li>one</li><li>two<ol start=\"3\"><li>three</li><li>four</li></ol></li></ul>",
+			want:  "- one\n- two\n\n  3. three\n  4. four",
+		},
+		{
+			label: "blockquote",
+			html:  "<blockquote><p>quoted</p><p>twice</p></blockquote>",
+			want:  "> quoted\n>\n> twice",
+		},
+		{
+			label: "table",
+			html:  "<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>x|y</td></tr></table>",
+			want:  "| a | b |\n| --- | --- |\n| 1 | x\\|y |",
+		},
+		{
+			label: "embed and script",
+			html:  `<script>alert(1)</script><iframe src="https://example.com/embed"></iframe>`,
+			want:  `<iframe src="https://example.com/embed"></iframe>`,
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			got, err := htmlmarkdown.Convert(c.html)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Errorf("Convert(%q) got %q want %q", c.html, got, c.want)
+			}
+		})
+	}
+}
@@ -8,10 +8,14 @@ import (
 )
 
 // New returns a HTML template engine.
-func New(manager *html.TemplateManager, allowUnsafeHTML bool) *Engine {
+//
+// media looks up the uploaded media by name, to render responsive images in
+// RenderMarkdown. It can be nil.
+func New(manager *html.TemplateManager, allowUnsafeHTML bool, media func(name string) (model.Media, bool)) *Engine {
 	return &Engine{
 		allowUnsafeHTML: allowUnsafeHTML,
 		manager:         manager,
+		media:           media,
 	}
 }
 
@@ -19,6 +23,7 @@ func New(manager *html.TemplateManager, allowUnsafeHTML bool) *Engine {
 type Engine struct {
 	allowUnsafeHTML bool
 	manager         *html.TemplateManager
+	media           func(name string) (model.Media, bool)
 }
 
 // Template renders HTML to a response writer and returns a 200 status code and
@@ -28,11 +33,11 @@ func (te *Engine) Template(w http.ResponseWriter, r *http.Request, mainTemplate
 	return te.partialTemplate(w, r, mainTemplate, partialTemplate, http.StatusOK, vars)
 }
 
-// ErrorTemplate renders HTML to a response writer and returns a 404 status code
-// and an error if one occurs.
-func (te *Engine) ErrorTemplate(w http.ResponseWriter, r *http.Request, mainTemplate string,
+// ErrorTemplate renders HTML to a response writer and returns the given status
+// code and an error if one occurs.
+func (te *Engine) ErrorTemplate(w http.ResponseWriter, r *http.Request, statusCode int, mainTemplate string,
 	partialTemplate string, vars map[string]any) (status int, err error) {
-	return te.partialTemplate(w, r, mainTemplate, partialTemplate, http.StatusNotFound, vars)
+	return te.partialTemplate(w, r, mainTemplate, partialTemplate, statusCode, vars)
 }
 
 // partialTemplate converts content from markdown to HTML and then outputs to
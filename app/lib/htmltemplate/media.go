@@ -0,0 +1,86 @@
+package htmltemplate
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// mediaSizes is the sizes attribute of images with variants, matching the
+// max-width of the content in the default styles.
+const mediaSizes = "(max-width: 720px) 100vw, 720px"
+
+// responsiveImages adds the srcset, width, height and loading attributes to
+// the img tags of uploaded images in htmlCode.
+func (te *Engine) responsiveImages(htmlCode []byte) []byte {
+	if te.media == nil || !bytes.Contains(htmlCode, []byte("/media/")) {
+		return htmlCode
+	}
+
+	var buf bytes.Buffer
+	z := html.NewTokenizer(bytes.NewReader(htmlCode))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// Either io.EOF or the rest is not parsable, keep it as is.
+			buf.Write(z.Raw())
+			return buf.Bytes()
+		}
+		// Token unescapes the raw bytes in place.
+		raw := slices.Clone(z.Raw())
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			buf.Write(raw)
+			continue
+		}
+		token := z.Token()
+		if token.Data != "img" || !te.addImageAttrs(&token) {
+			buf.Write(raw)
+			continue
+		}
+		buf.WriteString(token.String())
+	}
+}
+
+// addImageAttrs adds the attributes to token if it's an uploaded image, and
+// reports whether it did.
+func (te *Engine) addImageAttrs(token *html.Token) bool {
+	var name string
+	has := make(map[string]bool, len(token.Attr))
+	for _, attr := range token.Attr {
+		has[attr.Key] = true
+		if attr.Key == "src" {
+			name, _ = strings.CutPrefix(attr.Val, "/media/")
+			if name == attr.Val {
+				return false
+			}
+		}
+	}
+	if name == "" {
+		return false
+	}
+	media, ok := te.media(name)
+	if !ok || !media.IsImage() {
+		return false
+	}
+
+	add := func(key, val string) {
+		if !has[key] && val != "" {
+			token.Attr = append(token.Attr, html.Attribute{Key: key, Val: val})
+		}
+	}
+	if media.Width > 0 && media.Height > 0 && !has["width"] && !has["height"] {
+		add("width", strconv.Itoa(media.Width))
+		add("height", strconv.Itoa(media.Height))
+	}
+	if srcset := (model.MediaWithName{Media: media, Name: name}).SrcSet(); srcset != "" {
+		add("srcset", srcset)
+		add("sizes", mediaSizes)
+	}
+	add("loading", "lazy")
+	return true
+}
@@ -0,0 +1,89 @@
+package htmltemplate_test
+
+import (
+	"strings"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/htmltemplate"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+func TestRenderMarkdownImages(t *testing.T) {
+	media := map[string]model.Media{
+		"photo.jpg": {
+			ContentType: "image/jpeg",
+			Width:       1000,
+			Height:      500,
+			Variants: []model.MediaVariant{
+				{Object: "media/a-480", Width: 480, Height: 240},
+				{Object: "media/a-960", Width: 960, Height: 480},
+			},
+		},
+		"icon.svg": {
+			ContentType: "image/svg+xml",
+		},
+		"doc.pdf": {
+			ContentType: "application/pdf",
+		},
+	}
+	te := htmltemplate.New(nil, false, func(name string) (model.Media, bool) {
+		m, ok := media[name]
+		return m, ok
+	})
+
+	for _, c := range []struct {
+		label    string
+		markdown string
+		want     []string
+		notWant  []string
+	}{
+		{
+			label:    "variants",
+			markdown: "![a photo](/media/photo.jpg)",
+			want: []string{
+				`src="/media/photo.jpg"`,
+				`alt="a photo"`,
+				`width="1000"`,
+				`height="500"`,
+				`srcset="/media/photo.jpg?w=480 480w, /media/photo.jpg?w=960 960w, /media/photo.jpg 1000w"`,
+				`sizes="`,
+				`loading="lazy"`,
+			},
+		},
+		{
+			label:    "no-size",
+			markdown: "![](/media/icon.svg)",
+			want:     []string{`loading="lazy"`},
+			notWant:  []string{"width=", "srcset="},
+		},
+		{
+			label:    "not-image",
+			markdown: "![](/media/doc.pdf)",
+			notWant:  []string{"loading="},
+		},
+		{
+			label:    "unknown",
+			markdown: "![](/media/other.jpg) and ![](https://example.com/media/photo.jpg)",
+			notWant:  []string{"loading="},
+		},
+		{
+			label:    "text",
+			markdown: "Just /media/photo.jpg & <b>text</b>",
+			want:     []string{"Just /media/photo.jpg &amp; <b>text</b>"},
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			got := string(te.RenderMarkdown(c.markdown))
+			for _, s := range c.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("RenderMarkdown(%q) = %q, want %q in it", c.markdown, got, s)
+				}
+			}
+			for _, s := range c.notWant {
+				if strings.Contains(got, s) {
+					t.Errorf("RenderMarkdown(%q) = %q, don't want %q in it", c.markdown, got, s)
+				}
+			}
+		})
+	}
+}
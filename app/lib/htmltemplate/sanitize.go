@@ -10,6 +10,8 @@ import (
 )
 
 // RenderMarkdown renders markdown to html
+//
+// Uploaded images get the srcset, width, height and loading attributes.
 func (te *Engine) RenderMarkdown(markdown string) template.HTML {
 	// Ensure unit line endings are used when pulling out of JSON.
 	markdownWithUnixLineEndings := strings.ReplaceAll(markdown, "\r\n", "\n")
@@ -19,6 +21,7 @@ func (te *Engine) RenderMarkdown(markdown string) template.HTML {
 	if !te.allowUnsafeHTML {
 		htmlCode = bluemonday.UGCPolicy().SanitizeBytes(htmlCode)
 	}
+	htmlCode = te.responsiveImages(htmlCode)
 	return template.HTML(htmlCode)
 }
 
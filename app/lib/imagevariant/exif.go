@@ -0,0 +1,205 @@
+package imagevariant
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	tagOrientation = 0x0112
+	tagGPSInfo     = 0x8825
+)
+
+// exifHeader is the start of the APP1 segment with EXIF data in JPEG files.
+var exifHeader = []byte("Exif\x00\x00")
+
+// typeSizes are the sizes of the TIFF field types, by type.
+var typeSizes = map[uint16]uint32{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	6:  1, // SBYTE
+	7:  1, // UNDEFINED
+	8:  2, // SSHORT
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+	11: 4, // FLOAT
+	12: 8, // DOUBLE
+}
+
+// jpegExif returns the TIFF data of the EXIF segment in the JPEG file b, which
+// shares the underlying array of b, or nil if there is none.
+func jpegExif(b []byte) []byte {
+	if len(b) < 2 || b[0] != 0xff || b[1] != 0xd8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xff {
+			return nil
+		}
+		marker := b[i+1]
+		if marker == 0xd8 || (marker >= 0xd0 && marker <= 0xd7) || marker == 0x01 || marker == 0xff {
+			// Markers without a length.
+			i += 2
+			continue
+		}
+		if marker == 0xda {
+			// Start of scan, there are no more metadata segments.
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(b[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(b) {
+			return nil
+		}
+		if segment := b[i+4 : end]; marker == 0xe1 && bytes.HasPrefix(segment, exifHeader) {
+			return segment[len(exifHeader):]
+		}
+		i = end
+	}
+	return nil
+}
+
+// tiff is the TIFF structure EXIF data is stored in.
+type tiff struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+// ifdEntry is an entry of an image file directory.
+type ifdEntry struct {
+	// offset is the offset of the entry itself.
+	offset uint32
+	tag    uint16
+	typ    uint16
+	count  uint32
+}
+
+func parseTIFF(b []byte) (t tiff, ifd0 uint32, ok bool) {
+	if len(b) < 8 {
+		return t, 0, false
+	}
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return t, 0, false
+	}
+	if t.order.Uint16(b[2:]) != 42 {
+		return t, 0, false
+	}
+	t.b = b
+	return t, t.order.Uint32(b[4:]), true
+}
+
+// entries returns the entries of the image file directory at offset.
+func (t tiff) entries(offset uint32) []ifdEntry {
+	if uint64(offset)+2 > uint64(len(t.b)) {
+		return nil
+	}
+	n := uint32(t.order.Uint16(t.b[offset:]))
+	if uint64(offset)+2+uint64(n)*12 > uint64(len(t.b)) {
+		return nil
+	}
+	entries := make([]ifdEntry, 0, n)
+	for i := range n {
+		e := offset + 2 + i*12
+		entries = append(entries, ifdEntry{
+			offset: e,
+			tag:    t.order.Uint16(t.b[e:]),
+			typ:    t.order.Uint16(t.b[e+2:]),
+			count:  t.order.Uint32(t.b[e+4:]),
+		})
+	}
+	return entries
+}
+
+// value returns the value of e, or nil if it's out of bounds.
+func (t tiff) value(e ifdEntry) []byte {
+	size := uint64(typeSizes[e.typ]) * uint64(e.count)
+	offset := uint64(e.offset) + 8
+	if size > 4 {
+		offset = uint64(t.order.Uint32(t.b[e.offset+8:]))
+	}
+	if offset+size > uint64(len(t.b)) {
+		return nil
+	}
+	return t.b[offset : offset+size]
+}
+
+// orientation returns the EXIF orientation of the JPEG file b, 1 to 8, with 1
+// being the default of no transformation.
+func orientation(b []byte) int {
+	t, ifd0, ok := parseTIFF(jpegExif(b))
+	if !ok {
+		return 1
+	}
+	for _, e := range t.entries(ifd0) {
+		if e.tag != tagOrientation || e.typ != 3 || e.count != 1 {
+			continue
+		}
+		if o := int(t.order.Uint16(t.value(e))); o >= 1 && o <= 8 {
+			return o
+		}
+	}
+	return 1
+}
+
+// stripJPEGGPS removes the EXIF GPS data from the JPEG file b in place, by
+// emptying the GPS directory and zeroing its values, so the rest of the
+// metadata like the orientation is kept and the image is not re-encoded.
+func stripJPEGGPS(b []byte) {
+	t, ifd0, ok := parseTIFF(jpegExif(b))
+	if !ok {
+		return
+	}
+	for _, e := range t.entries(ifd0) {
+		if e.tag != tagGPSInfo {
+			continue
+		}
+		v := t.value(e)
+		if len(v) != 4 {
+			continue
+		}
+		gps := t.order.Uint32(v)
+		entries := t.entries(gps)
+		if entries == nil {
+			continue
+		}
+		for _, entry := range entries {
+			clear(t.value(entry))
+		}
+		clear(t.b[gps+2 : gps+2+uint32(len(entries))*12])
+		t.order.PutUint16(t.b[gps:], 0)
+	}
+}
+
+// stripPNGExif returns the PNG file b without its eXIf chunk, which could
+// contain GPS data.
+func stripPNGExif(b []byte) []byte {
+	const signatureSize = 8
+	if len(b) < signatureSize {
+		return b
+	}
+	out := make([]byte, 0, len(b))
+	out = append(out, b[:signatureSize]...)
+	for i := signatureSize; i < len(b); {
+		if i+8 > len(b) {
+			return b
+		}
+		length := uint64(binary.BigEndian.Uint32(b[i:]))
+		end := uint64(i) + 12 + length
+		if end > uint64(len(b)) {
+			return b
+		}
+		if string(b[i+4:i+8]) != "eXIf" {
+			out = append(out, b[i:end]...)
+		}
+		i = int(end)
+	}
+	return out
+}
@@ -0,0 +1,179 @@
+// Package imagevariant generates resized variants of uploaded images, to be
+// used in responsive images.
+package imagevariant
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif" // For the sizes of GIF images.
+	"image/jpeg"
+	"image/png"
+	"math"
+	"slices"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // For the sizes of WebP images.
+)
+
+// Widths are the widths of the generated variants.
+var Widths = []int{480, 960, 1920}
+
+const (
+	// maxPixels is the maximum number of pixels of images to resize, to limit
+	// the memory used to decode them.
+	maxPixels = 50_000_000
+
+	jpegQuality = 85
+)
+
+// Variant is a resized variant of an image.
+type Variant struct {
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Image is an uploaded image.
+type Image struct {
+	// Width and Height are the size of the image as displayed, after its EXIF
+	// orientation is applied.
+	Width  int
+	Height int
+
+	// Variants are the resized variants of the image, narrowest first.
+	Variants []Variant
+}
+
+// StripGPS returns the JPEG or PNG file data without its EXIF GPS data.
+// Other files are returned as is.
+func StripGPS(contentType string, data []byte) []byte {
+	switch contentType {
+	case "image/jpeg":
+		data = slices.Clone(data)
+		stripJPEGGPS(data)
+	case "image/png":
+		data = stripPNGExif(data)
+	}
+	return data
+}
+
+// Resize returns the size of the image file data, and for JPEG and PNG files,
+// its variants at the Widths narrower than it, re-encoded in the same format
+// without any metadata.
+//
+// It returns a zero Image for files of other content types.
+func Resize(contentType string, data []byte) (Image, error) {
+	switch contentType {
+	default:
+		return Image{}, nil
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, err
+	}
+	o := 1
+	if format == "jpeg" {
+		o = orientation(data)
+	}
+	img := Image{
+		Width:  config.Width,
+		Height: config.Height,
+	}
+	if swapsSides(o) {
+		img.Width, img.Height = img.Height, img.Width
+	}
+	if (format != "jpeg" && format != "png") || config.Width*config.Height > maxPixels {
+		return img, nil
+	}
+
+	var widths []int
+	for _, w := range Widths {
+		if w < img.Width {
+			widths = append(widths, w)
+		}
+	}
+	if len(widths) == 0 {
+		return img, nil
+	}
+
+	var src image.Image
+	src, _, err = image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, err
+	}
+	// Resize from the widest, each from the previous one to save time.
+	for _, w := range slices.Backward(widths) {
+		h := max(1, int(math.Round(float64(img.Height)*float64(w)/float64(img.Width))))
+		dw, dh := w, h
+		if swapsSides(o) {
+			dw, dh = h, w
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+		src = dst
+
+		var buf bytes.Buffer
+		switch format {
+		case "jpeg":
+			err = jpeg.Encode(&buf, orient(dst, o), &jpeg.Options{Quality: jpegQuality})
+		case "png":
+			err = png.Encode(&buf, orient(dst, o))
+		}
+		if err != nil {
+			return Image{}, err
+		}
+		img.Variants = append(img.Variants, Variant{
+			Width:  w,
+			Height: h,
+			Data:   buf.Bytes(),
+		})
+	}
+	slices.Reverse(img.Variants)
+	return img, nil
+}
+
+// swapsSides reports whether the EXIF orientation o rotates the image by 90
+// degrees.
+func swapsSides(o int) bool {
+	return o >= 5
+}
+
+// orient applies the EXIF orientation o to src, as the encoded variants don't
+// keep the EXIF data.
+func orient(src *image.RGBA, o int) *image.RGBA {
+	if o == 1 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if swapsSides(o) {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		for x := range dw {
+			// The pixel of src at (sx, sy) goes to (x, y) in dst.
+			var sx, sy int
+			switch o {
+			case 2: // Mirrored horizontally.
+				sx, sy = w-1-x, y
+			case 3: // Rotated 180°.
+				sx, sy = w-1-x, h-1-y
+			case 4: // Mirrored vertically.
+				sx, sy = x, h-1-y
+			case 5: // Transposed.
+				sx, sy = y, x
+			case 6: // Rotated 90° clockwise.
+				sx, sy = y, h-1-x
+			case 7: // Transversed.
+				sx, sy = w-1-y, h-1-x
+			case 8: // Rotated 90° counterclockwise.
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
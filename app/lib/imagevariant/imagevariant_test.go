@@ -0,0 +1,184 @@
+package imagevariant_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/imagevariant"
+)
+
+// gpsMarker is the GPS latitude in the test EXIF data, to look for in the
+// stripped files.
+var gpsMarker = []byte{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0xba, 0xbe}
+
+// exifJPEG returns a w by h JPEG file with EXIF orientation o and GPS data.
+func exifJPEG(t *testing.T, w, h int, o uint16) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("Failed to encode jpeg: %v", err)
+	}
+
+	le := binary.LittleEndian
+	tiff := []byte("II*\x00")
+	tiff = le.AppendUint32(tiff, 8)
+	// IFD0 at 8: orientation and GPS pointer.
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = le.AppendUint16(tiff, 0x0112)
+	tiff = le.AppendUint16(tiff, 3)
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint16(tiff, o)
+	tiff = le.AppendUint16(tiff, 0)
+	tiff = le.AppendUint16(tiff, 0x8825)
+	tiff = le.AppendUint16(tiff, 4)
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint32(tiff, 38)
+	tiff = le.AppendUint32(tiff, 0)
+	// GPS IFD at 38: latitude as a rational at 56.
+	tiff = le.AppendUint16(tiff, 1)
+	tiff = le.AppendUint16(tiff, 0x0002)
+	tiff = le.AppendUint16(tiff, 5)
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint32(tiff, 56)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = append(tiff, gpsMarker...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xff, 0xe1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	b := buf.Bytes()
+	return append(append(append([]byte(nil), b[:2]...), app1...), b[2:]...)
+}
+
+func TestStripGPS(t *testing.T) {
+	orig := exifJPEG(t, 16, 8, 6)
+	if !bytes.Contains(orig, gpsMarker) {
+		t.Fatal("Test file doesn't contain GPS data")
+	}
+
+	stripped := imagevariant.StripGPS("image/jpeg", orig)
+	if bytes.Contains(stripped, gpsMarker) {
+		t.Error("StripGPS kept the GPS data")
+	}
+	if !bytes.Contains(orig, gpsMarker) {
+		t.Error("StripGPS modified its input")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("Stripped file failed to decode: %v", err)
+	}
+	// The orientation is kept.
+	img, err := imagevariant.Resize("image/jpeg", stripped)
+	if err != nil {
+		t.Fatalf("Resize failed: %v", err)
+	}
+	if img.Width != 8 || img.Height != 16 {
+		t.Errorf("Stripped file got size %dx%d want 8x16", img.Width, img.Height)
+	}
+
+	other := []byte("%PDF")
+	if got := imagevariant.StripGPS("application/pdf", other); !bytes.Equal(got, other) {
+		t.Errorf("StripGPS changed non-image file to %q", got)
+	}
+}
+
+func TestResize(t *testing.T) {
+	for _, c := range []struct {
+		label       string
+		contentType string
+		data        func(t *testing.T) []byte
+		width       int
+		height      int
+		variants    []image.Point
+	}{
+		{
+			label:       "jpeg",
+			contentType: "image/jpeg",
+			data: func(t *testing.T) []byte {
+				return exifJPEG(t, 1000, 500, 1)
+			},
+			width:    1000,
+			height:   500,
+			variants: []image.Point{{480, 240}, {960, 480}},
+		},
+		{
+			label:       "jpeg-rotated",
+			contentType: "image/jpeg",
+			data: func(t *testing.T) []byte {
+				return exifJPEG(t, 1000, 500, 6)
+			},
+			width:    500,
+			height:   1000,
+			variants: []image.Point{{480, 960}},
+		},
+		{
+			label:       "png",
+			contentType: "image/png",
+			data: func(t *testing.T) []byte {
+				var buf bytes.Buffer
+				if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 600, 300))); err != nil {
+					t.Fatalf("Failed to encode png: %v", err)
+				}
+				return buf.Bytes()
+			},
+			width:    600,
+			height:   300,
+			variants: []image.Point{{480, 240}},
+		},
+		{
+			label:       "small",
+			contentType: "image/jpeg",
+			data: func(t *testing.T) []byte {
+				return exifJPEG(t, 100, 50, 1)
+			},
+			width:  100,
+			height: 50,
+		},
+		{
+			label:       "pdf",
+			contentType: "application/pdf",
+			data: func(*testing.T) []byte {
+				return []byte("%PDF")
+			},
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			img, err := imagevariant.Resize(c.contentType, c.data(t))
+			if err != nil {
+				t.Fatalf("Resize failed: %v", err)
+			}
+			if img.Width != c.width || img.Height != c.height {
+				t.Errorf("Got size %dx%d want %dx%d", img.Width, img.Height, c.width, c.height)
+			}
+			if len(img.Variants) != len(c.variants) {
+				t.Fatalf("Got %d variants want %d", len(img.Variants), len(c.variants))
+			}
+			for i, v := range img.Variants {
+				want := c.variants[i]
+				if v.Width != want.X || v.Height != want.Y {
+					t.Errorf("Variant %d got size %dx%d want %v", i, v.Width, v.Height, want)
+				}
+				config, format, err := image.DecodeConfig(bytes.NewReader(v.Data))
+				if err != nil {
+					t.Fatalf("Variant %d failed to decode: %v", i, err)
+				}
+				if config.Width != want.X || config.Height != want.Y || "image/"+format != c.contentType {
+					t.Errorf("Variant %d decoded as %s %dx%d want %s %v", i, format, config.Width, config.Height, c.contentType, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Package importer imports posts from other blogs into a site.
+package importer
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"go.yhsif.com/pandablog/app/lib/account"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// Post is a post parsed from a file to import.
+type Post struct {
+	// Source is the name of the file, or another identifier of the post in the
+	// source.
+	Source string
+	Post   model.Post
+	// Redirects are the old paths of the post, for example "/2006/01/02/slug"
+	// or "/?p=123", to redirect to the imported post.
+	Redirects []string
+	// Err is set when the post failed to parse.
+	Err error
+}
+
+// Result is the result of importing a single post.
+type Result struct {
+	Source string
+	ID     string
+	Title  string
+	Slug   string
+	// Err is set when the post is skipped.
+	Err error
+}
+
+// Report is the result of an import.
+type Report struct {
+	DryRun  bool
+	Results []Result
+}
+
+// Imported returns the number of posts imported, or would be imported in dry
+// run mode.
+func (r Report) Imported() int {
+	var n int
+	for _, result := range r.Results {
+		if result.Err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Skipped returns the number of posts skipped.
+func (r Report) Skipped() int {
+	return len(r.Results) - r.Imported()
+}
+
+// Import adds posts to site via Site.UpdatePost, and their Redirects via
+// Site.AddRedirect unless they are the same as the new paths.
+//
+// Posts with parse errors, empty slugs, or slugs colliding with existing posts
+// or earlier posts in the same import are skipped. With dryRun site is not
+// modified, but the report is still the same.
+//
+// The authors of the posts are only kept if they are the usernames of the users
+// of site, as other blogs use display names.
+func Import(site *model.Site, posts []Post, dryRun bool) Report {
+	slugs := make(map[string]string)
+	for _, p := range site.PostsAndPages(false) {
+		slugs[p.URL] = "existing post " + fmt.Sprintf("%q", p.Title)
+	}
+
+	report := Report{
+		DryRun:  dryRun,
+		Results: make([]Result, 0, len(posts)),
+	}
+	for _, p := range posts {
+		result := Result{
+			Source: p.Source,
+			Title:  p.Post.Title,
+			Slug:   p.Post.URL,
+		}
+		switch other, collided := slugs[p.Post.URL]; {
+		case p.Err != nil:
+			result.Err = p.Err
+		case p.Post.URL == "":
+			result.Err = fmt.Errorf("empty slug")
+		case collided:
+			result.Err = fmt.Errorf("slug collides with %s", other)
+		default:
+			slugs[p.Post.URL] = fmt.Sprintf("%q in this import", p.Source)
+			result.ID = uuid.NewString()
+			if !dryRun {
+				post := p.Post
+				if _, ok := account.Lookup(site, post.Author); !ok {
+					post.Author = ""
+				}
+				site.UpdatePost(result.ID, &post)
+				for _, from := range p.Redirects {
+					if from != "/"+post.URL {
+						site.AddRedirect(from, result.ID)
+					}
+				}
+			}
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
@@ -0,0 +1,89 @@
+package importer_test
+
+import (
+	"errors"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/importer"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+func TestImport(t *testing.T) {
+	posts := []importer.Post{
+		{Source: "a.md", Post: model.Post{URL: "a"}, Redirects: []string{"/2020/01/02/a", "/a"}},
+		{Source: "b.md", Post: model.Post{URL: "existing"}},
+		{Source: "c.md", Post: model.Post{URL: "a"}},
+		{Source: "d.md", Err: errors.New("bad")},
+		{Source: "e.md", Post: model.Post{URL: "e"}},
+	}
+	wantSkipped := map[string]bool{"b.md": true, "c.md": true, "d.md": true}
+
+	for _, dryRun := range []bool{true, false} {
+		site := &model.Site{
+			Posts: map[string]model.Post{
+				"existing": {URL: "existing"},
+			},
+		}
+		report := importer.Import(site, posts, dryRun)
+		if got, want := report.Imported(), 2; got != want {
+			t.Errorf("dryRun=%v Imported() got %d want %d", dryRun, got, want)
+		}
+		if got, want := report.Skipped(), 3; got != want {
+			t.Errorf("dryRun=%v Skipped() got %d want %d", dryRun, got, want)
+		}
+		for _, r := range report.Results {
+			if got, want := r.Err != nil, wantSkipped[r.Source]; got != want {
+				t.Errorf("dryRun=%v %s skipped got %v want %v", dryRun, r.Source, got, want)
+			}
+		}
+
+		want := 3
+		if dryRun {
+			want = 1
+		}
+		if got := len(site.Posts); got != want {
+			t.Errorf("dryRun=%v got %d posts want %d", dryRun, got, want)
+		}
+
+		want = 1
+		if dryRun {
+			want = 0
+		}
+		if got := len(site.Redirects); got != want {
+			t.Errorf("dryRun=%v got %d redirects want %d", dryRun, got, want)
+		}
+		if post, ok := site.Redirect("/2020/01/02/a"); ok != !dryRun || (ok && post.URL != "a") {
+			t.Errorf("dryRun=%v Redirect() got %q, %v", dryRun, post.URL, ok)
+		}
+	}
+}
+
+func TestImportAuthor(t *testing.T) {
+	t.Setenv("PBB_USERNAME", "owner")
+	site := &model.Site{Posts: make(map[string]model.Post)}
+	site.UpdateUser("alice", &model.User{Role: model.RoleAuthor})
+
+	for _, c := range []struct {
+		label  string
+		author string
+		want   string
+	}{
+		{label: "user", author: "alice", want: "alice"},
+		{label: "owner", author: "owner", want: "owner"},
+		{label: "display-name", author: "Alice Smith", want: ""},
+		{label: "empty", author: "", want: ""},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			report := importer.Import(site, []importer.Post{
+				{Source: c.label + ".md", Post: model.Post{URL: c.label, Author: c.author}},
+			}, false)
+			if len(report.Results) != 1 || report.Results[0].Err != nil {
+				t.Fatalf("Import got %+v", report.Results)
+			}
+			author, _ := site.PostAuthor(report.Results[0].ID)
+			if author != c.want {
+				t.Errorf("Author got %q want %q", author, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// jekyllName matches Jekyll post file names like "2006-01-02-slug.md".
+var jekyllName = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)$`)
+
+// isMarkdown returns true if name is a Markdown file that should be imported.
+//
+// Files and directories starting with "_" or "." are skipped, except for
+// Jekyll's "_posts" and "_drafts".
+func isMarkdown(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	default:
+		return false
+	case ".md", ".markdown":
+	}
+	for part := range strings.SplitSeq(name, "/") {
+		if part == "_posts" || part == "_drafts" {
+			continue
+		}
+		if strings.HasPrefix(part, "_") || strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseMarkdown parses a Markdown file with YAML (Jekyll and Hugo) or TOML
+// (Hugo) front matter into a post.
+//
+// The front matter keys used are title, date, slug, tags, draft and lang, as
+// well as the other keys from the export package. If the slug or date is
+// missing, they are taken from the file name, for example
+// "2006-01-02-slug.md" in Jekyll.
+func ParseMarkdown(name string, b []byte, now time.Time) (model.Post, error) {
+	var post model.Post
+
+	content := strings.ReplaceAll(string(b), "\r\n", "\n")
+	content = strings.TrimPrefix(content, "\ufeff")
+	var fm map[string]any
+	switch {
+	case strings.HasPrefix(content, "---\n"):
+		raw, rest, ok := strings.Cut(content[len("---\n"):], "\n---")
+		if !ok {
+			return post, errors.New("unterminated YAML front matter")
+		}
+		if err := yaml.Unmarshal([]byte(raw), &fm); err != nil {
+			return post, fmt.Errorf("invalid YAML front matter: %w", err)
+		}
+		content = rest
+	case strings.HasPrefix(content, "+++\n"):
+		raw, rest, ok := strings.Cut(content[len("+++\n"):], "\n+++")
+		if !ok {
+			return post, errors.New("unterminated TOML front matter")
+		}
+		if _, err := toml.Decode(raw, &fm); err != nil {
+			return post, fmt.Errorf("invalid TOML front matter: %w", err)
+		}
+		content = rest
+	default:
+		return post, errors.New("no front matter")
+	}
+	// Drop the rest of the closing line of the front matter.
+	if _, after, ok := strings.Cut(content, "\n"); ok {
+		content = after
+	} else {
+		content = ""
+	}
+
+	base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	if path.Dir(name) != "." && (base == "index" || base == "README") {
+		// Hugo page bundles, use the directory name instead.
+		base = path.Base(path.Dir(name))
+	}
+	var fileDate string
+	if m := jekyllName.FindStringSubmatch(base); m != nil {
+		fileDate, base = m[1], m[2]
+	}
+
+	post.Title = stringValue(fm["title"])
+	post.URL = strings.Trim(stringValue(fm["slug"]), "/")
+	if post.URL == "" {
+		post.URL = base
+	}
+	post.Canonical = stringValue(fm["canonical"])
+	post.Lang = stringValue(fm["lang"])
+	post.Author = stringValue(fm["author"])
+	post.Content = content
+	post.Created = now
+	post.Updated = now
+
+	post.Timestamp = now
+	for _, v := range []any{fm["date"], fm["timestamp"], fileDate} {
+		if t, ok, err := timeValue(v); err != nil {
+			return post, err
+		} else if ok {
+			post.Timestamp = t
+			break
+		}
+	}
+
+	for _, tag := range listValue(fm["tags"]) {
+		post.Tags = append(post.Tags, model.Tag{Name: tag, Timestamp: now})
+	}
+
+	post.Published = true
+	if draft, ok := fm["draft"].(bool); ok {
+		post.Published = !draft
+	}
+	if published, ok := fm["published"].(bool); ok {
+		post.Published = published
+	}
+	if page, ok := fm["page"].(bool); ok {
+		post.Page = page
+	}
+	if strings.Contains(name, "_drafts/") {
+		post.Published = false
+	}
+	return post, nil
+}
+
+// ReadFS reads all the Markdown files in fsys as posts to import.
+func ReadFS(fsys fs.FS, now time.Time) ([]Post, error) {
+	return readFS(fsys, now, func(_ string, r io.Reader) ([]byte, error) {
+		return io.ReadAll(r)
+	})
+}
+
+// readFS reads all the Markdown files in fsys as posts to import, with read.
+func readFS(fsys fs.FS, now time.Time, read func(name string, r io.Reader) ([]byte, error)) ([]Post, error) {
+	var posts []Post
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isMarkdown(name) {
+			return nil
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		b, err := read(name, f)
+		if err != nil {
+			return err
+		}
+		post, err := ParseMarkdown(name, b, now)
+		posts = append(posts, Post{
+			Source: name,
+			Post:   post,
+			Err:    err,
+		})
+		return nil
+	})
+	return posts, err
+}
+
+// The limits of the extracted files in an archive, so small archives cannot
+// extract to files that don't fit in memory.
+const (
+	maxFileSize    = 4 << 20
+	maxArchiveSize = 64 << 20
+)
+
+// limitedReader reads the files extracted from an archive, failing when a file
+// is larger than maxFileSize or all of them are larger than maxArchiveSize.
+type limitedReader struct {
+	total int64
+}
+
+func (l *limitedReader) read(name string, r io.Reader) ([]byte, error) {
+	limit := min(maxFileSize, maxArchiveSize-l.total)
+	b, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	l.total += int64(len(b))
+	if int64(len(b)) > limit {
+		if limit < maxFileSize {
+			return nil, fmt.Errorf("the extracted files are larger than %d MiB in total", maxArchiveSize>>20)
+		}
+		return nil, fmt.Errorf("%s is larger than %d MiB", name, maxFileSize>>20)
+	}
+	return b, nil
+}
+
+// ReadArchive reads all the Markdown files in a zip, tar or tar.gz archive as
+// posts to import. It fails if a file is larger than 4 MiB, or all of them are
+// larger than 64 MiB in total.
+func ReadArchive(b []byte, now time.Time) ([]Post, error) {
+	var l limitedReader
+	switch {
+	case bytes.HasPrefix(b, []byte("PK\x03\x04")):
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			return nil, err
+		}
+		return readFS(zr, now, l.read)
+
+	case bytes.HasPrefix(b, []byte{0x1f, 0x8b}):
+		gr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		return readTar(gr, now, l.read)
+
+	case len(b) > 262 && string(b[257:262]) == "ustar":
+		return readTar(bytes.NewReader(b), now, l.read)
+
+	default:
+		return nil, errors.New("unsupported archive format, only zip, tar and tar.gz are supported")
+	}
+}
+
+func readTar(r io.Reader, now time.Time, read func(name string, r io.Reader) ([]byte, error)) ([]Post, error) {
+	var posts []Post
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return posts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "/")
+		if hdr.Typeflag != tar.TypeReg || !isMarkdown(name) {
+			continue
+		}
+		b, err := read(name, tr)
+		if err != nil {
+			return nil, err
+		}
+		post, err := ParseMarkdown(name, b, now)
+		posts = append(posts, Post{
+			Source: name,
+			Post:   post,
+			Err:    err,
+		})
+	}
+}
+
+func stringValue(v any) string {
+	switch v := v.(type) {
+	default:
+		return ""
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	case int, int64, float64, bool:
+		return fmt.Sprint(v)
+	}
+}
+
+// listValue returns a list from either a list or a comma or space separated
+// string.
+func listValue(v any) []string {
+	var list []string
+	switch v := v.(type) {
+	case []any:
+		for _, item := range v {
+			if s := strings.TrimSpace(stringValue(item)); s != "" {
+				list = append(list, s)
+			}
+		}
+	case string:
+		sep := ","
+		if !strings.Contains(v, sep) {
+			sep = " "
+		}
+		for item := range strings.SplitSeq(v, sep) {
+			if s := strings.TrimSpace(item); s != "" {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
+
+func timeValue(v any) (t time.Time, ok bool, err error) {
+	switch v := v.(type) {
+	case time.Time:
+		if strings.HasSuffix(v.Location().String(), "-local") {
+			// TOML dates without offsets, in UTC like the ones in strings.
+			v = time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond(), time.UTC)
+		}
+		return v, true, nil
+	case string:
+		if v == "" {
+			return t, false, nil
+		}
+		t, err := parseDate(v)
+		return t, err == nil, err
+	}
+	return t, false, nil
+}
+
+// dateLayouts are the date formats accepted in front matter.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unsupported date format %q", s)
+}
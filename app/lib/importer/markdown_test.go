@@ -0,0 +1,270 @@
+package importer_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"go.yhsif.com/pandablog/app/lib/export"
+	"go.yhsif.com/pandablog/app/lib/importer"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+func TestParseMarkdown(t *testing.T) {
+	now := time.Date(2024, 5, 26, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		label string
+		name  string
+		file  string
+		want  model.Post
+	}{
+		{
+			label: "jekyll",
+			name:  "_posts/2020-01-02-hello-world.md",
+			file: `---
+layout: post
+title: "Hello: World"
+tags: [a, b]
+---
+Hello
+`,
+			want: model.Post{
+				Title:     "Hello: World",
+				URL:       "hello-world",
+				Timestamp: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+				Content:   "Hello\n",
+				Published: true,
+				Tags:      model.TagList{{Name: "a"}, {Name: "b"}},
+			},
+		},
+		{
+			label: "jekyll-date",
+			name:  "_posts/2020-01-02-foo.markdown",
+			file:  "---\r\ntitle: Foo\r\ndate: 2021-03-04 05:06:07 +0000\r\ntags: x y\r\npublished: false\r\n---\r\nFoo",
+			want: model.Post{
+				Title:     "Foo",
+				URL:       "foo",
+				Timestamp: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+				Content:   "Foo",
+				Tags:      model.TagList{{Name: "x"}, {Name: "y"}},
+			},
+		},
+		{
+			label: "hugo-toml",
+			name:  "posts/bar/index.md",
+			file: `+++
+title = "Bar"
+date = 2022-02-03T04:05:06Z
+draft = true
+lang = 'fr'
+tags = [
+  "c",
+]
+[params]
+slug = "ignored"
++++
+Bar
+`,
+			want: model.Post{
+				Title:     "Bar",
+				URL:       "bar",
+				Timestamp: time.Date(2022, 2, 3, 4, 5, 6, 0, time.UTC),
+				Lang:      "fr",
+				Content:   "Bar\n",
+				Tags:      model.TagList{{Name: "c"}},
+			},
+		},
+		{
+			label: "hugo-toml-quotes",
+			name:  "posts/quotes.md",
+			file: `+++
+# A "quoted" comment, with 'quotes'
+title = "Quotes, \"and\" more" # trailing comment
+date = 2022-02-03
+tags = ["a, b", "c"]
+weight = 3
++++
+`,
+			want: model.Post{
+				Title:     `Quotes, "and" more`,
+				URL:       "quotes",
+				Timestamp: time.Date(2022, 2, 3, 0, 0, 0, 0, time.UTC),
+				Published: true,
+				Tags:      model.TagList{{Name: "a, b"}, {Name: "c"}},
+			},
+		},
+		{
+			label: "hugo-yaml-slug",
+			name:  "posts/baz.md",
+			file: `---
+title: Baz
+slug: /qux/
+date: 2023-01-01
+---
+`,
+			want: model.Post{
+				Title:     "Baz",
+				URL:       "qux",
+				Timestamp: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+				Published: true,
+			},
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			got, err := importer.ParseMarkdown(c.name, []byte(c.file), now)
+			if err != nil {
+				t.Fatalf("ParseMarkdown failed: %v", err)
+			}
+			c.want.Created = now
+			c.want.Updated = now
+			for i := range c.want.Tags {
+				c.want.Tags[i].Timestamp = now
+			}
+			compare(t, got, c.want)
+		})
+	}
+}
+
+func TestParseMarkdownNoFrontMatter(t *testing.T) {
+	if _, err := importer.ParseMarkdown("foo.md", []byte("# Foo"), time.Now()); err == nil {
+		t.Error("Expected error for file without front matter")
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	now := time.Date(2024, 5, 26, 0, 0, 0, 0, time.UTC)
+	want := model.Post{
+		Title:     "Foo",
+		URL:       "foo",
+		Canonical: "https://example.com/foo",
+		Timestamp: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Lang:      "en",
+		Content:   "Foo\n",
+		Page:      true,
+		Created:   now,
+		Updated:   now,
+		Tags:      model.TagList{{Name: "a", Timestamp: now}},
+	}
+
+	var buf bytes.Buffer
+	if err := export.Zip(context.Background(), &buf, &model.Site{Posts: map[string]model.Post{"id": want}}); err != nil {
+		t.Fatalf("export.Zip failed: %v", err)
+	}
+	posts, err := importer.ReadArchive(buf.Bytes(), now)
+	if err != nil {
+		t.Fatalf("ReadArchive failed: %v", err)
+	}
+	if len(posts) != 1 {
+		t.Fatalf("ReadArchive got %d posts want 1", len(posts))
+	}
+	if posts[0].Err != nil {
+		t.Fatalf("ReadArchive got error: %v", posts[0].Err)
+	}
+	compare(t, posts[0].Post, want)
+}
+
+func TestReadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"content/posts/a.md":      {Data: []byte("---\ntitle: A\n---\n")},
+		"content/posts/_index.md": {Data: []byte("---\ntitle: Index\n---\n")},
+		"content/posts/b.txt":     {Data: []byte("---\ntitle: B\n---\n")},
+		"_posts/2020-01-01-c.md":  {Data: []byte("---\ntitle: C\n---\n")},
+		"_drafts/d.md":            {Data: []byte("---\ntitle: D\n---\n")},
+		"_site/e.md":              {Data: []byte("---\ntitle: E\n---\n")},
+	}
+	posts, err := importer.ReadFS(fsys, time.Now())
+	if err != nil {
+		t.Fatalf("ReadFS failed: %v", err)
+	}
+	got := make(map[string]bool)
+	for _, p := range posts {
+		got[p.Post.Title] = p.Post.Published
+	}
+	want := map[string]bool{"A": true, "C": true, "D": false}
+	if len(got) != len(want) {
+		t.Errorf("ReadFS got %v want %v", got, want)
+	}
+	for title, published := range want {
+		if p, ok := got[title]; !ok || p != published {
+			t.Errorf("ReadFS got %v want %v", got, want)
+		}
+	}
+}
+
+func TestReadArchiveZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create("blog/a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("---\ntitle: A\n---\n"))
+	zw.Close()
+
+	posts, err := importer.ReadArchive(buf.Bytes(), time.Now())
+	if err != nil {
+		t.Fatalf("ReadArchive failed: %v", err)
+	}
+	if len(posts) != 1 || posts[0].Post.URL != "a" {
+		t.Errorf("ReadArchive got %+v", posts)
+	}
+
+	if _, err := importer.ReadArchive([]byte("foo"), time.Now()); err == nil {
+		t.Error("Expected error for unknown archive format")
+	}
+}
+
+func compare(t *testing.T, got, want model.Post) {
+	t.Helper()
+	if got.Title != want.Title ||
+		got.URL != want.URL ||
+		got.Canonical != want.Canonical ||
+		!got.Timestamp.Equal(want.Timestamp) ||
+		!got.Created.Equal(want.Created) ||
+		!got.Updated.Equal(want.Updated) ||
+		got.Lang != want.Lang ||
+		got.Content != want.Content ||
+		got.Published != want.Published ||
+		got.Page != want.Page ||
+		got.Tags.String() != want.Tags.String() {
+		t.Errorf("Post got %+v want %+v", got, want)
+	}
+}
+
+func TestReadArchiveTooLarge(t *testing.T) {
+	large := "---\ntitle: Large\n---\n" + strings.Repeat("a", 5<<20)
+
+	var zbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	f, err := zw.Create("large.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(large))
+	zw.Close()
+
+	var tbuf bytes.Buffer
+	tw := tar.NewWriter(&tbuf)
+	tw.WriteHeader(&tar.Header{Name: "large.md", Mode: 0644, Size: int64(len(large))})
+	tw.Write([]byte(large))
+	tw.Close()
+
+	for _, c := range []struct {
+		label string
+		b     []byte
+	}{
+		{"zip", zbuf.Bytes()},
+		{"tar", tbuf.Bytes()},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			if _, err := importer.ReadArchive(c.b, time.Now()); err == nil || !strings.Contains(err.Error(), "large.md is larger than") {
+				t.Errorf("ReadArchive got err %v want file too large", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.yhsif.com/pandablog/app/lib/htmlmarkdown"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// wxrDateLayout is the layout of the dates in WordPress exports.
+const wxrDateLayout = "2006-01-02 15:04:05"
+
+// captionShortcode matches the opening and closing tags of the WordPress
+// caption shortcode, which wraps images.
+var captionShortcode = regexp.MustCompile(`\[/?caption[^\]]*\]`)
+
+type wxr struct {
+	Channel struct {
+		Link  string    `xml:"link"`
+		Items []wxrItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type wxrItem struct {
+	Title      string        `xml:"title"`
+	Link       string        `xml:"link"`
+	PubDate    string        `xml:"pubDate"`
+	GUID       string        `xml:"guid"`
+	Content    string        `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PostID     string        `xml:"post_id"`
+	Date       string        `xml:"post_date"`
+	DateGMT    string        `xml:"post_date_gmt"`
+	Name       string        `xml:"post_name"`
+	Status     string        `xml:"status"`
+	Type       string        `xml:"post_type"`
+	Categories []wxrCategory `xml:"category"`
+}
+
+type wxrCategory struct {
+	Domain string `xml:"domain,attr"`
+	Name   string `xml:",chardata"`
+}
+
+// IsWXR reports whether b looks like a WordPress eXtended RSS (WXR) export.
+func IsWXR(b []byte) bool {
+	head := string(b[:min(len(b), 4096)])
+	return strings.Contains(head, "<rss") && strings.Contains(head, "wordpress.org/export/")
+}
+
+// Read reads the posts to import from a WordPress eXtended RSS (WXR) export,
+// or a zip, tar or tar.gz archive of Markdown files.
+func Read(b []byte, now time.Time) ([]Post, error) {
+	if IsWXR(b) {
+		return ReadWXR(bytes.NewReader(b), now)
+	}
+	return ReadArchive(b, now)
+}
+
+// ReadWXR reads the posts and pages from a WordPress eXtended RSS (WXR)
+// export.
+//
+// Categories and tags become tags, the original publish dates are kept, and
+// the HTML contents are converted to Markdown. The old permalinks of the posts
+// are returned as Redirects. Other types of items, like attachments and menu
+// items, as well as trashed posts are ignored.
+func ReadWXR(r io.Reader, now time.Time) ([]Post, error) {
+	var doc wxr
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid WXR file: %w", err)
+	}
+	if len(doc.Channel.Items) == 0 && doc.Channel.Link == "" {
+		return nil, errors.New("invalid WXR file: no channel")
+	}
+
+	var posts []Post
+	for _, item := range doc.Channel.Items {
+		switch item.Type {
+		case "post", "page":
+		default:
+			continue
+		}
+		switch item.Status {
+		case "trash", "auto-draft", "inherit":
+			continue
+		}
+
+		source := item.Link
+		if source == "" {
+			source = item.Type + " " + item.PostID
+		}
+		post, err := parseWXRItem(item, now)
+		posts = append(posts, Post{
+			Source:    source,
+			Post:      post,
+			Redirects: wxrRedirects(doc.Channel.Link, item),
+			Err:       err,
+		})
+	}
+	return posts, nil
+}
+
+func parseWXRItem(item wxrItem, now time.Time) (model.Post, error) {
+	post := model.Post{
+		Title:     strings.TrimSpace(item.Title),
+		URL:       wxrSlug(item),
+		Created:   now,
+		Updated:   now,
+		Timestamp: now,
+		Published: item.Status == "publish",
+		Page:      item.Type == "page",
+	}
+
+	switch {
+	case item.DateGMT != "" && !strings.HasPrefix(item.DateGMT, "0000"):
+		t, err := time.Parse(wxrDateLayout, item.DateGMT)
+		if err != nil {
+			return post, fmt.Errorf("invalid post_date_gmt: %w", err)
+		}
+		post.Timestamp = t
+	case item.Date != "" && !strings.HasPrefix(item.Date, "0000"):
+		// Drafts don't have the GMT date, use the local time instead.
+		t, err := time.ParseInLocation(wxrDateLayout, item.Date, time.Local)
+		if err != nil {
+			return post, fmt.Errorf("invalid post_date: %w", err)
+		}
+		post.Timestamp = t
+	case item.PubDate != "":
+		if t, err := time.Parse(time.RFC1123Z, item.PubDate); err == nil {
+			post.Timestamp = t
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range item.Categories {
+		switch c.Domain {
+		case "category", "post_tag":
+		default:
+			continue
+		}
+		name := strings.TrimSpace(c.Name)
+		// Every post is in "Uncategorized" unless put in another category.
+		if name == "" || name == "Uncategorized" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		post.Tags = append(post.Tags, model.Tag{Name: name, Timestamp: now})
+	}
+
+	content, err := htmlmarkdown.Convert(captionShortcode.ReplaceAllString(item.Content, ""))
+	if err != nil {
+		return post, fmt.Errorf("failed to convert content to Markdown: %w", err)
+	}
+	post.Content = content
+	return post, nil
+}
+
+// wxrSlug returns the slug of the post, from its name or permalink, or its
+// title for drafts without either.
+func wxrSlug(item wxrItem) string {
+	// post_name is percent-encoded for non-ASCII slugs. Slashes are replaced
+	// after unescaping it, so the slug can't make the redirects to the post
+	// leave the site, like "//example.com".
+	name := item.Name
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	name = strings.Trim(strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' {
+			return '-'
+		}
+		return r
+	}, name), "-")
+	if name != "" {
+		return name
+	}
+	if u, err := url.Parse(item.Link); err == nil && u.RawQuery == "" {
+		if slug := strings.Trim(u.Path, "/"); slug != "" && !strings.ContainsAny(slug, `/\`) {
+			return slug
+		}
+	}
+	words := strings.FieldsFunc(strings.ToLower(item.Title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
+
+// wxrRedirects returns the old paths of the post on the blog at siteLink,
+// including its permalink and the "?p=<id>" short link.
+func wxrRedirects(siteLink string, item wxrItem) []string {
+	site, err := url.Parse(siteLink)
+	if err != nil {
+		site = new(url.URL)
+	}
+	base := strings.TrimRight(site.Path, "/")
+
+	var redirects []string
+	for _, link := range []string{item.Link, item.GUID} {
+		u, err := url.Parse(link)
+		if err != nil || u.Host != site.Host {
+			continue
+		}
+		p, ok := strings.CutPrefix(u.Path, base)
+		if !ok {
+			continue
+		}
+		if p = strings.TrimRight(p, "/"); p == "" {
+			p = "/"
+		}
+		if u.RawQuery != "" {
+			p += "?" + u.RawQuery
+		}
+		if p != "/" {
+			redirects = append(redirects, p)
+		}
+	}
+	if item.PostID != "" {
+		redirects = append(redirects, "/?p="+item.PostID)
+	}
+
+	// Remove duplicates, like the guid being the short link.
+	var deduped []string
+	seen := make(map[string]bool)
+	for _, p := range redirects {
+		if !seen[p] {
+			seen[p] = true
+			deduped = append(deduped, p)
+		}
+	}
+	return deduped
+}
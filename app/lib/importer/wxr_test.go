@@ -0,0 +1,168 @@
+package importer_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.yhsif.com/pandablog/app/lib/importer"
+)
+
+const testWXR = `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0"
+	xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:dc="http://purl.org/dc/elements/1.1/"
+	xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+	<title>My Blog</title>
+	<link>https://example.com/blog</link>
+	<wp:wxr_version>1.2</wp:wxr_version>
+	<item>
+		<title>Hello World</title>
+		<link>https://example.com/blog/2020/01/02/hello-world/</link>
+		<pubDate>Thu, 02 Jan 2020 10:00:00 +0000</pubDate>
+		<guid isPermaLink="false">https://example.com/blog/?p=12</guid>
+		<content:encoded><![CDATA[Welcome to <strong>WordPress</strong>.
+
+[caption id="attachment_1" align="alignnone"]<img src="https://example.com/blog/a.png" alt="A"> A caption[/caption]]]></content:encoded>
+		<excerpt:encoded><![CDATA[Excerpt]]></excerpt:encoded>
+		<wp:post_id>12</wp:post_id>
+		<wp:post_date><![CDATA[2020-01-02 11:00:00]]></wp:post_date>
+		<wp:post_date_gmt><![CDATA[2020-01-02 10:00:00]]></wp:post_date_gmt>
+		<wp:post_name><![CDATA[hello-world]]></wp:post_name>
+		<wp:status><![CDATA[publish]]></wp:status>
+		<wp:post_type><![CDATA[post]]></wp:post_type>
+		<category domain="category" nicename="uncategorized"><![CDATA[Uncategorized]]></category>
+		<category domain="category" nicename="news"><![CDATA[News]]></category>
+		<category domain="post_tag" nicename="go"><![CDATA[Go]]></category>
+		<category domain="post_tag" nicename="news"><![CDATA[News]]></category>
+	</item>
+	<item>
+		<title>About</title>
+		<link>https://example.com/blog/about/</link>
+		<guid isPermaLink="false">https://example.com/blog/?page_id=2</guid>
+		<content:encoded><![CDATA[<p>About me</p>]]></content:encoded>
+		<wp:post_id>2</wp:post_id>
+		<wp:post_date><![CDATA[2019-05-06 07:08:09]]></wp:post_date>
+		<wp:post_date_gmt><![CDATA[2019-05-06 07:08:09]]></wp:post_date_gmt>
+		<wp:post_name><![CDATA[about]]></wp:post_name>
+		<wp:status><![CDATA[publish]]></wp:status>
+		<wp:post_type><![CDATA[page]]></wp:post_type>
+	</item>
+	<item>
+		<title>My Draft!</title>
+		<link>https://example.com/blog/?p=20</link>
+		<guid isPermaLink="false">https://example.com/blog/?p=20</guid>
+		<content:encoded><![CDATA[]]></content:encoded>
+		<wp:post_id>20</wp:post_id>
+		<wp:post_date><![CDATA[2021-03-04 05:06:07]]></wp:post_date>
+		<wp:post_date_gmt><![CDATA[0000-00-00 00:00:00]]></wp:post_date_gmt>
+		<wp:post_name><![CDATA[]]></wp:post_name>
+		<wp:status><![CDATA[draft]]></wp:status>
+		<wp:post_type><![CDATA[post]]></wp:post_type>
+	</item>
+	<item>
+		<title>a.png</title>
+		<wp:post_id>13</wp:post_id>
+		<wp:status><![CDATA[inherit]]></wp:status>
+		<wp:post_type><![CDATA[attachment]]></wp:post_type>
+	</item>
+</channel>
+</rss>
+`
+
+func TestReadWXR(t *testing.T) {
+	if !importer.IsWXR([]byte(testWXR)) {
+		t.Error("IsWXR() got false want true")
+	}
+
+	now := time.Now()
+	posts, err := importer.ReadWXR(strings.NewReader(testWXR), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(posts), 3; got != want {
+		t.Fatalf("got %d posts want %d", got, want)
+	}
+
+	post := posts[0]
+	if post.Err != nil {
+		t.Errorf("post error: %v", post.Err)
+	}
+	if got, want := post.Post.URL, "hello-world"; got != want {
+		t.Errorf("URL got %q want %q", got, want)
+	}
+	if got, want := post.Post.Timestamp, time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Timestamp got %v want %v", got, want)
+	}
+	if !post.Post.Published || post.Post.Page {
+		t.Errorf("Published, Page got %v, %v want true, false", post.Post.Published, post.Post.Page)
+	}
+	if got, want := post.Post.Tags.String(), "News,Go"; got != want {
+		t.Errorf("Tags got %q want %q", got, want)
+	}
+	if got, want := post.Post.Content, "Welcome to **WordPress**.\n\n![A](https://example.com/blog/a.png) A caption"; got != want {
+		t.Errorf("Content got %q want %q", got, want)
+	}
+	if got, want := strings.Join(post.Redirects, " "), "/2020/01/02/hello-world /?p=12"; got != want {
+		t.Errorf("Redirects got %q want %q", got, want)
+	}
+
+	page := posts[1].Post
+	if !page.Page || page.URL != "about" || page.Content != "About me" {
+		t.Errorf("page got %+v", page)
+	}
+	if got, want := strings.Join(posts[1].Redirects, " "), "/about /?page_id=2 /?p=2"; got != want {
+		t.Errorf("page Redirects got %q want %q", got, want)
+	}
+
+	draft := posts[2]
+	if draft.Post.Published {
+		t.Error("draft Published got true want false")
+	}
+	if got, want := draft.Post.Timestamp, time.Date(2021, 3, 4, 5, 6, 7, 0, time.Local); !got.Equal(want) {
+		t.Errorf("draft Timestamp got %v want %v", got, want)
+	}
+	if got, want := draft.Post.URL, "my-draft"; got != want {
+		t.Errorf("draft URL got %q want %q", got, want)
+	}
+}
+
+func TestReadWXRSlug(t *testing.T) {
+	for _, c := range []struct {
+		label string
+		name  string
+		want  string
+	}{
+		{label: "plain", name: "hello-world", want: "hello-world"},
+		{label: "escaped", name: "%e4%bd%a0%e5%a5%bd", want: "你好"},
+		{label: "escaped-slashes", name: "%2F%2Fevil.example", want: "evil.example"},
+		{label: "slash", name: "a/b", want: "a-b"},
+		{label: "backslash", name: "%2F%5Cevil.example", want: "evil.example"},
+		{label: "only-slashes", name: "%2F%2F", want: "title"},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			wxr := `<rss xmlns:wp="http://wordpress.org/export/1.2/"><channel>
+	<wp:wxr_version>1.2</wp:wxr_version>
+	<item>
+		<title>Title</title>
+		<wp:post_id>1</wp:post_id>
+		<wp:post_name><![CDATA[` + c.name + `]]></wp:post_name>
+		<wp:status><![CDATA[draft]]></wp:status>
+		<wp:post_type><![CDATA[post]]></wp:post_type>
+	</item>
+</channel></rss>`
+			posts, err := importer.ReadWXR(strings.NewReader(wxr), time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(posts) != 1 {
+				t.Fatalf("got %d posts want 1", len(posts))
+			}
+			if got := posts[0].Post.URL; got != c.want {
+				t.Errorf("URL got %q want %q", got, c.want)
+			}
+		})
+	}
+}
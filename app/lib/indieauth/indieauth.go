@@ -0,0 +1,133 @@
+// Package indieauth verifies the access tokens issued by an IndieAuth token
+// endpoint, so IndieWeb clients can sign in with the site URL.
+//
+// See https://indieauth.spec.indieweb.org/.
+package indieauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// timeout is the timeout of the requests to the token endpoint.
+	timeout = 10 * time.Second
+	// readLimit is the maximum size of the responses of the token endpoint.
+	readLimit = 64 << 10
+)
+
+// ErrInvalidToken is returned when the token endpoint rejects a token.
+var ErrInvalidToken = errors.New("indieauth: invalid token")
+
+// AuthorizationEndpoint returns the authorization endpoint in
+// PBB_INDIEAUTH_AUTHORIZATION_ENDPOINT, or "" if IndieAuth is not set up.
+func AuthorizationEndpoint() string {
+	return os.Getenv("PBB_INDIEAUTH_AUTHORIZATION_ENDPOINT")
+}
+
+// TokenEndpoint returns the token endpoint in PBB_INDIEAUTH_TOKEN_ENDPOINT,
+// which verifies the tokens, or "" if IndieAuth is not set up.
+func TokenEndpoint() string {
+	return os.Getenv("PBB_INDIEAUTH_TOKEN_ENDPOINT")
+}
+
+// Token is the information of a token from the token endpoint.
+type Token struct {
+	// Me is the URL of the user the token was issued to.
+	Me       string
+	ClientID string
+	Scopes   []string
+}
+
+// HasScope reports whether the token has any of the scopes.
+func (t Token) HasScope(scopes ...string) bool {
+	return slices.ContainsFunc(scopes, func(scope string) bool {
+		return slices.Contains(t.Scopes, scope)
+	})
+}
+
+// IsMe reports whether the token was issued to the site at siteURL, ignoring
+// the scheme and the trailing slash.
+func (t Token) IsMe(siteURL string) bool {
+	me, err := url.Parse(t.Me)
+	if err != nil {
+		return false
+	}
+	site, err := url.Parse(siteURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(me.Host, site.Host) &&
+		strings.TrimSuffix(me.Path, "/") == strings.TrimSuffix(site.Path, "/")
+}
+
+// Verify asks the token endpoint about token. It returns ErrInvalidToken if
+// the endpoint rejects it.
+func Verify(ctx context.Context, client *http.Client, endpoint, token string) (Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, readLimit))
+	if err != nil {
+		return Token{}, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest ||
+		resp.StatusCode == http.StatusUnauthorized ||
+		resp.StatusCode == http.StatusForbidden ||
+		resp.StatusCode == http.StatusNotFound:
+		return Token{}, ErrInvalidToken
+	case resp.StatusCode != http.StatusOK:
+		return Token{}, fmt.Errorf("indieauth: token endpoint responded %s", resp.Status)
+	}
+
+	var in struct {
+		Me       string `json:"me"`
+		ClientID string `json:"client_id"`
+		Scope    string `json:"scope"`
+		// Active is false for the tokens that are no longer valid, in the
+		// responses of the token introspection.
+		Active *bool `json:"active"`
+	}
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if contentType == "application/x-www-form-urlencoded" {
+		// The older token endpoints ignore Accept.
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return Token{}, fmt.Errorf("indieauth: invalid response of the token endpoint: %w", err)
+		}
+		in.Me, in.ClientID, in.Scope = form.Get("me"), form.Get("client_id"), form.Get("scope")
+	} else if err := json.Unmarshal(body, &in); err != nil {
+		return Token{}, fmt.Errorf("indieauth: invalid response of the token endpoint: %w", err)
+	}
+	if in.Me == "" || (in.Active != nil && !*in.Active) {
+		return Token{}, ErrInvalidToken
+	}
+	return Token{
+		Me:       in.Me,
+		ClientID: in.ClientID,
+		Scopes:   strings.Fields(in.Scope),
+	}, nil
+}
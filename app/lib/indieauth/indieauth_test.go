@@ -0,0 +1,96 @@
+package indieauth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/indieauth"
+)
+
+func TestVerify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"me": "https://example.com/", "client_id": "https://app.example", "scope": "create media"}`))
+		case "Bearer form":
+			w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+			w.Write([]byte("me=https%3A%2F%2Fexample.com%2F&client_id=https%3A%2F%2Fapp.example&scope=update"))
+		case "Bearer inactive":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"active": false}`))
+		case "Bearer broken":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		label string
+		token string
+		want  indieauth.Token
+		err   error
+	}{
+		{
+			label: "json",
+			token: "json",
+			want:  indieauth.Token{Me: "https://example.com/", ClientID: "https://app.example", Scopes: []string{"create", "media"}},
+		},
+		{
+			label: "form",
+			token: "form",
+			want:  indieauth.Token{Me: "https://example.com/", ClientID: "https://app.example", Scopes: []string{"update"}},
+		},
+		{
+			label: "inactive",
+			token: "inactive",
+			err:   indieauth.ErrInvalidToken,
+		},
+		{
+			label: "unauthorized",
+			token: "unknown",
+			err:   indieauth.ErrInvalidToken,
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			got, err := indieauth.Verify(context.Background(), srv.Client(), srv.URL, c.token)
+			if !errors.Is(err, c.err) {
+				t.Fatalf("Verify() got err %v want %v", err, c.err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Verify() got %#v want %#v", got, c.want)
+			}
+		})
+	}
+
+	t.Run("broken", func(t *testing.T) {
+		_, err := indieauth.Verify(context.Background(), srv.Client(), srv.URL, "broken")
+		if err == nil || errors.Is(err, indieauth.ErrInvalidToken) {
+			t.Errorf("Verify() got err %v want an error other than ErrInvalidToken", err)
+		}
+	})
+}
+
+func TestTokenIsMe(t *testing.T) {
+	for _, c := range []struct {
+		me   string
+		site string
+		want bool
+	}{
+		{"https://example.com/", "https://example.com", true},
+		{"http://Example.com", "https://example.com", true},
+		{"https://example.com/blog/", "https://example.com/blog", true},
+		{"https://example.com.evil/", "https://example.com", false},
+		{"https://example.com/other", "https://example.com", false},
+	} {
+		if got := (indieauth.Token{Me: c.me}).IsMe(c.site); got != c.want {
+			t.Errorf("IsMe(%q, %q) got %v want %v", c.me, c.site, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package linediff computes line based diffs between texts.
+package linediff
+
+import (
+	"slices"
+	"strings"
+)
+
+// Op is the operation of a line in a diff.
+type Op int
+
+// Ops.
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Line is a single line in a diff.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Prefix returns the prefix of the line in unified diff format.
+func (l Line) Prefix() string {
+	switch l.Op {
+	default:
+		return " "
+	case Insert:
+		return "+"
+	case Delete:
+		return "-"
+	}
+}
+
+// Inserted returns true if the line is only in the new text.
+func (l Line) Inserted() bool {
+	return l.Op == Insert
+}
+
+// Deleted returns true if the line is only in the old text.
+func (l Line) Deleted() bool {
+	return l.Op == Delete
+}
+
+// Diff returns the lines to turn from into to, based on their longest common
+// subsequence.
+//
+// It uses Hirschberg's algorithm, so it only takes memory linear to the number
+// of lines.
+func Diff(from, to string) []Line {
+	a := splitLines(from)
+	b := splitLines(to)
+	return diff(a, b, make([]Line, 0, max(len(a), len(b))))
+}
+
+// diff appends the lines to turn a into b to lines.
+func diff(a, b []string, lines []Line) []Line {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		lines = append(lines, Line{Op: Equal, Text: a[prefix]})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		lines = appendLines(lines, Insert, b)
+	case len(b) == 0:
+		lines = appendLines(lines, Delete, a)
+	case len(a) == 1:
+		// a has no common prefix or suffix with b, so a[0] can only match a
+		// line in the middle of b.
+		if k := slices.Index(b, a[0]); k >= 0 {
+			lines = appendLines(lines, Insert, b[:k])
+			lines = append(lines, Line{Op: Equal, Text: a[0]})
+			lines = appendLines(lines, Insert, b[k+1:])
+		} else {
+			lines = appendLines(lines, Delete, a)
+			lines = appendLines(lines, Insert, b)
+		}
+	default:
+		// Split b where the longest common subsequences of both halves of a
+		// add up to the longest.
+		mid := len(a) / 2
+		forward := lcsLengths(a[:mid], b)
+		backward := lcsLengths(reversed(a[mid:]), reversed(b))
+		split, longest := 0, -1
+		for k := range forward {
+			if l := forward[k] + backward[len(b)-k]; l > longest {
+				split, longest = k, l
+			}
+		}
+		lines = diff(a[:mid], b[:split], lines)
+		lines = diff(a[mid:], b[split:], lines)
+	}
+	return appendLines(lines, Equal, common)
+}
+
+// lcsLengths returns the lengths of the longest common subsequences of a and
+// b[:j] for each j.
+func lcsLengths(a, b []string) []int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+func reversed(s []string) []string {
+	s = slices.Clone(s)
+	slices.Reverse(s)
+	return s
+}
+
+func appendLines(lines []Line, op Op, texts []string) []Line {
+	for _, text := range texts {
+		lines = append(lines, Line{Op: op, Text: text})
+	}
+	return lines
+}
+
+// Changed returns true if any of the lines is not Equal.
+func Changed(lines []Line) bool {
+	for _, l := range lines {
+		if l.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
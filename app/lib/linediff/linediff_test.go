@@ -0,0 +1,124 @@
+package linediff
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	for _, c := range []struct {
+		label    string
+		from, to string
+		want     []Line
+	}{
+		{
+			label: "empty",
+		},
+		{
+			label: "equal",
+			from:  "a\nb\n",
+			to:    "a\r\nb",
+			want: []Line{
+				{Op: Equal, Text: "a"},
+				{Op: Equal, Text: "b"},
+			},
+		},
+		{
+			label: "insert",
+			from:  "a\nc",
+			to:    "a\nb\nc",
+			want: []Line{
+				{Op: Equal, Text: "a"},
+				{Op: Insert, Text: "b"},
+				{Op: Equal, Text: "c"},
+			},
+		},
+		{
+			label: "delete",
+			from:  "a\nb\nc",
+			to:    "a\nc",
+			want: []Line{
+				{Op: Equal, Text: "a"},
+				{Op: Delete, Text: "b"},
+				{Op: Equal, Text: "c"},
+			},
+		},
+		{
+			label: "replace",
+			from:  "a\nb\nc",
+			to:    "a\nd\nc\ne",
+			want: []Line{
+				{Op: Equal, Text: "a"},
+				{Op: Delete, Text: "b"},
+				{Op: Insert, Text: "d"},
+				{Op: Equal, Text: "c"},
+				{Op: Insert, Text: "e"},
+			},
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			got := Diff(c.from, c.to)
+			if !slices.Equal(got, c.want) {
+				t.Errorf("Diff(%q, %q) got %+v want %+v", c.from, c.to, got, c.want)
+			}
+			if got, want := Changed(got), c.from != c.to && c.label != "equal"; got != want {
+				t.Errorf("Changed got %v want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDiffLCS(t *testing.T) {
+	// lcs is the length of the longest common subsequence of a and b, with
+	// the quadratic memory algorithm.
+	lcs := func(a, b []string) int {
+		table := make([][]int, len(a)+1)
+		for i := range table {
+			table[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					table[i][j] = table[i+1][j+1] + 1
+				} else {
+					table[i][j] = max(table[i+1][j], table[i][j+1])
+				}
+			}
+		}
+		return table[0][0]
+	}
+
+	r := rand.New(rand.NewPCG(1, 2))
+	text := func() []string {
+		lines := make([]string, r.IntN(50))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.IntN(4)))
+		}
+		return lines
+	}
+	for range 200 {
+		a, b := text(), text()
+		from, to := strings.Join(a, "\n"), strings.Join(b, "\n")
+		var gotFrom, gotTo []string
+		equal := 0
+		for _, l := range Diff(from, to) {
+			if l.Op != Insert {
+				gotFrom = append(gotFrom, l.Text)
+			}
+			if l.Op != Delete {
+				gotTo = append(gotTo, l.Text)
+			}
+			if l.Op == Equal {
+				equal++
+			}
+		}
+		if !slices.Equal(gotFrom, a) || !slices.Equal(gotTo, b) {
+			t.Fatalf("Diff(%q, %q) got from %q to %q", from, to, gotFrom, gotTo)
+		}
+		if want := lcs(a, b); equal != want {
+			t.Errorf("Diff(%q, %q) got %d equal lines want %d", from, to, equal, want)
+		}
+	}
+}
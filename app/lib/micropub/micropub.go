@@ -0,0 +1,353 @@
+// Package micropub parses the requests of the W3C Micropub protocol, and maps
+// the properties of h-entry onto the posts.
+//
+// See https://www.w3.org/TR/micropub/.
+package micropub
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.yhsif.com/pandablog/app/lib/htmlmarkdown"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// The actions of the requests.
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionUndelete = "undelete"
+)
+
+// TypeEntry is the only type of the posts that can be created.
+const TypeEntry = "h-entry"
+
+// dateFormat is the format of the published dates of the posts.
+const dateFormat = "2006-01-02"
+
+// ErrInvalidRequest is returned for the requests that cannot be parsed or
+// applied.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// Properties are the properties of a post, like the ones in microformats2
+// JSON. The values are strings, or objects like {"html": "..."} for content
+// and {"value": "...", "alt": "..."} for photo.
+type Properties map[string][]any
+
+// Request is a Micropub request to create, update or delete a post.
+type Request struct {
+	Action string
+	// URL is the post to update or delete.
+	URL string
+
+	// Type and Properties are the post to create.
+	Type       string
+	Properties Properties
+
+	// Replace, Add and Delete are the changes to update the post with.
+	Replace Properties
+	Add     Properties
+	// Delete are values to delete, or nil values to delete the whole
+	// properties.
+	Delete Properties
+}
+
+// ParseForm parses a request in a form, either form-urlencoded or multipart.
+// Form requests cannot update posts.
+func ParseForm(form url.Values) (Request, error) {
+	req := Request{
+		Action: form.Get("action"),
+		URL:    form.Get("url"),
+	}
+	switch req.Action {
+	case "":
+		req.Action = ActionCreate
+	case ActionDelete, ActionUndelete:
+		return req, req.validate()
+	default:
+		return req, fmt.Errorf("%w: action %q is not supported in forms", ErrInvalidRequest, req.Action)
+	}
+
+	req.Type = "h-" + cmp.Or(form.Get("h"), "entry")
+	req.Properties = make(Properties)
+	for key, values := range form {
+		switch key {
+		case "h", "action", "url", "access_token":
+			continue
+		}
+		name := strings.TrimSuffix(key, "[]")
+		for _, v := range values {
+			req.Properties[name] = append(req.Properties[name], v)
+		}
+	}
+	return req, req.validate()
+}
+
+// ParseJSON parses a request in JSON.
+func ParseJSON(body []byte) (Request, error) {
+	var in struct {
+		Type       []string        `json:"type"`
+		Properties Properties      `json:"properties"`
+		Action     string          `json:"action"`
+		URL        string          `json:"url"`
+		Replace    Properties      `json:"replace"`
+		Add        Properties      `json:"add"`
+		Delete     json.RawMessage `json:"delete"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return Request{}, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	req := Request{
+		Action:     cmp.Or(in.Action, ActionCreate),
+		URL:        in.URL,
+		Properties: in.Properties,
+		Replace:    in.Replace,
+		Add:        in.Add,
+	}
+	if len(in.Type) > 0 {
+		req.Type = in.Type[0]
+	}
+	if len(in.Delete) > 0 {
+		// The properties to delete are either a list of names, or the values
+		// to delete by the names.
+		var names []string
+		if err := json.Unmarshal(in.Delete, &names); err == nil {
+			req.Delete = make(Properties)
+			for _, name := range names {
+				req.Delete[name] = nil
+			}
+		} else if err := json.Unmarshal(in.Delete, &req.Delete); err != nil {
+			return Request{}, fmt.Errorf("%w: delete must be a list or an object", ErrInvalidRequest)
+		}
+	}
+	return req, req.validate()
+}
+
+// validate checks that the request has what its action needs.
+func (r Request) validate() error {
+	switch r.Action {
+	case ActionCreate:
+		if r.Type != TypeEntry {
+			return fmt.Errorf("%w: only %s can be created", ErrInvalidRequest, TypeEntry)
+		}
+	case ActionUpdate, ActionDelete, ActionUndelete:
+		if r.URL == "" {
+			return fmt.Errorf("%w: the url is required to %s", ErrInvalidRequest, r.Action)
+		}
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidRequest, r.Action)
+	}
+	return nil
+}
+
+// Update applies the replace, add and delete changes of the request to props.
+func (r Request) Update(props Properties) {
+	for name, values := range r.Replace {
+		props[name] = values
+	}
+	for name, values := range r.Add {
+		props[name] = append(props[name], values...)
+	}
+	for name, values := range r.Delete {
+		if values == nil {
+			delete(props, name)
+			continue
+		}
+		// The values could be objects, which cannot be compared.
+		props[name] = slices.DeleteFunc(props[name], func(v any) bool {
+			return slices.ContainsFunc(values, func(d any) bool {
+				return stringValue(d) == stringValue(v)
+			})
+		})
+	}
+}
+
+// Value returns the first value of the property as a string, or "" if it's
+// not set.
+func (p Properties) Value(name string) string {
+	if len(p[name]) == 0 {
+		return ""
+	}
+	return stringValue(p[name][0])
+}
+
+// stringValue returns v as a string, or its HTML or value if it's an object.
+func stringValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case map[string]any:
+		for _, key := range []string{"html", "value"} {
+			if s, ok := v[key].(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// PostProperties returns the properties of post, for the q=source queries and
+// to apply the updates to.
+func PostProperties(post model.Post) Properties {
+	props := Properties{
+		"name":        {post.Title},
+		"content":     {post.Content},
+		"published":   {post.Timestamp.Format(dateFormat)},
+		"post-status": {"draft"},
+	}
+	if post.Published {
+		props["post-status"] = []any{"published"}
+	}
+	for _, t := range post.Tags {
+		props["category"] = append(props["category"], t.Name)
+	}
+	return props
+}
+
+// Apply sets the properties to post: name, content, category, published and
+// post-status. HTML content is converted to Markdown. The photo, video and
+// audio are added to the end of the content. Posts without a name get one from
+// their content, and the ones without a published date get the date of now if
+// they don't have one yet.
+func (p Properties) Apply(post *model.Post, now time.Time) error {
+	ts := post.Timestamp
+	if published := p.Value("published"); published != "" {
+		t, err := parseDate(published)
+		if err != nil {
+			return err
+		}
+		ts = t
+	} else if ts.IsZero() {
+		ts, _ = time.Parse(dateFormat, now.Format(dateFormat))
+	}
+
+	var published bool
+	switch status := p.Value("post-status"); status {
+	case "", "published":
+		published = true
+	case "draft":
+	default:
+		return fmt.Errorf("%w: unknown post-status %q", ErrInvalidRequest, status)
+	}
+
+	content, err := p.content()
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"photo", "video", "audio"} {
+		for _, v := range p[name] {
+			content = addMedia(content, name, v)
+		}
+	}
+	if strings.TrimSpace(content) == "" && p.Value("name") == "" {
+		return fmt.Errorf("%w: the name or content is required", ErrInvalidRequest)
+	}
+
+	var tags []string
+	for _, v := range p["category"] {
+		if s := stringValue(v); s != "" {
+			tags = append(tags, s)
+		}
+	}
+
+	post.Title = cmp.Or(p.Value("name"), noteTitle(content))
+	post.Content = content
+	post.Timestamp = ts
+	post.Tags = post.Tags.Split(strings.Join(tags, ","))
+	post.Published = published
+	return nil
+}
+
+// content returns the content as Markdown, converted from HTML if it's an
+// object like {"html": "..."}.
+func (p Properties) content() (string, error) {
+	if len(p["content"]) == 0 {
+		return "", nil
+	}
+	m, ok := p["content"][0].(map[string]any)
+	if !ok {
+		return stringValue(p["content"][0]), nil
+	}
+	s, ok := m["html"].(string)
+	if !ok {
+		return stringValue(m), nil
+	}
+	content, err := htmlmarkdown.Convert(s)
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to convert content to Markdown: %w", ErrInvalidRequest, err)
+	}
+	return content, nil
+}
+
+// parseDate parses the published date of a post, with or without the time.
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02T15:04:05", dateFormat} {
+		if t, err := time.Parse(layout, s); err == nil {
+			// The posts only have the dates.
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: cannot parse the published date %q", ErrInvalidRequest, s)
+}
+
+// addMedia adds the photo, video or audio v to the end of content, as
+// Markdown.
+func addMedia(content, name string, v any) string {
+	src := stringValue(v)
+	if src == "" {
+		return content
+	}
+	var alt string
+	if m, ok := v.(map[string]any); ok {
+		alt, _ = m["alt"].(string)
+	}
+
+	md := fmt.Sprintf("[%s](%s)", cmp.Or(alt, name), src)
+	if name == "photo" {
+		md = fmt.Sprintf("![%s](%s)", alt, src)
+	}
+	if content == "" {
+		return md
+	}
+	return strings.TrimRight(content, "\n") + "\n\n" + md
+}
+
+// maxTitleLength is the maximum number of characters of the names taken from
+// the contents.
+const maxTitleLength = 50
+
+// noteTitle returns the name of a note without one, the start of the first
+// line of its content.
+func noteTitle(content string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(content), "\n")
+	line = strings.TrimSpace(line)
+	if r := []rune(line); len(r) > maxTitleLength {
+		line = strings.TrimSpace(string(r[:maxTitleLength])) + "…"
+	}
+	return line
+}
+
+// maxSlugWords is the maximum number of words of the slugs taken from the
+// names.
+const maxSlugWords = 8
+
+// Slug returns the slug of a post from its name: the lowercased words of
+// letters and digits, joined by "-".
+func Slug(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSlugWords {
+		words = words[:maxSlugWords]
+	}
+	return strings.Join(words, "-")
+}
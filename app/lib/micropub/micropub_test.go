@@ -0,0 +1,293 @@
+package micropub_test
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.yhsif.com/pandablog/app/lib/micropub"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+func TestParseForm(t *testing.T) {
+	for _, c := range []struct {
+		label string
+		form  url.Values
+		want  micropub.Request
+		err   bool
+	}{
+		{
+			label: "create",
+			form: url.Values{
+				"h":            {"entry"},
+				"content":      {"Hello"},
+				"category[]":   {"a", "b"},
+				"access_token": {"pbb_x"},
+			},
+			want: micropub.Request{
+				Action: micropub.ActionCreate,
+				Type:   micropub.TypeEntry,
+				Properties: micropub.Properties{
+					"content":  {"Hello"},
+					"category": {"a", "b"},
+				},
+			},
+		},
+		{
+			label: "delete",
+			form:  url.Values{"action": {"delete"}, "url": {"https://example.com/a"}},
+			want:  micropub.Request{Action: micropub.ActionDelete, URL: "https://example.com/a"},
+		},
+		{
+			label: "event",
+			form:  url.Values{"h": {"event"}, "name": {"Party"}},
+			err:   true,
+		},
+		{
+			label: "update",
+			form:  url.Values{"action": {"update"}, "url": {"https://example.com/a"}},
+			err:   true,
+		},
+		{
+			label: "delete-without-url",
+			form:  url.Values{"action": {"delete"}},
+			err:   true,
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			got, err := micropub.ParseForm(c.form)
+			if c.err {
+				if !errors.Is(err, micropub.ErrInvalidRequest) {
+					t.Errorf("ParseForm() got err %v want ErrInvalidRequest", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseForm() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("ParseForm() got %#v want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	for _, c := range []struct {
+		label string
+		body  string
+		want  micropub.Request
+		err   bool
+	}{
+		{
+			label: "create",
+			body:  `{"type": ["h-entry"], "properties": {"content": [{"html": "<b>Hi</b>"}]}}`,
+			want: micropub.Request{
+				Action: micropub.ActionCreate,
+				Type:   micropub.TypeEntry,
+				Properties: micropub.Properties{
+					"content": {map[string]any{"html": "<b>Hi</b>"}},
+				},
+			},
+		},
+		{
+			label: "update",
+			body:  `{"action": "update", "url": "/a", "replace": {"name": ["B"]}, "delete": ["category"]}`,
+			want: micropub.Request{
+				Action:  micropub.ActionUpdate,
+				URL:     "/a",
+				Replace: micropub.Properties{"name": {"B"}},
+				Delete:  micropub.Properties{"category": nil},
+			},
+		},
+		{
+			label: "delete-values",
+			body:  `{"action": "update", "url": "/a", "delete": {"category": ["a"]}}`,
+			want: micropub.Request{
+				Action: micropub.ActionUpdate,
+				URL:    "/a",
+				Delete: micropub.Properties{"category": {"a"}},
+			},
+		},
+		{
+			label: "bad-delete",
+			body:  `{"action": "update", "url": "/a", "delete": "category"}`,
+			err:   true,
+		},
+		{
+			label: "no-type",
+			body:  `{"properties": {"content": ["Hi"]}}`,
+			err:   true,
+		},
+		{
+			label: "unknown-action",
+			body:  `{"action": "like", "url": "/a"}`,
+			err:   true,
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			got, err := micropub.ParseJSON([]byte(c.body))
+			if c.err {
+				if !errors.Is(err, micropub.ErrInvalidRequest) {
+					t.Errorf("ParseJSON() got err %v want ErrInvalidRequest", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseJSON() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("ParseJSON() got %#v want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	today := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		label string
+		props micropub.Properties
+		want  model.Post
+		tags  string
+		err   bool
+	}{
+		{
+			label: "article",
+			props: micropub.Properties{
+				"name":      {"Title"},
+				"content":   {"Body"},
+				"category":  {"a", "b"},
+				"published": {"2020-01-02T03:04:05-08:00"},
+			},
+			want: model.Post{
+				Title:     "Title",
+				Content:   "Body",
+				Timestamp: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+				Published: true,
+			},
+			tags: "a,b",
+		},
+		{
+			label: "note",
+			props: micropub.Properties{
+				"content":     {"A note that is longer than the fifty characters of a title\nsecond line"},
+				"post-status": {"draft"},
+			},
+			want: model.Post{
+				Title:     "A note that is longer than the fifty characters of…",
+				Content:   "A note that is longer than the fifty characters of a title\nsecond line",
+				Timestamp: today,
+			},
+		},
+		{
+			label: "photos",
+			props: micropub.Properties{
+				"content": {map[string]any{"html": "<p>Hi <b>there</b></p>"}},
+				"photo":   {"https://example.com/a.jpg", map[string]any{"value": "/media/b.png", "alt": "B"}},
+				"video":   {"/media/c.mp4"},
+			},
+			want: model.Post{
+				Title:     "Hi **there**",
+				Content:   "Hi **there**\n\n![](https://example.com/a.jpg)\n\n![B](/media/b.png)\n\n[video](/media/c.mp4)",
+				Timestamp: today,
+				Published: true,
+			},
+		},
+		{
+			label: "empty",
+			props: micropub.Properties{"category": {"a"}},
+			err:   true,
+		},
+		{
+			label: "bad-date",
+			props: micropub.Properties{"name": {"A"}, "published": {"yesterday"}},
+			err:   true,
+		},
+		{
+			label: "bad-status",
+			props: micropub.Properties{"name": {"A"}, "post-status": {"deleted"}},
+			err:   true,
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			var got model.Post
+			err := c.props.Apply(&got, now)
+			if c.err {
+				if !errors.Is(err, micropub.ErrInvalidRequest) {
+					t.Errorf("Apply() got err %v want ErrInvalidRequest", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() failed: %v", err)
+			}
+			if tags := got.Tags.String(); tags != c.tags {
+				t.Errorf("Apply() got tags %q want %q", tags, c.tags)
+			}
+			got.Tags = nil
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Apply() got %#v want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	post := model.Post{
+		Title:     "Title",
+		Content:   "Body",
+		Timestamp: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	post.Tags = post.Tags.Split("a,b,c")
+
+	req, err := micropub.ParseJSON([]byte(`{
+		"action": "update",
+		"url": "/title",
+		"replace": {"content": ["New body"], "post-status": ["published"]},
+		"add": {"category": ["d"]},
+		"delete": {"category": ["b"]}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseJSON() failed: %v", err)
+	}
+	props := micropub.PostProperties(post)
+	req.Update(props)
+	if err := props.Apply(&post, time.Now()); err != nil {
+		t.Fatalf("Apply() failed: %v", err)
+	}
+
+	if got, want := post.Content, "New body"; got != want {
+		t.Errorf("Content got %q want %q", got, want)
+	}
+	if got, want := post.Tags.String(), "a,c,d"; got != want {
+		t.Errorf("Tags got %q want %q", got, want)
+	}
+	if !post.Published {
+		t.Error("Published got false want true")
+	}
+	if got, want := post.Timestamp, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Timestamp got %v want %v", got, want)
+	}
+}
+
+func TestSlug(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		want string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"Go 1.26 is out", "go-1-26-is-out"},
+		{"one two three four five six seven eight nine", "one-two-three-four-five-six-seven-eight"},
+		{"日本語 テキスト", "日本語-テキスト"},
+		{"🐼…", ""},
+	} {
+		if got := micropub.Slug(c.name); got != c.want {
+			t.Errorf("Slug(%q) got %q want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -1,12 +1,65 @@
+// Package passhash hashes passwords with argon2id or bcrypt, in the PHC string
+// format like "$argon2id$v=19$m=19456,t=2,p=1$salt$hash", where the algorithm
+// of a hash is picked by its id.
 package passhash
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// The algorithms to hash passwords with.
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// Params are the algorithm and its cost to hash passwords with.
+type Params struct {
+	Algorithm string
+	// Cost is the bcrypt cost.
+	Cost int
+	// Time, Memory in KiB and Threads are the argon2id costs.
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// DefaultParams are the params of HashString and HashBytes, the minimum of
+// argon2id recommended by OWASP.
+var DefaultParams = Params{
+	Algorithm: Argon2id,
+	Cost:      bcrypt.DefaultCost,
+	Time:      2,
+	Memory:    19 * 1024,
+	Threads:   1,
+}
+
 // HashString returns a hashed string and an error
 func HashString(password string) (string, error) {
-	key, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return DefaultParams.HashString(password)
+}
+
+// HashBytes returns a hashed byte array and an error
+func HashBytes(password []byte) ([]byte, error) {
+	return DefaultParams.HashBytes(password)
+}
+
+// HashString returns the password hashed with p.
+func (p Params) HashString(password string) (string, error) {
+	key, err := p.HashBytes([]byte(password))
 	if err != nil {
 		return "", err
 	}
@@ -14,24 +67,108 @@ func HashString(password string) (string, error) {
 	return string(key), nil
 }
 
-// HashBytes returns a hashed byte array and an error
-func HashBytes(password []byte) ([]byte, error) {
-	key, err := bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
-	if err != nil {
-		return nil, err
+// HashBytes returns the password hashed with p.
+func (p Params) HashBytes(password []byte) ([]byte, error) {
+	switch p.Algorithm {
+	case Bcrypt:
+		return bcrypt.GenerateFromPassword(password, p.Cost)
+	case Argon2id:
+		if p.Time < 1 || p.Memory < 8*uint32(p.Threads) || p.Threads < 1 {
+			return nil, fmt.Errorf("passhash: invalid argon2id params t=%d m=%d p=%d", p.Time, p.Memory, p.Threads)
+		}
+		salt := make([]byte, argon2SaltLen)
+		rand.Read(salt)
+		key := argon2.IDKey(password, salt, p.Time, p.Memory, p.Threads, argon2KeyLen)
+		return fmt.Appendf(nil, "$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			Argon2id, argon2.Version, p.Memory, p.Time, p.Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	}
+	return nil, fmt.Errorf("passhash: unknown algorithm %q", p.Algorithm)
+}
+
+// hashed is a parsed hash, with the salt and key of argon2id.
+type hashed struct {
+	Params
+	salt []byte
+	key  []byte
+}
+
+var errFormat = errors.New("passhash: invalid hash format")
+
+// parse returns the params of hash, and the salt and key if it's argon2id.
+func parse(hash []byte) (hashed, error) {
+	fields := strings.Split(string(hash), "$")
+	if len(fields) < 2 || fields[0] != "" {
+		return hashed{}, errFormat
+	}
+	switch fields[1] {
+	case "2a", "2b", "2y":
+		cost, err := bcrypt.Cost(hash)
+		if err != nil {
+			return hashed{}, err
+		}
+		return hashed{Params: Params{Algorithm: Bcrypt, Cost: cost}}, nil
+	case Argon2id:
+	default:
+		return hashed{}, fmt.Errorf("passhash: unknown algorithm %q", fields[1])
 	}
 
-	return key, nil
+	if len(fields) != 6 {
+		return hashed{}, errFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil {
+		return hashed{}, errFormat
+	}
+	if version != argon2.Version {
+		return hashed{}, fmt.Errorf("passhash: unsupported argon2id version %d", version)
+	}
+	h := hashed{Params: Params{Algorithm: Argon2id}}
+	if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &h.Memory, &h.Time, &h.Threads); err != nil {
+		return hashed{}, errFormat
+	}
+	if h.Time < 1 || h.Threads < 1 {
+		return hashed{}, errFormat
+	}
+	var err1, err2 error
+	h.salt, err1 = base64.RawStdEncoding.DecodeString(fields[4])
+	h.key, err2 = base64.RawStdEncoding.DecodeString(fields[5])
+	if errors.Join(err1, err2) != nil || len(h.key) == 0 {
+		return hashed{}, errFormat
+	}
+	return h, nil
 }
 
 // MatchString returns true if the hash matches the password
 func MatchString(hash, password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	return MatchBytes([]byte(hash), []byte(password))
 }
 
 // MatchBytes returns true if the hash matches the password
 func MatchBytes(hash, password []byte) bool {
-	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
-	return err == nil
+	h, err := parse(hash)
+	if err != nil {
+		return false
+	}
+	if h.Algorithm == Bcrypt {
+		return bcrypt.CompareHashAndPassword(hash, password) == nil
+	}
+	key := argon2.IDKey(password, h.salt, h.Time, h.Memory, h.Threads, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// NeedsRehash reports whether hash is not hashed with DefaultParams, so it
+// should be replaced by hashing the password again after it matches.
+func NeedsRehash(hash string) bool {
+	h, err := parse([]byte(hash))
+	if err != nil || h.Algorithm != DefaultParams.Algorithm {
+		return true
+	}
+	if h.Algorithm == Bcrypt {
+		return h.Cost != DefaultParams.Cost
+	}
+	return h.Time != DefaultParams.Time || h.Memory != DefaultParams.Memory ||
+		h.Threads != DefaultParams.Threads || len(h.key) != argon2KeyLen
 }
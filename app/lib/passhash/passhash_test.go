@@ -1,7 +1,10 @@
 package passhash
 
 import (
+	"strings"
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestStringString(t *testing.T) {
@@ -59,3 +62,88 @@ func TestByteString(t *testing.T) {
 		t.Error("Password does not match")
 	}
 }
+
+func TestParams(t *testing.T) {
+	plainText := "This is a test."
+	for _, c := range []struct {
+		label  string
+		params Params
+		prefix string
+		rehash bool
+	}{
+		{
+			label:  "default",
+			params: DefaultParams,
+			prefix: "$argon2id$v=19$m=19456,t=2,p=1$",
+		},
+		{
+			label:  "argon2id",
+			params: Params{Algorithm: Argon2id, Time: 1, Memory: 64, Threads: 2},
+			prefix: "$argon2id$v=19$m=64,t=1,p=2$",
+			rehash: true,
+		},
+		{
+			label:  "bcrypt",
+			params: Params{Algorithm: Bcrypt, Cost: bcrypt.MinCost},
+			prefix: "$2a$04$",
+			rehash: true,
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			hash, err := c.params.HashString(plainText)
+			if err != nil {
+				t.Fatalf("HashString failed: %v", err)
+			}
+			if !strings.HasPrefix(hash, c.prefix) {
+				t.Errorf("Hash %q want prefix %q", hash, c.prefix)
+			}
+			if !MatchString(hash, plainText) {
+				t.Error("Password does not match")
+			}
+			if MatchString(hash, plainText+"!") {
+				t.Error("Wrong password matches")
+			}
+			if got := NeedsRehash(hash); got != c.rehash {
+				t.Errorf("NeedsRehash got %v want %v", got, c.rehash)
+			}
+		})
+	}
+}
+
+func TestInvalidParams(t *testing.T) {
+	for _, params := range []Params{
+		{Algorithm: "md5"},
+		{Algorithm: Argon2id, Memory: 64, Threads: 1},
+		{Algorithm: Argon2id, Time: 1, Memory: 64},
+		{Algorithm: Bcrypt, Cost: 100},
+	} {
+		if hash, err := params.HashString("password"); err == nil {
+			t.Errorf("HashString with %+v got %q want error", params, hash)
+		}
+	}
+}
+
+func TestInvalidHash(t *testing.T) {
+	hash, err := HashString("password")
+	if err != nil {
+		t.Fatalf("HashString failed: %v", err)
+	}
+	fields := strings.Split(hash, "$")
+	for _, hash := range []string{
+		"",
+		"password",
+		"$md5$password",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$" + strings.Join(fields[3:], "$"),
+		"$argon2id$v=19$m=64,t=0,p=1$" + strings.Join(fields[4:], "$"),
+		"$argon2id$v=19$" + fields[3] + "$" + fields[4] + "$!",
+		"$argon2id$v=19$" + fields[3] + "$" + fields[4] + "$",
+	} {
+		if MatchString(hash, "password") {
+			t.Errorf("MatchString(%q) got true want false", hash)
+		}
+		if !NeedsRehash(hash) {
+			t.Errorf("NeedsRehash(%q) got false want true", hash)
+		}
+	}
+}
@@ -43,6 +43,11 @@ func (m *Mux) BadRequest(w http.ResponseWriter, r *http.Request) {
 	m.customServeHTTP(w, r, http.StatusBadRequest, nil)
 }
 
+// Forbidden shows the 403 page.
+func (m *Mux) Forbidden(w http.ResponseWriter, r *http.Request) {
+	m.customServeHTTP(w, r, http.StatusForbidden, nil)
+}
+
 // Param returns a URL parameter.
 func (m *Mux) Param(r *http.Request, param string) string {
 	return way.Param(r.Context(), param)
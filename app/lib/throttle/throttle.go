@@ -0,0 +1,346 @@
+// Package throttle slows down repeated failed attempts, like logins, with
+// exponential backoff and temporary lockouts.
+package throttle
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule is how the failed attempts of a kind of keys are throttled.
+type Rule struct {
+	// Free is the number of failures allowed before backing off.
+	Free int
+	// Backoff is the delay after the first failure over Free, doubled with
+	// every further failure.
+	Backoff time.Duration
+	// LockoutAfter is the number of failures that lock the key out.
+	LockoutAfter int
+	// Lockout is how long a key is locked out, and also the maximum backoff.
+	Lockout time.Duration
+	// Forget is how long after the last failure it's forgotten.
+	Forget time.Duration
+}
+
+// delay returns how long to wait after the failures.
+func (rule Rule) delay(failures int) time.Duration {
+	switch {
+	case failures >= rule.LockoutAfter:
+		return rule.Lockout
+	case failures <= rule.Free:
+		return 0
+	}
+	delay := rule.Backoff
+	for i := rule.Free + 1; i < failures && delay < rule.Lockout; i++ {
+		delay *= 2
+	}
+	return min(delay, rule.Lockout)
+}
+
+// Entry is the failed attempts of a key.
+type Entry struct {
+	Failures int `json:"failures"`
+	// Last is the time of the last failure.
+	Last time.Time `json:"last"`
+	// Until is when the next attempt is allowed.
+	Until time.Time `json:"until"`
+}
+
+// Locked reports whether the key is locked out, rather than backing off.
+func (e Entry) Locked(rule Rule) bool {
+	return e.Failures >= rule.LockoutAfter
+}
+
+// Store persists the entries, so all the instances share them.
+type Store interface {
+	// Entries returns the stored entries by their keys.
+	Entries(ctx context.Context) (map[string]Entry, error)
+	// UpdateEntries changes the stored entries with fn atomically, and only
+	// writes them if fn returns true.
+	UpdateEntries(ctx context.Context, fn func(entries map[string]Entry) bool) error
+}
+
+// Status is an entry with its key.
+type Status struct {
+	Entry
+	// Key is the key without the kind, like the IP.
+	Key    string
+	Kind   string
+	Locked bool
+}
+
+// Throttle counts the failed attempts of keys, like "ip:127.0.0.1" or
+// "user:alice", where the kind before ":" selects the rule.
+type Throttle struct {
+	rules map[string]Rule
+	store Store
+	now   func() time.Time
+
+	lock sync.Mutex
+	// entries are the entries in memory, the ones last read from the store
+	// if there is one.
+	entries map[string]Entry
+	// pending are the entries counted only in memory because the store
+	// failed, to merge into the store by the next update.
+	pending map[string]Entry
+}
+
+// New returns a Throttle with the rules by the kinds of the keys, keeping the
+// entries in memory and store if it's not nil.
+//
+// Keys of kinds without rules are not throttled.
+func New(rules map[string]Rule, store Store) *Throttle {
+	return &Throttle{
+		rules:   rules,
+		store:   store,
+		now:     time.Now,
+		entries: make(map[string]Entry),
+		pending: make(map[string]Entry),
+	}
+}
+
+// Key returns the key of value of kind.
+func Key(kind, value string) string {
+	return kind + ":" + value
+}
+
+func (t *Throttle) rule(key string) (Rule, bool) {
+	kind, _, _ := strings.Cut(key, ":")
+	rule, ok := t.rules[kind]
+	return rule, ok
+}
+
+// throttled returns the keys with rules.
+func (t *Throttle) throttled(keys []string) []string {
+	return slices.DeleteFunc(slices.Clone(keys), func(key string) bool {
+		_, ok := t.rule(key)
+		return !ok
+	})
+}
+
+// expired reports whether the entry of key can be forgotten.
+func (t *Throttle) expired(key string, e Entry, now time.Time) bool {
+	rule, ok := t.rule(key)
+	return !ok || now.After(e.Last.Add(rule.Forget)) && !now.Before(e.Until)
+}
+
+// merge adds the pending entries to entries, keeping the most failures and
+// the latest times of both.
+func merge(entries, pending map[string]Entry) {
+	for k, v := range pending {
+		e, ok := entries[k]
+		if !ok {
+			entries[k] = v
+			continue
+		}
+		e.Failures = max(e.Failures, v.Failures)
+		if v.Last.After(e.Last) {
+			e.Last = v.Last
+		}
+		if v.Until.After(e.Until) {
+			e.Until = v.Until
+		}
+		entries[k] = e
+	}
+}
+
+// load returns the entries in the store, or in memory if there is no store or
+// it fails, with the pending ones merged.
+func (t *Throttle) load(ctx context.Context) (map[string]Entry, error) {
+	t.lock.Lock()
+	entries := maps.Clone(t.entries)
+	pending := maps.Clone(t.pending)
+	t.lock.Unlock()
+
+	if t.store == nil {
+		return entries, nil
+	}
+	stored, err := t.store.Entries(ctx)
+	if err != nil {
+		return entries, err
+	}
+	merge(stored, pending)
+
+	t.lock.Lock()
+	t.entries = maps.Clone(stored)
+	t.lock.Unlock()
+	return stored, nil
+}
+
+// update changes the entries with fn, which returns whether it changed
+// anything, and forgets the expired ones.
+//
+// If the store fails, the changes are kept in memory and the error is
+// returned.
+func (t *Throttle) update(ctx context.Context, fn func(entries map[string]Entry) bool) error {
+	now := t.now()
+	forget := func(entries map[string]Entry) {
+		maps.DeleteFunc(entries, func(key string, e Entry) bool {
+			return t.expired(key, e, now)
+		})
+	}
+
+	if t.store == nil {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		fn(t.entries)
+		forget(t.entries)
+		return nil
+	}
+
+	t.lock.Lock()
+	pending := maps.Clone(t.pending)
+	t.lock.Unlock()
+	var stored map[string]Entry
+	err := t.store.UpdateEntries(ctx, func(entries map[string]Entry) bool {
+		merge(entries, pending)
+		changed := fn(entries) || len(pending) > 0
+		forget(entries)
+		stored = maps.Clone(entries)
+		return changed
+	})
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err == nil {
+		t.entries = stored
+		// Keep the ones counted in memory since.
+		maps.DeleteFunc(t.pending, func(key string, e Entry) bool {
+			return pending[key] == e
+		})
+		merge(t.entries, t.pending)
+		return nil
+	}
+
+	// Keep counting in memory.
+	before := maps.Clone(t.entries)
+	fn(t.entries)
+	forget(t.entries)
+	for k, v := range t.entries {
+		if before[k] != v {
+			t.pending[k] = v
+		}
+	}
+	maps.DeleteFunc(t.pending, func(key string, _ Entry) bool {
+		_, ok := t.entries[key]
+		return !ok
+	})
+	return err
+}
+
+// Attempt checks whether an attempt of keys is allowed now. If it is, the
+// attempt is counted as failed right away, so concurrent attempts can't all
+// pass before any failure is recorded, and Attempt returns 0. Otherwise it
+// returns how long to wait, without counting the attempt.
+//
+// After a successful attempt, Clear or Refund the keys.
+func (t *Throttle) Attempt(ctx context.Context, keys ...string) (time.Duration, error) {
+	keys = t.throttled(keys)
+	var wait time.Duration
+	err := t.update(ctx, func(entries map[string]Entry) bool {
+		now := t.now()
+		wait = 0
+		for _, key := range keys {
+			if e, ok := entries[key]; ok {
+				wait = max(wait, e.Until.Sub(now))
+			}
+		}
+		if wait > 0 {
+			return false
+		}
+		for _, key := range keys {
+			rule, _ := t.rule(key)
+			e, ok := entries[key]
+			if ok && t.expired(key, e, now) {
+				e = Entry{}
+			}
+			e.Failures++
+			e.Last = now
+			e.Until = now.Add(rule.delay(e.Failures))
+			entries[key] = e
+		}
+		return len(keys) > 0
+	})
+	return wait, err
+}
+
+// Refund takes back an attempt of keys counted by Attempt, after it
+// succeeded, for the keys not to Clear, like the IP.
+func (t *Throttle) Refund(ctx context.Context, keys ...string) error {
+	keys = t.throttled(keys)
+	return t.update(ctx, func(entries map[string]Entry) bool {
+		var changed bool
+		for _, key := range keys {
+			e, ok := entries[key]
+			if !ok {
+				continue
+			}
+			changed = true
+			e.Failures--
+			if e.Failures <= 0 {
+				delete(entries, key)
+				continue
+			}
+			rule, _ := t.rule(key)
+			e.Until = e.Last.Add(rule.delay(e.Failures))
+			entries[key] = e
+		}
+		return changed
+	})
+}
+
+// Clear forgets the failed attempts of keys, after a successful attempt or by
+// an admin.
+func (t *Throttle) Clear(ctx context.Context, keys ...string) error {
+	t.lock.Lock()
+	for _, key := range keys {
+		delete(t.pending, key)
+	}
+	t.lock.Unlock()
+
+	return t.update(ctx, func(entries map[string]Entry) bool {
+		var changed bool
+		for _, key := range keys {
+			if _, ok := entries[key]; ok {
+				delete(entries, key)
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+// List returns the keys with failed attempts not forgotten yet, the locked
+// out ones first, then by the last failures.
+func (t *Throttle) List(ctx context.Context) ([]Status, error) {
+	entries, err := t.load(ctx)
+	now := t.now()
+	list := make([]Status, 0, len(entries))
+	for key, e := range entries {
+		rule, ok := t.rule(key)
+		if !ok || t.expired(key, e, now) {
+			continue
+		}
+		kind, value, _ := strings.Cut(key, ":")
+		list = append(list, Status{
+			Entry:  e,
+			Key:    value,
+			Kind:   kind,
+			Locked: e.Locked(rule) && now.Before(e.Until),
+		})
+	}
+	slices.SortFunc(list, func(left, right Status) int {
+		if left.Locked != right.Locked {
+			if left.Locked {
+				return -1
+			}
+			return 1
+		}
+		return right.Last.Compare(left.Last)
+	})
+	return list, err
+}
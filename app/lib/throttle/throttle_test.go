@@ -0,0 +1,273 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testRules = map[string]Rule{
+	"user": {
+		Free:         2,
+		Backoff:      time.Second,
+		LockoutAfter: 6,
+		Lockout:      time.Minute,
+		Forget:       time.Hour,
+	},
+}
+
+func TestRuleDelay(t *testing.T) {
+	rule := testRules["user"]
+	for failures, want := range []time.Duration{
+		0: 0,
+		1: 0,
+		2: 0,
+		3: time.Second,
+		4: 2 * time.Second,
+		5: 4 * time.Second,
+		6: time.Minute,
+		7: time.Minute,
+	} {
+		if got := rule.delay(failures); got != want {
+			t.Errorf("delay(%d) got %v want %v", failures, got, want)
+		}
+	}
+
+	rule.Backoff = 40 * time.Second
+	if got, want := rule.delay(5), time.Minute; got != want {
+		t.Errorf("delay(5) with long backoff got %v want %v", got, want)
+	}
+}
+
+// memStore is a Store shared by the throttles of the tests, which fails
+// while fail is set.
+type memStore struct {
+	lock    sync.Mutex
+	entries map[string]Entry
+	fail    bool
+	writes  int
+}
+
+var errStore = errors.New("store failed")
+
+func (s *memStore) Entries(context.Context) (map[string]Entry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.fail {
+		return nil, errStore
+	}
+	return maps.Clone(s.entries), nil
+}
+
+func (s *memStore) UpdateEntries(_ context.Context, fn func(map[string]Entry) bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.fail {
+		return errStore
+	}
+	entries := maps.Clone(s.entries)
+	if entries == nil {
+		entries = make(map[string]Entry)
+	}
+	if fn(entries) {
+		s.entries = entries
+		s.writes++
+	}
+	return nil
+}
+
+func TestThrottle(t *testing.T) {
+	for _, c := range []struct {
+		label string
+		store func() Store
+	}{
+		{
+			label: "memory",
+			store: func() Store { return nil },
+		},
+		{
+			label: "store",
+			store: func() Store { return new(memStore) },
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Unix(1700000000, 0)
+			store := c.store()
+			newThrottle := func() *Throttle {
+				th := New(testRules, store)
+				th.now = func() time.Time { return now }
+				return th
+			}
+			th := newThrottle()
+			alice := Key("user", "alice")
+			ip := Key("ip", "127.0.0.1")
+
+			attempt := func(want time.Duration, keys ...string) {
+				t.Helper()
+				got, err := th.Attempt(ctx, keys...)
+				if err != nil {
+					t.Fatalf("Attempt failed: %v", err)
+				}
+				if got != want {
+					t.Errorf("Attempt got %v want %v", got, want)
+				}
+			}
+			failures := func(want int) {
+				t.Helper()
+				list, err := th.List(ctx)
+				if err != nil {
+					t.Fatalf("List failed: %v", err)
+				}
+				var got int
+				if len(list) > 0 {
+					got = list[0].Failures
+				}
+				if got != want {
+					t.Errorf("List got %+v want %d failures", list, want)
+				}
+			}
+
+			for range 3 {
+				attempt(0, alice, ip)
+			}
+			attempt(time.Second, alice)
+			// Keys without rules are not throttled.
+			attempt(0, ip)
+			now = now.Add(time.Second)
+			attempt(0, alice, ip)
+			now = now.Add(2 * time.Second)
+			attempt(0, alice)
+			now = now.Add(4 * time.Second)
+			attempt(0, alice)
+			attempt(time.Minute, alice)
+			list, err := th.List(ctx)
+			if err != nil {
+				t.Fatalf("List failed: %v", err)
+			}
+			if len(list) != 1 || list[0].Key != "alice" || list[0].Kind != "user" || !list[0].Locked || list[0].Failures != 6 {
+				t.Errorf("List got %+v want alice locked out with 6 failures", list)
+			}
+
+			if store != nil {
+				// Shared with the other instances.
+				th = newThrottle()
+				attempt(time.Minute, alice)
+			}
+
+			if err := th.Clear(ctx, alice); err != nil {
+				t.Fatalf("Clear failed: %v", err)
+			}
+			attempt(0, alice)
+			failures(1)
+			if err := th.Refund(ctx, alice); err != nil {
+				t.Fatalf("Refund failed: %v", err)
+			}
+			failures(0)
+
+			// Forgotten after a while.
+			for range 3 {
+				attempt(0, alice)
+			}
+			now = now.Add(2 * time.Hour)
+			attempt(0, alice)
+			failures(1)
+		})
+	}
+}
+
+func TestThrottleConcurrentAttempts(t *testing.T) {
+	for _, c := range []struct {
+		label string
+		store Store
+	}{
+		{label: "memory"},
+		{label: "store", store: new(memStore)},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			th := New(testRules, c.store)
+			now := time.Unix(1700000000, 0)
+			th.now = func() time.Time { return now }
+
+			var wg sync.WaitGroup
+			var lock sync.Mutex
+			var allowed int
+			for range 20 {
+				wg.Go(func() {
+					wait, err := th.Attempt(context.Background(), Key("user", "alice"))
+					if err != nil {
+						t.Errorf("Attempt failed: %v", err)
+					}
+					if wait == 0 {
+						lock.Lock()
+						allowed++
+						lock.Unlock()
+					}
+				})
+			}
+			wg.Wait()
+			// The free ones, and the one starting the backoff.
+			if want := testRules["user"].Free + 1; allowed != want {
+				t.Errorf("Allowed %d concurrent attempts want %d", allowed, want)
+			}
+		})
+	}
+}
+
+func TestThrottleStoreFailure(t *testing.T) {
+	ctx := context.Background()
+	store := new(memStore)
+	th := New(testRules, store)
+	alice := Key("user", "alice")
+
+	th.Attempt(ctx, alice)
+	th.Attempt(ctx, alice)
+	store.fail = true
+	if _, err := th.Attempt(ctx, alice); !errors.Is(err, errStore) {
+		t.Errorf("Attempt got err %v want %v", err, errStore)
+	}
+	// Still throttled by the failures counted in memory.
+	if wait, _ := th.Attempt(ctx, alice); wait <= 0 {
+		t.Errorf("Attempt while the store fails got %v want > 0", wait)
+	}
+
+	store.fail = false
+	list, err := th.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(list) != 1 || list[0].Failures != 3 {
+		t.Errorf("List got %+v want the 3 failures counted in memory", list)
+	}
+
+	// Saved to the store by the next write.
+	th.Clear(ctx, Key("user", "bob"))
+	other := New(testRules, store)
+	if list, _ := other.List(ctx); len(list) != 1 || list[0].Failures != 3 {
+		t.Errorf("List of another instance got %+v want 3 failures", list)
+	}
+}
+
+func TestThrottleNoWriteWhileWaiting(t *testing.T) {
+	ctx := context.Background()
+	store := new(memStore)
+	th := New(testRules, store)
+	alice := Key("user", "alice")
+
+	for range 3 {
+		th.Attempt(ctx, alice)
+	}
+	writes := store.writes
+	for range 10 {
+		if wait, _ := th.Attempt(ctx, alice); wait <= 0 {
+			t.Fatalf("Attempt got %v want > 0", wait)
+		}
+	}
+	th.Clear(ctx, Key("user", "bob"))
+	if store.writes != writes {
+		t.Errorf("Store written %d times while waiting want 0", store.writes-writes)
+	}
+}
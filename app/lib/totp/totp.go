@@ -3,10 +3,17 @@ package totp
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base32"
+	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/dgryski/dgoogauth"
+	"rsc.io/qr"
 )
 
 // Authenticate will return true and not error if the TOTP (time-based) is
@@ -18,14 +25,93 @@ func Authenticate(challenge int, secret string) (bool, error) {
 	return config.Authenticate(fmt.Sprintf("%06d", challenge))
 }
 
+// period is the length of a TOTP time step.
+const period = 30 * time.Second
+
+// Verify will return true if the TOTP code is valid and its time step is after
+// last, the one returned by the previous successful Verify, so a code cannot
+// be replayed. The time step of the code is returned to be stored as the next
+// last.
+func Verify(code string, secret string, last int64) (step int64, ok bool) {
+	return verifyAt(time.Now(), code, secret, last)
+}
+
+func verifyAt(now time.Time, code string, secret string, last int64) (step int64, ok bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != 6 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(code)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	config := configuration(secret)
+	t0 := now.Unix() / int64(period/time.Second)
+	window := int64(config.WindowSize / 2)
+	for t := max(t0-window, last+1); t <= t0+window; t++ {
+		if dgoogauth.ComputeCode(config.Secret, t) == n {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// RecoveryCodeCount is the number of recovery codes generated together.
+const RecoveryCodeCount = 10
+
+// GenerateRecoveryCodes will return new one-time recovery codes that can be
+// used instead of the TOTP codes, like "abcde-fghij", and their hashes to
+// store.
+func GenerateRecoveryCodes() (codes []string, hashes []string) {
+	for range RecoveryCodeCount {
+		key := make([]byte, 10)
+		rand.Read(key)
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(key)[:10])
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes
+}
+
+// HashRecoveryCode returns the hash of the recovery code to store, ignoring
+// the case, spaces and dashes. The codes have 50 random bits, so they don't
+// need a slow password hash.
+func HashRecoveryCode(code string) string {
+	code = strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
 // GenerateURL will return a URL that can be added to a QR code.
 func GenerateURL(username string, issuer string) (URI string, secret string, err error) {
 	secret, err = generateSecretKey()
 	if err != nil {
 		return "", "", err
 	}
-	config := configuration(secret)
-	return config.ProvisionURIWithIssuer(username, issuer), secret, nil
+	return URL(username, issuer, secret), secret, nil
+}
+
+// URL will return the URL of the secret returned by GenerateURL again.
+func URL(username string, issuer string, secret string) string {
+	return configuration(secret).ProvisionURIWithIssuer(username, issuer)
+}
+
+// QRCode will return the PNG image of the QR code of the URL returned by
+// GenerateURL, to scan with the phone.
+func QRCode(URI string) ([]byte, error) {
+	code, err := qr.Encode(URI, qr.M)
+	if err != nil {
+		return nil, err
+	}
+	code.Scale = 6
+	return code.PNG(), nil
 }
 
 // generateSecretKey will generate a 10 bit secret key for use with TOTP.
@@ -46,7 +132,7 @@ func configuration(secret string) *dgoogauth.OTPConfig {
 		Secret:       secret,
 		WindowSize:   3,       // 3 is 60 seconds of grace time.
 		HotpCounter:  0,       // Zero is time based.
-		ScratchCodes: []int{}, // 8 digit codes to bypass login.
+		ScratchCodes: []int{}, // See GenerateRecoveryCodes instead.
 		UTC:          false,   // Use UTC for the timestamp instead of local time.
 	}
 }
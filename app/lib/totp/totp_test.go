@@ -1,6 +1,7 @@
 package totp
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -59,3 +60,60 @@ func TestGeneration(t *testing.T) {
 		t.Fatal("Prefix does not match.")
 	}
 }
+
+// TestVerify ensures the codes are accepted once within the window.
+func TestVerify(t *testing.T) {
+	secret := "2SH3V3GDW7ZNMGYE"
+	config := configuration(secret)
+	now := time.Unix(1700000000, 0)
+	t0 := now.Unix() / 30
+	code := func(step int64) string {
+		return fmt.Sprintf("%06d", dgoogauth.ComputeCode(config.Secret, step))
+	}
+
+	for _, c := range []struct {
+		label string
+		code  string
+		last  int64
+		step  int64
+		ok    bool
+	}{
+		{label: "current", code: code(t0), step: t0, ok: true},
+		{label: "previous", code: code(t0 - 1), step: t0 - 1, ok: true},
+		{label: "next", code: code(t0 + 1), step: t0 + 1, ok: true},
+		{label: "too-old", code: code(t0 - 2)},
+		{label: "replay", code: code(t0), last: t0},
+		{label: "after-newer", code: code(t0 - 1), last: t0},
+		{label: "after-older", code: code(t0), last: t0 - 1, step: t0, ok: true},
+		{label: "spaces", code: " " + code(t0) + " ", step: t0, ok: true},
+		{label: "short", code: code(t0)[1:]},
+		{label: "not-number", code: "abcdef"},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			step, ok := verifyAt(now, c.code, secret, c.last)
+			if ok != c.ok || step != c.step {
+				t.Errorf("verifyAt got %d, %v want %d, %v", step, ok, c.step, c.ok)
+			}
+		})
+	}
+}
+
+// TestRecoveryCodes ensures the hashes of the recovery codes match.
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes := GenerateRecoveryCodes()
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("GenerateRecoveryCodes got %d codes and %d hashes want %d", len(codes), len(hashes), RecoveryCodeCount)
+	}
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if seen[hashes[i]] {
+			t.Errorf("Duplicate recovery code %q", code)
+		}
+		seen[hashes[i]] = true
+		for _, typed := range []string{code, strings.ToUpper(code), strings.ReplaceAll(code, "-", " ")} {
+			if got := HashRecoveryCode(typed); got != hashes[i] {
+				t.Errorf("HashRecoveryCode(%q) got %q want %q", typed, got, hashes[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// maxCBORDepth is the maximum nesting of arrays and maps decodeCBOR accepts.
+const maxCBORDepth = 8
+
+var errCBORTruncated = errors.New("webauthn: truncated CBOR data")
+
+// decodeCBOR decodes the first CBOR data item in b, and returns it with the
+// number of bytes it used.
+//
+// Only the subset used by WebAuthn is supported: integers are returned as
+// int64, byte strings as []byte, text strings as string, arrays as []any,
+// maps as map[any]any with int64 or string keys, and simple values as bool
+// or nil. Floats, tags and indefinite lengths are rejected.
+func decodeCBOR(b []byte) (any, int, error) {
+	return decodeCBORItem(b, 0)
+}
+
+func decodeCBORItem(b []byte, depth int) (any, int, error) {
+	if depth > maxCBORDepth {
+		return nil, 0, errors.New("webauthn: CBOR data nested too deep")
+	}
+	if len(b) == 0 {
+		return nil, 0, errCBORTruncated
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	n := 1
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(b) < n+size {
+			return nil, 0, errCBORTruncated
+		}
+		switch size {
+		case 1:
+			arg = uint64(b[n])
+		case 2:
+			arg = uint64(binary.BigEndian.Uint16(b[n:]))
+		case 4:
+			arg = uint64(binary.BigEndian.Uint32(b[n:]))
+		case 8:
+			arg = binary.BigEndian.Uint64(b[n:])
+		}
+		n += size
+	default:
+		return nil, 0, fmt.Errorf("webauthn: unsupported CBOR additional info %d", info)
+	}
+
+	switch major {
+	case 0, 1:
+		if arg > 1<<63-1 {
+			return nil, 0, errors.New("webauthn: CBOR integer overflows int64")
+		}
+		if major == 1 {
+			return -1 - int64(arg), n, nil
+		}
+		return int64(arg), n, nil
+
+	case 2, 3:
+		if arg > uint64(len(b)-n) {
+			return nil, 0, errCBORTruncated
+		}
+		s := b[n : n+int(arg)]
+		n += int(arg)
+		if major == 3 {
+			return string(s), n, nil
+		}
+		return append([]byte(nil), s...), n, nil
+
+	case 4:
+		// Every item takes at least one byte.
+		if arg > uint64(len(b)-n) {
+			return nil, 0, errCBORTruncated
+		}
+		arr := make([]any, 0, arg)
+		for range arg {
+			v, used, err := decodeCBORItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			arr = append(arr, v)
+			n += used
+		}
+		return arr, n, nil
+
+	case 5:
+		// Every key and value takes at least one byte.
+		if arg > uint64(len(b)-n)/2 {
+			return nil, 0, errCBORTruncated
+		}
+		m := make(map[any]any, arg)
+		for range arg {
+			k, used, err := decodeCBORItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += used
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, 0, fmt.Errorf("webauthn: unsupported CBOR map key %T", k)
+			}
+			if _, ok := m[k]; ok {
+				return nil, 0, fmt.Errorf("webauthn: duplicate CBOR map key %v", k)
+			}
+			v, used, err := decodeCBORItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += used
+			m[k] = v
+		}
+		return m, n, nil
+
+	case 7:
+		switch info {
+		case 20:
+			return false, n, nil
+		case 21:
+			return true, n, nil
+		case 22:
+			return nil, n, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("webauthn: unsupported CBOR major type %d", major)
+}
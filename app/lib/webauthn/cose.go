@@ -0,0 +1,112 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// The COSE algorithms supported, see
+// https://www.iana.org/assignments/cose/cose.xhtml#algorithms
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Algorithms are the COSE algorithms of the public keys accepted, in the
+// order of preference.
+var Algorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// The COSE key parameters, see RFC 9053.
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1
+	coseE   = -2
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+// verifier verifies the signature of a message.
+type verifier func(message, sig []byte) bool
+
+// parsePublicKey parses a public key in the COSE_Key format.
+func parsePublicKey(b []byte) (verifier, error) {
+	v, n, err := decodeCBOR(b)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(b) {
+		return nil, errors.New("webauthn: trailing data after the public key")
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("webauthn: public key is not a CBOR map")
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case alg == AlgES256 && kty == coseKtyEC2:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("webauthn: invalid ES256 public key")
+		}
+		// Go through the uncompressed point encoding, which checks the
+		// point is on the curve.
+		point := append(append([]byte{4}, x...), y...)
+		key, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point)
+		if err != nil {
+			return nil, fmt.Errorf("webauthn: invalid ES256 public key: %w", err)
+		}
+		return func(message, sig []byte) bool {
+			digest := sha256.Sum256(message)
+			return ecdsa.VerifyASN1(key, digest[:], sig)
+		}, nil
+
+	case alg == AlgEdDSA && kty == coseKtyOKP:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("webauthn: invalid EdDSA public key")
+		}
+		key := ed25519.PublicKey(x)
+		return func(message, sig []byte) bool {
+			return ed25519.Verify(key, message, sig)
+		}, nil
+
+	case alg == AlgRS256 && kty == coseKtyRSA:
+		n, _ := m[int64(coseN)].([]byte)
+		e, _ := m[int64(coseE)].([]byte)
+		if len(n) < 2048/8 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("webauthn: invalid RS256 public key")
+		}
+		key := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		return func(message, sig []byte) bool {
+			digest := sha256.Sum256(message)
+			return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+		}, nil
+	}
+	return nil, fmt.Errorf("webauthn: unsupported public key algorithm %d with key type %d", alg, kty)
+}
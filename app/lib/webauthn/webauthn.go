@@ -0,0 +1,225 @@
+// Package webauthn implements the relying party side of the WebAuthn
+// registration and authentication ceremonies, to log in with passkeys.
+//
+// Attestations are not verified, as credentials are only registered by users
+// already logged in, and user verification is always required, so a passkey
+// stands in for both the password and the MFA token.
+//
+// See https://www.w3.org/TR/webauthn-3/
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ChallengeSize is the size of the challenges, in bytes.
+const ChallengeSize = 32
+
+// maxCredentialIDSize is the maximum size of credential ids, in bytes.
+const maxCredentialIDSize = 1023
+
+// The flags of the authenticator data.
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+)
+
+// ErrSignCount is returned when the signature counter of the authenticator
+// did not increase, which could mean the credential was cloned.
+var ErrSignCount = errors.New("webauthn: signature counter did not increase")
+
+// RelyingParty is the site the credentials are registered for.
+type RelyingParty struct {
+	// ID is the domain of the site, like "example.com".
+	ID string
+	// Origin is the origin the ceremonies run in, like "https://example.com".
+	Origin string
+}
+
+// NewRelyingParty returns the RelyingParty of the site served at host, which
+// can have a port, with scheme.
+func NewRelyingParty(scheme, host string) RelyingParty {
+	id := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		id = h
+	}
+	return RelyingParty{
+		ID:     id,
+		Origin: scheme + "://" + host,
+	}
+}
+
+// Credential is a registered public key credential.
+type Credential struct {
+	ID []byte
+	// PublicKey is in the COSE_Key format.
+	PublicKey []byte
+	SignCount uint32
+}
+
+// NewChallenge returns a random challenge for a ceremony.
+func NewChallenge() []byte {
+	challenge := make([]byte, ChallengeSize)
+	rand.Read(challenge)
+	return challenge
+}
+
+// Register verifies the response of navigator.credentials.create() to the
+// challenge, and returns the new credential.
+func (rp RelyingParty) Register(challenge, clientDataJSON, attestationObject []byte) (Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return Credential{}, err
+	}
+
+	v, n, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return Credential{}, err
+	}
+	if n != len(attestationObject) {
+		return Credential{}, errors.New("webauthn: trailing data after the attestation object")
+	}
+	obj, ok := v.(map[any]any)
+	if !ok {
+		return Credential{}, errors.New("webauthn: attestation object is not a CBOR map")
+	}
+	authData, ok := obj["authData"].([]byte)
+	if !ok {
+		return Credential{}, errors.New("webauthn: attestation object has no authenticator data")
+	}
+
+	data, err := rp.parseAuthData(authData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if data.flags&flagAttestedCredData == 0 {
+		return Credential{}, errors.New("webauthn: authenticator data has no credential")
+	}
+	if _, err := parsePublicKey(data.publicKey); err != nil {
+		return Credential{}, err
+	}
+	return Credential{
+		ID:        data.credentialID,
+		PublicKey: data.publicKey,
+		SignCount: data.signCount,
+	}, nil
+}
+
+// Login verifies the response of navigator.credentials.get() to the
+// challenge with the registered credential, and returns the new signature
+// counter to store.
+func (rp RelyingParty) Login(challenge, clientDataJSON, authenticatorData, signature []byte, cred Credential) (signCount uint32, err error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	data, err := rp.parseAuthData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	verify, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	message := append(bytes.Clone(authenticatorData), clientDataHash[:]...)
+	if !verify(message, signature) {
+		return 0, errors.New("webauthn: invalid signature")
+	}
+
+	// Authenticators without a counter, like most synced passkeys, always
+	// report 0.
+	if (data.signCount != 0 || cred.SignCount != 0) && data.signCount <= cred.SignCount {
+		return 0, ErrSignCount
+	}
+	return data.signCount, nil
+}
+
+// clientData is the CollectedClientData, see
+// https://www.w3.org/TR/webauthn-3/#dictionary-client-data
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func (rp RelyingParty) verifyClientData(clientDataJSON []byte, typ string, challenge []byte) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return fmt.Errorf("webauthn: invalid client data: %w", err)
+	}
+	if data.Type != typ {
+		return fmt.Errorf("webauthn: client data type is %q, want %q", data.Type, typ)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(data.Challenge)
+	if err != nil || len(challenge) == 0 || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return errors.New("webauthn: challenge mismatch")
+	}
+	if data.Origin != rp.Origin || data.CrossOrigin {
+		return fmt.Errorf("webauthn: origin is %q, want %q", data.Origin, rp.Origin)
+	}
+	return nil
+}
+
+// authData is the parsed authenticator data, see
+// https://www.w3.org/TR/webauthn-3/#sctn-authenticator-data
+type authData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func (rp RelyingParty) parseAuthData(b []byte) (authData, error) {
+	const headerSize = 32 + 1 + 4
+	if len(b) < headerSize {
+		return authData{}, errors.New("webauthn: authenticator data too short")
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(b[:32], rpIDHash[:]) != 1 {
+		return authData{}, errors.New("webauthn: relying party id mismatch")
+	}
+	data := authData{
+		flags:     b[32],
+		signCount: binary.BigEndian.Uint32(b[33:]),
+	}
+	if data.flags&flagUserPresent == 0 {
+		return authData{}, errors.New("webauthn: user not present")
+	}
+	if data.flags&flagUserVerified == 0 {
+		return authData{}, errors.New("webauthn: user not verified")
+	}
+
+	if data.flags&flagAttestedCredData != 0 {
+		// The AAGUID, then the length of the credential id.
+		rest := b[headerSize:]
+		if len(rest) < 16+2 {
+			return authData{}, errors.New("webauthn: attested credential data too short")
+		}
+		size := int(binary.BigEndian.Uint16(rest[16:]))
+		rest = rest[16+2:]
+		if size == 0 || size > maxCredentialIDSize || len(rest) < size {
+			return authData{}, errors.New("webauthn: invalid credential id")
+		}
+		data.credentialID = bytes.Clone(rest[:size])
+		rest = rest[size:]
+
+		// The public key is followed by the extensions, if any.
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return authData{}, fmt.Errorf("webauthn: invalid public key: %w", err)
+		}
+		data.publicKey = bytes.Clone(rest[:n])
+	}
+	return data, nil
+}
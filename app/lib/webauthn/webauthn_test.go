@@ -0,0 +1,344 @@
+package webauthn_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"go.yhsif.com/pandablog/app/lib/webauthn"
+)
+
+// authenticator is a software authenticator for the tests.
+type authenticator struct {
+	origin    string
+	rpID      string
+	id        []byte
+	signCount uint32
+	flags     byte
+
+	ecKey *ecdsa.PrivateKey
+	edKey ed25519.PrivateKey
+}
+
+func newAuthenticator(t *testing.T, alg int64, origin, rpID string) *authenticator {
+	t.Helper()
+	a := &authenticator{
+		origin: origin,
+		rpID:   rpID,
+		id:     []byte("credential-" + t.Name()),
+		// User present and verified.
+		flags: 0x01 | 0x04,
+	}
+	var err error
+	switch alg {
+	case webauthn.AlgES256:
+		a.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case webauthn.AlgEdDSA:
+		_, a.edKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("Unsupported algorithm %d", alg)
+	}
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return a
+}
+
+func (a *authenticator) clientData(typ string, challenge []byte) []byte {
+	b, _ := json.Marshal(map[string]any{
+		"type":      typ,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    a.origin,
+	})
+	return b
+}
+
+func (a *authenticator) authData(flags byte, attested []byte) []byte {
+	hash := sha256.Sum256([]byte(a.rpID))
+	b := append(hash[:], flags)
+	b = binary.BigEndian.AppendUint32(b, a.signCount)
+	return append(b, attested...)
+}
+
+func (a *authenticator) publicKey() []byte {
+	if a.edKey != nil {
+		return encodeCBOR(map[any]any{
+			int64(1):  int64(1),
+			int64(3):  int64(webauthn.AlgEdDSA),
+			int64(-1): int64(6),
+			int64(-2): []byte(a.edKey.Public().(ed25519.PublicKey)),
+		})
+	}
+	point, _ := a.ecKey.PublicKey.Bytes()
+	return encodeCBOR(map[any]any{
+		int64(1):  int64(2),
+		int64(3):  int64(webauthn.AlgES256),
+		int64(-1): int64(1),
+		int64(-2): point[1:33],
+		int64(-3): point[33:],
+	})
+}
+
+// create returns the clientDataJSON and attestationObject of
+// navigator.credentials.create().
+func (a *authenticator) create(challenge []byte) (clientDataJSON, attestationObject []byte) {
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(attested, a.id...)
+	attested = append(attested, a.publicKey()...)
+	return a.clientData("webauthn.create", challenge), encodeCBOR(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": a.authData(a.flags|0x40, attested),
+	})
+}
+
+// get returns the clientDataJSON, authenticatorData and signature of
+// navigator.credentials.get().
+func (a *authenticator) get(challenge []byte) (clientDataJSON, authenticatorData, signature []byte) {
+	clientDataJSON = a.clientData("webauthn.get", challenge)
+	authenticatorData = a.authData(a.flags, nil)
+	hash := sha256.Sum256(clientDataJSON)
+	message := append(slices.Clone(authenticatorData), hash[:]...)
+	if a.edKey != nil {
+		signature = ed25519.Sign(a.edKey, message)
+	} else {
+		digest := sha256.Sum256(message)
+		signature, _ = ecdsa.SignASN1(rand.Reader, a.ecKey, digest[:])
+	}
+	return clientDataJSON, authenticatorData, signature
+}
+
+// encodeCBOR encodes the subset of CBOR used by the tests.
+func encodeCBOR(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 1<<8:
+			return []byte{major<<5 | 24, byte(n)}
+		case n < 1<<16:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case map[any]any:
+		b := head(5, uint64(len(v)))
+		for k, v := range v {
+			b = append(b, encodeCBOR(k)...)
+			b = append(b, encodeCBOR(v)...)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+func TestRegisterLogin(t *testing.T) {
+	rp := webauthn.NewRelyingParty("https", "example.com")
+	for _, c := range []struct {
+		label string
+		alg   int64
+	}{
+		{label: "es256", alg: webauthn.AlgES256},
+		{label: "eddsa", alg: webauthn.AlgEdDSA},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			a := newAuthenticator(t, c.alg, rp.Origin, rp.ID)
+			challenge := webauthn.NewChallenge()
+			clientDataJSON, attestationObject := a.create(challenge)
+			cred, err := rp.Register(challenge, clientDataJSON, attestationObject)
+			if err != nil {
+				t.Fatalf("Register failed: %v", err)
+			}
+			if string(cred.ID) != string(a.id) {
+				t.Errorf("Credential id got %q want %q", cred.ID, a.id)
+			}
+
+			for i := range 2 {
+				a.signCount++
+				challenge := webauthn.NewChallenge()
+				clientDataJSON, authData, sig := a.get(challenge)
+				count, err := rp.Login(challenge, clientDataJSON, authData, sig, cred)
+				if err != nil {
+					t.Fatalf("Login #%d failed: %v", i, err)
+				}
+				if count != a.signCount {
+					t.Errorf("Login #%d sign count got %d want %d", i, count, a.signCount)
+				}
+				cred.SignCount = count
+			}
+		})
+	}
+}
+
+func TestLoginFailures(t *testing.T) {
+	rp := webauthn.NewRelyingParty("http", "localhost:8080")
+	if got, want := rp.ID, "localhost"; got != want {
+		t.Errorf("ID got %q want %q", got, want)
+	}
+	a := newAuthenticator(t, webauthn.AlgES256, rp.Origin, rp.ID)
+	challenge := webauthn.NewChallenge()
+	clientDataJSON, attestationObject := a.create(challenge)
+	cred, err := rp.Register(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	cred.SignCount = 5
+
+	for _, c := range []struct {
+		label string
+		// change changes the authenticator or the response before login.
+		change func(a *authenticator, clientDataJSON, authData, sig []byte) ([]byte, []byte, []byte)
+		// challenge changes the challenge expected.
+		challenge func(challenge []byte) []byte
+		err       error
+	}{
+		{
+			label: "ok",
+			change: func(a *authenticator, _, _, _ []byte) ([]byte, []byte, []byte) {
+				a.signCount = 6
+				return a.get(challenge)
+			},
+		},
+		{
+			label: "counter",
+			change: func(a *authenticator, _, _, _ []byte) ([]byte, []byte, []byte) {
+				a.signCount = 5
+				return a.get(challenge)
+			},
+			err: webauthn.ErrSignCount,
+		},
+		{
+			label: "challenge",
+			challenge: func([]byte) []byte {
+				return webauthn.NewChallenge()
+			},
+		},
+		{
+			label: "origin",
+			change: func(a *authenticator, _, _, _ []byte) ([]byte, []byte, []byte) {
+				a.origin = "http://evil.example"
+				return a.get(challenge)
+			},
+		},
+		{
+			label: "rp-id",
+			change: func(a *authenticator, _, _, _ []byte) ([]byte, []byte, []byte) {
+				a.rpID = "evil.example"
+				return a.get(challenge)
+			},
+		},
+		{
+			label: "not-verified",
+			change: func(a *authenticator, _, _, _ []byte) ([]byte, []byte, []byte) {
+				a.flags = 0x01
+				return a.get(challenge)
+			},
+		},
+		{
+			label: "signature",
+			change: func(_ *authenticator, clientDataJSON, authData, sig []byte) ([]byte, []byte, []byte) {
+				sig[len(sig)-1]++
+				return clientDataJSON, authData, sig
+			},
+		},
+		{
+			label: "other-key",
+			change: func(*authenticator, []byte, []byte, []byte) ([]byte, []byte, []byte) {
+				other := newAuthenticator(t, webauthn.AlgES256, rp.Origin, rp.ID)
+				other.signCount = 6
+				return other.get(challenge)
+			},
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			a := *a
+			a.signCount = 6
+			clientDataJSON, authData, sig := a.get(challenge)
+			if c.change != nil {
+				clientDataJSON, authData, sig = c.change(&a, clientDataJSON, authData, sig)
+			}
+			want := challenge
+			if c.challenge != nil {
+				want = c.challenge(challenge)
+			}
+			_, err := rp.Login(want, clientDataJSON, authData, sig, cred)
+			switch {
+			case c.label == "ok":
+				if err != nil {
+					t.Errorf("Login failed: %v", err)
+				}
+			case err == nil:
+				t.Error("Login succeeded, want error")
+			case c.err != nil && !errors.Is(err, c.err):
+				t.Errorf("Login got error %v want %v", err, c.err)
+			}
+		})
+	}
+}
+
+func TestRegisterFailures(t *testing.T) {
+	rp := webauthn.NewRelyingParty("https", "example.com")
+	challenge := webauthn.NewChallenge()
+	for _, c := range []struct {
+		label string
+		a     func(a *authenticator)
+	}{
+		{
+			label: "origin",
+			a: func(a *authenticator) {
+				a.origin = "https://evil.example"
+			},
+		},
+		{
+			label: "rp-id",
+			a: func(a *authenticator) {
+				a.rpID = "evil.example"
+			},
+		},
+		{
+			label: "not-present",
+			a: func(a *authenticator) {
+				a.flags = 0x04
+			},
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			a := newAuthenticator(t, webauthn.AlgES256, rp.Origin, rp.ID)
+			c.a(a)
+			clientDataJSON, attestationObject := a.create(challenge)
+			if _, err := rp.Register(challenge, clientDataJSON, attestationObject); err == nil {
+				t.Error("Register succeeded, want error")
+			}
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		a := newAuthenticator(t, webauthn.AlgES256, rp.Origin, rp.ID)
+		clientDataJSON, attestationObject := a.create(challenge)
+		for i := range attestationObject {
+			if _, err := rp.Register(challenge, clientDataJSON, attestationObject[:i]); err == nil {
+				t.Fatalf("Register succeeded with %d of %d bytes, want error", i, len(attestationObject))
+			}
+		}
+	})
+}
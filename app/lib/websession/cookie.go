@@ -0,0 +1,219 @@
+package websession
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// maxCookieSize is the size of cookies browsers are guaranteed to keep.
+const maxCookieSize = 4096
+
+// Revoker is implemented by session stores that cannot delete single
+// sessions, so logging out other sessions has to revoke all of them.
+type Revoker interface {
+	RevokeAll(ctx context.Context) error
+}
+
+// CookieStore is a stateless session store keeping the sessions encrypted in
+// the session cookies themselves, so nothing is stored on the server.
+//
+// As scs always uses the session token as the cookie value, Middleware must
+// wrap scs.SessionManager.LoadAndSave to replace the cookie value with the
+// encrypted session.
+//
+// The sessions in cookies cannot be deleted, so instead every session has a
+// generation, and RevokeAll bumps the current generation so the sessions of
+// older generations are no longer accepted.
+type CookieStore struct {
+	encrypter  Encrypter
+	cookieName string
+	generation func(ctx context.Context) (int64, error)
+	revoke     func(ctx context.Context) error
+}
+
+// NewCookieStore returns a CookieStore for the cookie named cookieName.
+//
+// generation returns the current generation, and revoke bumps it.
+func NewCookieStore(
+	encrypter Encrypter,
+	cookieName string,
+	generation func(ctx context.Context) (int64, error),
+	revoke func(ctx context.Context) error,
+) *CookieStore {
+	return &CookieStore{
+		encrypter:  encrypter,
+		cookieName: cookieName,
+		generation: generation,
+		revoke:     revoke,
+	}
+}
+
+// cookieSession is the session stored in the cookie before encryption.
+type cookieSession struct {
+	Generation int64     `json:"generation"`
+	Expire     time.Time `json:"expire"`
+	Data       []byte    `json:"data"`
+}
+
+type cookieValueKey struct{}
+
+// cookieValue is the encrypted session committed during a request, to be set
+// as the cookie value by Middleware.
+type cookieValue struct {
+	value string
+}
+
+// Find returns the data of the session encrypted in token.
+func (s *CookieStore) Find(token string) (b []byte, exists bool, err error) {
+	return s.FindCtx(context.Background(), token)
+}
+
+// FindCtx is the same as Find, except it takes a context.Context.
+func (s *CookieStore) FindCtx(ctx context.Context, token string) (b []byte, exists bool, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, false, nil
+	}
+	raw, err = s.encrypter.Decrypt(raw)
+	if err != nil {
+		// Tampered, or encrypted with another key.
+		return nil, false, nil
+	}
+	var cs cookieSession
+	if err := json.Unmarshal(raw, &cs); err != nil {
+		return nil, false, nil
+	}
+
+	generation, err := s.generation(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if cs.Generation != generation || !time.Now().Before(cs.Expire) {
+		return nil, false, nil
+	}
+	return cs.Data, true, nil
+}
+
+// Commit always fails as CookieStore needs the context set by Middleware, use
+// CommitCtx instead.
+func (s *CookieStore) Commit(token string, b []byte, expiry time.Time) error {
+	return s.CommitCtx(context.Background(), token, b, expiry)
+}
+
+// CommitCtx encrypts the session for Middleware to set as the cookie value.
+func (s *CookieStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	cv, ok := ctx.Value(cookieValueKey{}).(*cookieValue)
+	if !ok {
+		return errors.New("websession: CookieStore used without its Middleware")
+	}
+
+	generation, err := s.generation(ctx)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(cookieSession{
+		Generation: generation,
+		Expire:     expiry,
+		Data:       b,
+	})
+	if err != nil {
+		return err
+	}
+	raw, err = s.encrypter.Encrypt(raw)
+	if err != nil {
+		return err
+	}
+	cv.value = base64.RawURLEncoding.EncodeToString(raw)
+	if len(cv.value) > maxCookieSize {
+		slog.WarnContext(ctx, "Session cookie too large, browsers could drop it", "size", len(cv.value))
+	}
+	return nil
+}
+
+// Delete does nothing, as the session is in the cookie deleted by scs.
+func (s *CookieStore) Delete(token string) error {
+	return nil
+}
+
+// DeleteCtx is the same as Delete, except it takes a context.Context.
+func (s *CookieStore) DeleteCtx(ctx context.Context, token string) error {
+	return nil
+}
+
+// RevokeAll revokes all the existing sessions.
+func (s *CookieStore) RevokeAll(ctx context.Context) error {
+	return s.revoke(ctx)
+}
+
+// Middleware replaces the value of the session cookie set by
+// scs.SessionManager.LoadAndSave, which it must wrap, with the encrypted
+// session.
+func (s *CookieStore) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cv := new(cookieValue)
+		r = r.WithContext(context.WithValue(r.Context(), cookieValueKey{}, cv))
+		cw := &cookieResponseWriter{
+			ResponseWriter: w,
+			store:          s,
+			value:          cv,
+		}
+		h.ServeHTTP(cw, r)
+		cw.setCookie()
+	})
+}
+
+type cookieResponseWriter struct {
+	http.ResponseWriter
+
+	store   *CookieStore
+	value   *cookieValue
+	written bool
+}
+
+func (cw *cookieResponseWriter) Write(b []byte) (int, error) {
+	cw.setCookie()
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *cookieResponseWriter) WriteHeader(code int) {
+	cw.setCookie()
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cookieResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// setCookie replaces the value of the session cookie in the headers before
+// they are written.
+func (cw *cookieResponseWriter) setCookie() {
+	if cw.written {
+		return
+	}
+	cw.written = true
+	if cw.value.value == "" {
+		return
+	}
+
+	header := cw.Header()
+	lines := header.Values("Set-Cookie")
+	replaced := make([]string, 0, len(lines))
+	for _, line := range lines {
+		c, err := http.ParseSetCookie(line)
+		// An empty value means the cookie is being deleted.
+		if err == nil && c.Name == cw.store.cookieName && c.Value != "" {
+			c.Value = cw.value.value
+			line = c.String()
+		}
+		replaced = append(replaced, line)
+	}
+	header.Del("Set-Cookie")
+	for _, line := range replaced {
+		header.Add("Set-Cookie", line)
+	}
+}
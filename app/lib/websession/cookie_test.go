@@ -0,0 +1,158 @@
+package websession_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+
+	"go.yhsif.com/pandablog/app/lib/websession"
+)
+
+func newCookieHandler(t *testing.T, lifetime time.Duration) http.Handler {
+	t.Helper()
+
+	var generation atomic.Int64
+	en := websession.NewEncryptedStorage("82a18fbbfed2694bb15d512a70c53b1a088e669966918d3d474564b2ac44349b")
+	sessionManager := scs.New()
+	sessionManager.Lifetime = lifetime
+	store := websession.NewCookieStore(
+		en,
+		sessionManager.Cookie.Name,
+		func(context.Context) (int64, error) {
+			return generation.Load(), nil
+		},
+		func(context.Context) error {
+			generation.Add(1)
+			return nil
+		},
+	)
+	sessionManager.Store = store
+	sess := websession.New("session", sessionManager)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		sess.SetUser(r, "foo")
+		io.WriteString(w, "OK")
+	})
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		if err := sess.Logout(r); err != nil {
+			t.Errorf("Failed to logout: %v", err)
+		}
+	})
+	mux.HandleFunc("/others", func(w http.ResponseWriter, r *http.Request) {
+		if err := sess.RevokeOthers(r, ""); err != nil {
+			t.Errorf("Failed to revoke other sessions: %v", err)
+		}
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		user, _ := sess.User(r)
+		io.WriteString(w, user)
+	})
+	return store.Middleware(sessionManager.LoadAndSave(mux))
+}
+
+// get requests path with the cookie, and returns the body and the new session
+// cookie, or cookie if it was not set.
+func get(t *testing.T, h http.Handler, path string, cookie *http.Cookie) (string, *http.Cookie) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session" {
+			cookie = c
+		}
+	}
+	return w.Body.String(), cookie
+}
+
+func TestCookieStore(t *testing.T) {
+	h := newCookieHandler(t, time.Hour)
+
+	_, cookie := get(t, h, "/login", nil)
+	if cookie == nil || cookie.Value == "" {
+		t.Fatalf("No session cookie after login: %v", cookie)
+	}
+	if got, _ := get(t, h, "/user", cookie); got != "foo" {
+		t.Errorf("User got %q want %q", got, "foo")
+	}
+
+	for _, c := range []struct {
+		label string
+		value string
+	}{
+		{
+			label: "tampered",
+			value: cookie.Value[:len(cookie.Value)-2] + strings.Repeat("A", 2),
+		},
+		{
+			label: "not-base64",
+			value: "not base64!",
+		},
+		{
+			label: "token",
+			value: "Mb5y0hE2mqGqfR1XgVYnfQpLm3d7Kd8Hf5wdKTN0OHU",
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			if got, _ := get(t, h, "/user", &http.Cookie{Name: "session", Value: c.value}); got != "" {
+				t.Errorf("User got %q want none", got)
+			}
+		})
+	}
+}
+
+func TestCookieStoreLogout(t *testing.T) {
+	h := newCookieHandler(t, time.Hour)
+
+	_, first := get(t, h, "/login", nil)
+	_, second := get(t, h, "/login", nil)
+	_, renewed := get(t, h, "/logout", first)
+	if got, _ := get(t, h, "/user", renewed); got != "" {
+		t.Errorf("User after logout got %q want none", got)
+	}
+	// Other sessions, like the ones of other users, are kept.
+	if got, _ := get(t, h, "/user", second); got != "foo" {
+		t.Errorf("User of the other session after logout got %q want %q", got, "foo")
+	}
+
+	_, cookie := get(t, h, "/login", nil)
+	if got, _ := get(t, h, "/user", cookie); got != "foo" {
+		t.Errorf("User after logging in again got %q want %q", got, "foo")
+	}
+}
+
+func TestCookieStoreExpire(t *testing.T) {
+	h := newCookieHandler(t, 50*time.Millisecond)
+
+	_, cookie := get(t, h, "/login", nil)
+	time.Sleep(100 * time.Millisecond)
+	if got, _ := get(t, h, "/user", cookie); got != "" {
+		t.Errorf("User after expiry got %q want none", got)
+	}
+}
+
+func TestCookieStoreRevokeOthers(t *testing.T) {
+	h := newCookieHandler(t, time.Hour)
+
+	_, first := get(t, h, "/login", nil)
+	_, second := get(t, h, "/login", nil)
+	_, current := get(t, h, "/others", first)
+	if got, _ := get(t, h, "/user", current); got != "foo" {
+		t.Errorf("User of the current session got %q want %q", got, "foo")
+	}
+	if got, _ := get(t, h, "/user", second); got != "" {
+		t.Errorf("User of the other session got %q want none", got)
+	}
+}
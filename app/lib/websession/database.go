@@ -1,6 +1,7 @@
 package websession
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 
@@ -10,6 +11,9 @@ import (
 // SessionDatabase -
 type SessionDatabase struct {
 	Records map[string]SessionData `json:"db"`
+	// Deleted are the expiry times of the deleted sessions by their tokens,
+	// so the instances that still have them cached don't write them back.
+	Deleted map[string]time.Time `json:"deleted,omitempty"`
 }
 
 // SessionData -
@@ -19,14 +23,22 @@ type SessionData struct {
 	Expire time.Time `json:"expire"`
 }
 
+func (d SessionData) expired(now time.Time) bool {
+	return !now.Before(d.Expire)
+}
+
 // Load -
-func (sd *SessionDatabase) Load(ss Sessionstorer, en Encrypter) error {
-	b, err := ss.Load()
+func (sd *SessionDatabase) Load(ctx context.Context, ss Sessionstorer, en Encrypter) error {
+	b, err := ss.Load(ctx)
 	if err != nil {
 		return err
 	}
+	return sd.decode(b, en)
+}
 
-	b, err = en.Decrypt(b)
+// decode decrypts and unmarshals the stored data b.
+func (sd *SessionDatabase) decode(b []byte, en Encrypter) error {
+	b, err := en.Decrypt(b)
 	if err != nil {
 		return err
 	}
@@ -39,12 +51,57 @@ func (sd *SessionDatabase) Load(ss Sessionstorer, en Encrypter) error {
 	if sd.Records == nil {
 		sd.Records = make(map[string]SessionData, 0)
 	}
+	if sd.Deleted == nil {
+		sd.Deleted = make(map[string]time.Time)
+	}
 
 	return nil
 }
 
 // Save -
-func (sd *SessionDatabase) Save(ss Sessionstorer, en Encrypter) error {
+func (sd *SessionDatabase) Save(ctx context.Context, ss Sessionstorer, en Encrypter) error {
+	b, err := sd.encode(en)
+	if err != nil {
+		return err
+	}
+
+	err = ss.Save(ctx, b)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Update loads the database, changes it with fn and saves it if fn returns
+// true. When ss is an Updater, it's only saved if no one else saved it after
+// it was loaded, otherwise it's loaded and changed with fn again.
+func (sd *SessionDatabase) Update(ctx context.Context, ss Sessionstorer, en Encrypter, fn func(sd *SessionDatabase) bool) error {
+	updater, ok := ss.(Updater)
+	if !ok {
+		if err := sd.Load(ctx, ss, en); err != nil {
+			return err
+		}
+		if !fn(sd) {
+			return nil
+		}
+		return sd.Save(ctx, ss, en)
+	}
+
+	return updater.Update(ctx, func(b []byte) ([]byte, error) {
+		*sd = SessionDatabase{}
+		if err := sd.decode(b, en); err != nil {
+			return nil, err
+		}
+		if !fn(sd) {
+			return nil, nil
+		}
+		return sd.encode(en)
+	})
+}
+
+// encode marshals and encrypts the database to be stored.
+func (sd *SessionDatabase) encode(en Encrypter) ([]byte, error) {
 	var b []byte
 	var err error
 
@@ -56,18 +113,8 @@ func (sd *SessionDatabase) Save(ss Sessionstorer, en Encrypter) error {
 	}
 
 	if err != nil {
-		return err
-	}
-
-	b, err = en.Encrypt(b)
-	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = ss.Save(b)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return en.Encrypt(b)
 }
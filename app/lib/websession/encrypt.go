@@ -1,44 +1,48 @@
 package websession
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"io"
 )
 
 // Resource: https://www.melvinvivas.com/how-to-encrypt-and-decrypt-data-using-aes/
 
+const (
+	// keyIDMarker starts the encrypted data with the ID of its key. Data
+	// encrypted before keys could be rotated starts with the nonce instead.
+	keyIDMarker = 'k'
+	// keyIDSize is the size of the key IDs, see keyID.
+	keyIDSize = 4
+)
+
 // EncryptedStorage -
+//
+// Data is encrypted with the primary key, prefixed with its key ID, and can
+// be decrypted with either the primary key or one of the old keys, so keys can
+// be rotated without losing the data encrypted with the old ones.
 type EncryptedStorage struct {
 	privatekey string
+	oldkeys    []string
 }
 
-// NewEncryptedStorage -
-func NewEncryptedStorage(privatekey string) *EncryptedStorage {
+// NewEncryptedStorage returns an EncryptedStorage encrypting with privatekey,
+// and also decrypting with oldkeys. All the keys are hex encoded.
+func NewEncryptedStorage(privatekey string, oldkeys ...string) *EncryptedStorage {
 	return &EncryptedStorage{
 		privatekey: privatekey,
+		oldkeys:    oldkeys,
 	}
-
 }
 
 // Encrypt -
 func (en *EncryptedStorage) Encrypt(data []byte) ([]byte, error) {
-	// Convert key to byte array.
-	key, err := hex.DecodeString(en.privatekey)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create a new cipher block from the key.
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-
-	// Wrap the cipher block.
-	aesGCM, err := cipher.NewGCM(block)
+	aesGCM, id, err := newGCM(en.privatekey)
 	if err != nil {
 		return nil, err
 	}
@@ -49,8 +53,12 @@ func (en *EncryptedStorage) Encrypt(data []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	// Encrypt the data.
-	ciphertext := aesGCM.Seal(nonce, nonce, data, nil)
+	// Encrypt the data after the key ID and the nonce.
+	prefix := make([]byte, 0, 1+len(id)+len(nonce)+len(data)+aesGCM.Overhead())
+	prefix = append(prefix, keyIDMarker)
+	prefix = append(prefix, id...)
+	prefix = append(prefix, nonce...)
+	ciphertext := aesGCM.Seal(prefix, nonce, data, nil)
 
 	return ciphertext, nil
 }
@@ -62,35 +70,74 @@ func (en *EncryptedStorage) Decrypt(enc []byte) ([]byte, error) {
 		return []byte("{}"), nil
 	}
 
+	keys := append([]string{en.privatekey}, en.oldkeys...)
+	if len(enc) > 1+keyIDSize && enc[0] == keyIDMarker {
+		for _, key := range keys {
+			aesGCM, id, err := newGCM(key)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(id, enc[1:1+keyIDSize]) {
+				continue
+			}
+			if plaintext, err := open(aesGCM, enc[1+keyIDSize:]); err == nil {
+				return plaintext, nil
+			}
+		}
+	}
+
+	// Encrypted without the key ID, or a nonce happened to look like one.
+	for _, key := range keys {
+		aesGCM, _, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		if plaintext, err := open(aesGCM, enc); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, errors.New("websession: no key can decrypt the data")
+}
+
+// newGCM returns the AES-GCM cipher and the ID of the hex encoded key.
+func newGCM(privatekey string) (aesGCM cipher.AEAD, id []byte, err error) {
 	// Convert key to byte array.
-	key, err := hex.DecodeString(en.privatekey)
+	key, err := hex.DecodeString(privatekey)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Create a new cipher block from the key.
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Wrap the cipher block.
-	aesGCM, err := cipher.NewGCM(block)
+	aesGCM, err = cipher.NewGCM(block)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// Create a nonce.
+	return aesGCM, keyID(key), nil
+}
+
+// keyID returns the ID of key, the start of its SHA-256 hash.
+func keyID(key []byte) []byte {
+	sum := sha256.Sum256(key)
+	return sum[:keyIDSize]
+}
+
+// open decrypts enc, the nonce followed by the ciphertext.
+func open(aesGCM cipher.AEAD, enc []byte) ([]byte, error) {
 	nonceSize := aesGCM.NonceSize()
+	if len(enc) < nonceSize {
+		return nil, errors.New("websession: encrypted data too short")
+	}
 
 	// Extract the nonce from the encrypted data.
 	nonce, ciphertext := enc[:nonceSize], enc[nonceSize:]
 
 	// Decrypt the data.
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	return plaintext, nil
+	return aesGCM.Open(nil, nonce, ciphertext, nil)
 }
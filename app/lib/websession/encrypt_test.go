@@ -24,3 +24,99 @@ func TestEncrypt(t *testing.T) {
 		t.Errorf("Decrypted got %q want %q", dec, raw)
 	}
 }
+
+func TestEncryptRotate(t *testing.T) {
+	const (
+		oldKey   = "59f3726ba3f8271ddf32224b809c42e9ef4523865c74cb64e9d7d5a031f1f706"
+		newKey   = "82a18fbbfed2694bb15d512a70c53b1a088e669966918d3d474564b2ac44349b"
+		otherKey = "0000000000000000000000000000000000000000000000000000000000000000"
+	)
+	raw := []byte("hello")
+
+	encrypt := func(t *testing.T, key string) []byte {
+		t.Helper()
+		enc, err := NewEncryptedStorage(key).Encrypt(raw)
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+		return enc
+	}
+	// legacyEncrypt encrypts without the key ID, as before keys could be
+	// rotated.
+	legacyEncrypt := func(t *testing.T, key string) []byte {
+		t.Helper()
+		enc := encrypt(t, key)
+		return enc[1+keyIDSize:]
+	}
+
+	for _, c := range []struct {
+		label string
+		enc   func(t *testing.T) []byte
+		en    *EncryptedStorage
+		ok    bool
+	}{
+		{
+			label: "primary",
+			enc:   func(t *testing.T) []byte { return encrypt(t, newKey) },
+			en:    NewEncryptedStorage(newKey, oldKey),
+			ok:    true,
+		},
+		{
+			label: "old",
+			enc:   func(t *testing.T) []byte { return encrypt(t, oldKey) },
+			en:    NewEncryptedStorage(newKey, otherKey, oldKey),
+			ok:    true,
+		},
+		{
+			label: "legacy-primary",
+			enc:   func(t *testing.T) []byte { return legacyEncrypt(t, newKey) },
+			en:    NewEncryptedStorage(newKey),
+			ok:    true,
+		},
+		{
+			label: "legacy-old",
+			enc:   func(t *testing.T) []byte { return legacyEncrypt(t, oldKey) },
+			en:    NewEncryptedStorage(newKey, oldKey),
+			ok:    true,
+		},
+		{
+			label: "removed",
+			enc:   func(t *testing.T) []byte { return encrypt(t, oldKey) },
+			en:    NewEncryptedStorage(newKey),
+			ok:    false,
+		},
+		{
+			label: "legacy-removed",
+			enc:   func(t *testing.T) []byte { return legacyEncrypt(t, oldKey) },
+			en:    NewEncryptedStorage(newKey, otherKey),
+			ok:    false,
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			dec, err := c.en.Decrypt(c.enc(t))
+			if !c.ok {
+				if err == nil {
+					t.Errorf("Decrypt got %q want error", dec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to decrypt: %v", err)
+			}
+			if got, want := dec, raw; !bytes.Equal(got, want) {
+				t.Errorf("Decrypted got %q want %q", got, want)
+			}
+		})
+	}
+
+	t.Run("reencrypt", func(t *testing.T) {
+		en := NewEncryptedStorage(newKey, oldKey)
+		enc, err := en.Encrypt(raw)
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+		if _, err := NewEncryptedStorage(oldKey).Decrypt(enc); err == nil {
+			t.Error("Data encrypted with the primary key decrypted with the old key")
+		}
+	})
+}
@@ -1,28 +1,108 @@
 package websession
 
 import (
+	"context"
+	"log/slog"
+	"maps"
+	"sync"
 	"time"
 )
 
+const (
+	defaultCacheTTL      = 1 * time.Minute
+	defaultWriteDelay    = 1 * time.Second
+	defaultPurgeInterval = 1 * time.Hour
+
+	// missReloadInterval is the minimal interval between the reloads caused
+	// by tokens not in the cache, which could be created by other instances.
+	missReloadInterval = 5 * time.Second
+)
+
 // Encrypter -
 type Encrypter interface {
 	Encrypt(data []byte) (encrypted []byte, err error)
 	Decrypt(data []byte) (decrypted []byte, err error)
 }
 
-// JSONSession -
+// JSONSession is a session store keeping all the sessions in a single
+// encrypted JSON object.
+//
+// The sessions are cached in memory and reloaded when the cache is older than
+// the cache TTL. Changes are written back in the background after the write
+// delay, merged into the latest object so the changes made by other instances
+// are kept. If the Sessionstorer is an Updater, the changes saved by other
+// instances while merging are not overwritten either. Deleted sessions are
+// remembered until they expire, so other instances cannot write them back.
+// Expired sessions are removed from the object every purge interval.
+//
+// Close must be called to write back the pending changes before exiting.
 type JSONSession struct {
 	sessionstorer Sessionstorer
 	encrypter     Encrypter
+
+	cacheTTL      time.Duration
+	writeDelay    time.Duration
+	purgeInterval time.Duration
+
+	// flushLock makes sure only one flush is running.
+	flushLock sync.Mutex
+
+	lock sync.Mutex
+	// records are the cached sessions, nil before the first load.
+	records map[string]SessionData
+	// deleted are the tokens of the deleted sessions in the cache.
+	deleted map[string]time.Time
+	loaded  time.Time
+	// pending are the changes not written back yet, with nil for deletions.
+	pending map[string]*SessionData
+	// flushing are the changes being written back.
+	flushing   map[string]*SessionData
+	flushTimer *time.Timer
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// JSONSessionOption configures a JSONSession.
+type JSONSessionOption func(*JSONSession)
+
+// WithCacheTTL sets the cache TTL, default is 1m.
+func WithCacheTTL(ttl time.Duration) JSONSessionOption {
+	return func(s *JSONSession) {
+		s.cacheTTL = ttl
+	}
+}
+
+// WithWriteDelay sets the write delay, default is 1s.
+func WithWriteDelay(delay time.Duration) JSONSessionOption {
+	return func(s *JSONSession) {
+		s.writeDelay = delay
+	}
+}
+
+// WithPurgeInterval sets the purge interval, default is 1h.
+func WithPurgeInterval(interval time.Duration) JSONSessionOption {
+	return func(s *JSONSession) {
+		s.purgeInterval = interval
+	}
 }
 
 // NewJSONSession -
-func NewJSONSession(sd Sessionstorer, encrypter Encrypter) (*JSONSession, error) {
+func NewJSONSession(sd Sessionstorer, encrypter Encrypter, opts ...JSONSessionOption) (*JSONSession, error) {
 	s := &JSONSession{
 		sessionstorer: sd,
 		encrypter:     encrypter,
+		cacheTTL:      defaultCacheTTL,
+		writeDelay:    defaultWriteDelay,
+		purgeInterval: defaultPurgeInterval,
+		pending:       make(map[string]*SessionData),
+		stop:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 
+	go s.purgeLoop()
 	return s, nil
 }
 
@@ -30,14 +110,26 @@ func NewJSONSession(sd Sessionstorer, encrypter Encrypter) (*JSONSession, error)
 // session token is not found or is expired, the returned exists flag will be
 // set to false.
 func (s *JSONSession) Find(token string) (b []byte, exists bool, err error) {
-	sd := new(SessionDatabase)
-	err = sd.Load(s.sessionstorer, s.encrypter)
-	if err != nil {
+	return s.FindCtx(context.Background(), token)
+}
+
+// FindCtx is the same as Find, except it takes a context.Context.
+func (s *JSONSession) FindCtx(ctx context.Context, token string) (b []byte, exists bool, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.refresh(ctx, false); err != nil {
 		return nil, false, err
 	}
-
-	record, found := sd.Records[token]
-	if !found {
+	record, found := s.records[token]
+	if !found && time.Since(s.loaded) >= missReloadInterval {
+		// It could be created by another instance after we loaded.
+		if err := s.refresh(ctx, true); err != nil {
+			return nil, false, err
+		}
+		record, found = s.records[token]
+	}
+	if !found || record.expired(time.Now()) {
 		return nil, false, nil
 	}
 
@@ -47,26 +139,203 @@ func (s *JSONSession) Find(token string) (b []byte, exists bool, err error) {
 // Commit adds a session token and data to the store with the given expiry time.
 // If the session token already exists then the data and expiry time are updated.
 func (s *JSONSession) Commit(token string, b []byte, expiry time.Time) error {
-	sd := new(SessionDatabase)
-	err := sd.Load(s.sessionstorer, s.encrypter)
-	if err != nil {
-		return err
-	}
+	return s.CommitCtx(context.Background(), token, b, expiry)
+}
 
-	sd.Records[token] = SessionData{ID: token, Data: b, Expire: expiry}
+// CommitCtx is the same as Commit, except it takes a context.Context.
+func (s *JSONSession) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
-	return sd.Save(s.sessionstorer, s.encrypter)
+	if err := s.refresh(ctx, false); err != nil {
+		return err
+	}
+	if _, ok := s.deleted[token]; ok {
+		// Deleted by another instance, don't bring it back.
+		return nil
+	}
+	record := SessionData{ID: token, Data: b, Expire: expiry}
+	s.records[token] = record
+	s.pending[token] = &record
+	s.scheduleFlush()
+	return nil
 }
 
 // Delete removes a session token and corresponding data from the store.
 func (s *JSONSession) Delete(token string) error {
+	return s.DeleteCtx(context.Background(), token)
+}
+
+// DeleteCtx is the same as Delete, except it takes a context.Context.
+func (s *JSONSession) DeleteCtx(ctx context.Context, token string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.refresh(ctx, false); err != nil {
+		return err
+	}
+	delete(s.records, token)
+	s.pending[token] = nil
+	s.scheduleFlush()
+	return nil
+}
+
+// All returns the data of all the sessions not expired, by their tokens.
+func (s *JSONSession) All() (map[string][]byte, error) {
+	return s.AllCtx(context.Background())
+}
+
+// AllCtx is the same as All, except it takes a context.Context.
+func (s *JSONSession) AllCtx(ctx context.Context) (map[string][]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.refresh(ctx, false); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	all := make(map[string][]byte, len(s.records))
+	for token, record := range s.records {
+		if !record.expired(now) {
+			all[token] = record.Data
+		}
+	}
+	return all, nil
+}
+
+// Flush writes the pending changes back to the object now, and removes the
+// expired sessions from it.
+func (s *JSONSession) Flush(ctx context.Context) error {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+
+	s.lock.Lock()
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+		s.flushTimer = nil
+	}
+	pending := s.pending
+	s.pending = make(map[string]*SessionData)
+	s.flushing = pending
+	s.lock.Unlock()
+
 	sd := new(SessionDatabase)
-	err := sd.Load(s.sessionstorer, s.encrypter)
+	err := sd.Update(ctx, s.sessionstorer, s.encrypter, func(sd *SessionDatabase) bool {
+		applyPending(sd, pending)
+		purged := purgeExpired(sd, time.Now())
+		return len(pending) > 0 || purged > 0
+	})
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.flushing = nil
 	if err != nil {
+		// Put them back to retry later, unless they were changed again.
+		for token, record := range pending {
+			if _, ok := s.pending[token]; !ok {
+				s.pending[token] = record
+			}
+		}
+		return err
+	}
+	s.records = sd.Records
+	s.deleted = sd.Deleted
+	applyPending(sd, s.pending)
+	s.loaded = time.Now()
+	return nil
+}
+
+// Close stops the background purging and writes back the pending changes.
+func (s *JSONSession) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	return s.Flush(ctx)
+}
+
+// refresh reloads the cached sessions if they are stale, or always if force
+// is true. The changes not written back yet are kept.
+//
+// It must be called with s.lock held.
+func (s *JSONSession) refresh(ctx context.Context, force bool) error {
+	if s.records != nil && !force && time.Since(s.loaded) < s.cacheTTL {
+		return nil
+	}
+
+	sd := new(SessionDatabase)
+	if err := sd.Load(ctx, s.sessionstorer, s.encrypter); err != nil {
 		return err
 	}
+	s.records = sd.Records
+	s.deleted = sd.Deleted
+	applyPending(sd, s.flushing)
+	applyPending(sd, s.pending)
+	s.loaded = time.Now()
+	return nil
+}
 
-	delete(sd.Records, token)
+// scheduleFlush writes back the pending changes after the write delay.
+//
+// It must be called with s.lock held.
+func (s *JSONSession) scheduleFlush() {
+	if s.flushTimer != nil {
+		return
+	}
+	s.flushTimer = time.AfterFunc(s.writeDelay, func() {
+		ctx := context.Background()
+		if err := s.Flush(ctx); err != nil {
+			slog.ErrorContext(ctx, "Failed to write sessions", "err", err)
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			if len(s.pending) > 0 {
+				s.scheduleFlush()
+			}
+		}
+	})
+}
+
+func (s *JSONSession) purgeLoop() {
+	ticker := time.NewTicker(s.purgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			ctx := context.Background()
+			if err := s.Flush(ctx); err != nil {
+				slog.ErrorContext(ctx, "Failed to purge expired sessions", "err", err)
+			}
+		}
+	}
+}
+
+// applyPending applies the pending changes to sd. The deleted sessions are
+// remembered until they expire, and the changes to them are dropped.
+func applyPending(sd *SessionDatabase, pending map[string]*SessionData) {
+	for token, record := range pending {
+		if record == nil {
+			if old, ok := sd.Records[token]; ok {
+				sd.Deleted[token] = old.Expire
+				delete(sd.Records, token)
+			}
+			continue
+		}
+		if _, ok := sd.Deleted[token]; !ok {
+			sd.Records[token] = *record
+		}
+	}
+}
 
-	return sd.Save(s.sessionstorer, s.encrypter)
+// purgeExpired removes the expired sessions and deleted sessions from sd and
+// returns the number removed.
+func purgeExpired(sd *SessionDatabase, now time.Time) int {
+	n := len(sd.Records) + len(sd.Deleted)
+	maps.DeleteFunc(sd.Records, func(_ string, record SessionData) bool {
+		return record.expired(now)
+	})
+	maps.DeleteFunc(sd.Deleted, func(_ string, expire time.Time) bool {
+		return !now.Before(expire)
+	})
+	return n - len(sd.Records) - len(sd.Deleted)
 }
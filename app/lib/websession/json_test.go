@@ -1,8 +1,10 @@
 package websession_test
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -28,9 +30,9 @@ func TestNewJSONSession(t *testing.T) {
 
 	token := "abc"
 	data := "hello"
-	now := time.Now()
+	expiry := time.Now().Add(time.Hour)
 
-	if err := store.Commit(token, []byte(data), now); err != nil {
+	if err := store.Commit(token, []byte(data), expiry); err != nil {
 		t.Fatalf("Failed to commit: %v", err)
 	}
 
@@ -57,3 +59,234 @@ func TestNewJSONSession(t *testing.T) {
 		t.Errorf("store.Find returned true on exits")
 	}
 }
+
+// countingStorer counts the loads and saves.
+type countingStorer struct {
+	websession.Sessionstorer
+
+	loads atomic.Int32
+	saves atomic.Int32
+}
+
+func (c *countingStorer) Load(ctx context.Context) ([]byte, error) {
+	c.loads.Add(1)
+	return c.Sessionstorer.Load(ctx)
+}
+
+func (c *countingStorer) Save(ctx context.Context, data []byte) error {
+	c.saves.Add(1)
+	return c.Sessionstorer.Save(ctx, data)
+}
+
+func newTestStore(t *testing.T, ss websession.Sessionstorer, opts ...websession.JSONSessionOption) *websession.JSONSession {
+	t.Helper()
+	en := websession.NewEncryptedStorage("82a18fbbfed2694bb15d512a70c53b1a088e669966918d3d474564b2ac44349b")
+	store, err := websession.NewJSONSession(ss, en, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create json session: %v", err)
+	}
+	t.Cleanup(func() {
+		store.Close(context.Background())
+	})
+	return store
+}
+
+func TestJSONSessionCache(t *testing.T) {
+	ctx := context.Background()
+	ss := &countingStorer{
+		Sessionstorer: datastorage.SessionStorage{Datastorer: datastorage.NewMemoryStorage()},
+	}
+	store := newTestStore(t, ss, websession.WithWriteDelay(time.Hour))
+	expiry := time.Now().Add(time.Hour)
+
+	for _, token := range []string{"a", "b", "c"} {
+		if err := store.CommitCtx(ctx, token, []byte(token), expiry); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+		if _, exists, err := store.FindCtx(ctx, token); err != nil || !exists {
+			t.Errorf("Find(%q) got %v, %v want true, nil", token, exists, err)
+		}
+	}
+	if err := store.DeleteCtx(ctx, "c"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got, want := ss.loads.Load(), int32(1); got != want {
+		t.Errorf("Got %d loads want %d", got, want)
+	}
+	if got := ss.saves.Load(); got != 0 {
+		t.Errorf("Got %d saves before flush want 0", got)
+	}
+
+	// Another instance sharing the same storage.
+	other := newTestStore(t, ss, websession.WithWriteDelay(time.Hour))
+	if err := other.CommitCtx(ctx, "d", []byte("d"), expiry); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if err := store.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if err := other.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if got, want := ss.saves.Load(), int32(2); got != want {
+		t.Errorf("Got %d saves after flush want %d", got, want)
+	}
+
+	fresh := newTestStore(t, ss)
+	all, err := fresh.AllCtx(ctx)
+	if err != nil {
+		t.Fatalf("All failed: %v", err)
+	}
+	if len(all) != 3 || string(all["a"]) != "a" || string(all["b"]) != "b" || string(all["d"]) != "d" {
+		t.Errorf("All got %q want a, b and d", all)
+	}
+}
+
+func TestJSONSessionExpire(t *testing.T) {
+	ctx := context.Background()
+	ss := &countingStorer{
+		Sessionstorer: datastorage.SessionStorage{Datastorer: datastorage.NewMemoryStorage()},
+	}
+	store := newTestStore(t, ss, websession.WithWriteDelay(time.Hour))
+
+	now := time.Now()
+	if err := store.CommitCtx(ctx, "expired", []byte("x"), now.Add(-time.Second)); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err := store.CommitCtx(ctx, "live", []byte("y"), now.Add(time.Hour)); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if _, exists, err := store.FindCtx(ctx, "expired"); err != nil || exists {
+		t.Errorf("Find expired got %v, %v want false, nil", exists, err)
+	}
+	all, err := store.AllCtx(ctx)
+	if err != nil {
+		t.Fatalf("All failed: %v", err)
+	}
+	if _, ok := all["expired"]; ok || len(all) != 1 {
+		t.Errorf("All got %q want only live", all)
+	}
+
+	if err := store.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	var sd websession.SessionDatabase
+	if err := sd.Load(ctx, ss, websession.NewEncryptedStorage("82a18fbbfed2694bb15d512a70c53b1a088e669966918d3d474564b2ac44349b")); err != nil {
+		t.Fatalf("Failed to load session database: %v", err)
+	}
+	if _, ok := sd.Records["expired"]; ok || len(sd.Records) != 1 {
+		t.Errorf("Stored records got %v want only live", sd.Records)
+	}
+}
+
+func TestJSONSessionWriteBehind(t *testing.T) {
+	ctx := context.Background()
+	ss := &countingStorer{
+		Sessionstorer: datastorage.SessionStorage{Datastorer: datastorage.NewMemoryStorage()},
+	}
+	store := newTestStore(t, ss, websession.WithWriteDelay(time.Millisecond))
+
+	if err := store.CommitCtx(ctx, "a", []byte("a"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for ss.saves.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Changes not written back")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// racingStorer runs race once, right after the next load of the generation.
+type racingStorer struct {
+	datastorage.Datastorer
+
+	race  func()
+	armed atomic.Bool
+}
+
+func (r *racingStorer) LoadGeneration(ctx context.Context) ([]byte, string, error) {
+	b, generation, err := r.Datastorer.LoadGeneration(ctx)
+	if r.armed.CompareAndSwap(true, false) {
+		r.race()
+	}
+	return b, generation, err
+}
+
+func TestJSONSessionConcurrentFlush(t *testing.T) {
+	ctx := context.Background()
+	rs := &racingStorer{Datastorer: datastorage.NewMemoryStorage()}
+	ss := datastorage.SessionStorage{Datastorer: rs}
+	store := newTestStore(t, ss, websession.WithWriteDelay(time.Hour))
+	other := newTestStore(t, ss, websession.WithWriteDelay(time.Hour))
+	expiry := time.Now().Add(time.Hour)
+
+	if err := store.CommitCtx(ctx, "a", []byte("a"), expiry); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err := other.CommitCtx(ctx, "b", []byte("b"), expiry); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	// The other instance saves its session after store loaded the sessions,
+	// before store saves them.
+	rs.race = func() {
+		if err := other.Flush(ctx); err != nil {
+			t.Errorf("Flush failed: %v", err)
+		}
+	}
+	rs.armed.Store(true)
+	if err := store.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	fresh := newTestStore(t, ss)
+	all, err := fresh.AllCtx(ctx)
+	if err != nil {
+		t.Fatalf("All failed: %v", err)
+	}
+	if len(all) != 2 || string(all["a"]) != "a" || string(all["b"]) != "b" {
+		t.Errorf("All got %q want a and b", all)
+	}
+}
+
+func TestJSONSessionDeleted(t *testing.T) {
+	ctx := context.Background()
+	ss := datastorage.SessionStorage{Datastorer: datastorage.NewMemoryStorage()}
+	store := newTestStore(t, ss, websession.WithWriteDelay(time.Hour))
+	other := newTestStore(t, ss, websession.WithWriteDelay(time.Hour))
+	expiry := time.Now().Add(time.Hour)
+
+	if err := store.CommitCtx(ctx, "a", []byte("a"), expiry); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err := store.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if _, exists, err := other.FindCtx(ctx, "a"); err != nil || !exists {
+		t.Fatalf("Find got %v, %v want true, nil", exists, err)
+	}
+
+	// Revoked by store, while the other instance still has it cached and
+	// writes it back.
+	if err := store.DeleteCtx(ctx, "a"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if err := other.CommitCtx(ctx, "a", []byte("b"), expiry); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err := other.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	for _, s := range []*websession.JSONSession{other, newTestStore(t, ss)} {
+		if _, exists, err := s.FindCtx(ctx, "a"); err != nil || exists {
+			t.Errorf("Find got %v, %v want false, nil", exists, err)
+		}
+	}
+}
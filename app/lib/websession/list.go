@@ -0,0 +1,225 @@
+package websession
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"go.yhsif.com/ctxslog"
+)
+
+// The keys of the session info in the session data. The times are stored as
+// Unix seconds, as gob cannot encode time.Time in interfaces without
+// registering it.
+const (
+	userKey       = "user"
+	createdKey    = "created"
+	lastSeenKey   = "lastSeen"
+	ipKey         = "ip"
+	userAgentKey  = "userAgent"
+	rememberMeKey = "__rememberMe"
+)
+
+// lastSeenInterval is how often the last seen time of a session is updated, so
+// not every request writes the session.
+const lastSeenInterval = time.Minute
+
+var (
+	// ErrNotListable is returned when the session store cannot list the
+	// sessions.
+	ErrNotListable = errors.New("websession: session store cannot list the sessions")
+	// ErrNotFound is returned when there is no session with the given ID.
+	ErrNotFound = errors.New("websession: session not found")
+)
+
+// Info describes a logged in session.
+type Info struct {
+	// ID identifies the session without exposing its token.
+	ID        string
+	User      string
+	Created   time.Time
+	LastSeen  time.Time
+	IP        string
+	UserAgent string
+	Remember  bool
+	// Current is whether it's the session of the request.
+	Current bool
+}
+
+// Touch records the last seen time, IP and user agent of a logged in session.
+func (s *Session) Touch(r *http.Request) {
+	if _, ok := s.User(r); !ok {
+		return
+	}
+
+	ctx := r.Context()
+	now := time.Now()
+	var ip string
+	if addr := ctxslog.GCPRealIP(r); addr.IsValid() {
+		ip = addr.String()
+	}
+	if s.manager.GetInt64(ctx, createdKey) == 0 {
+		// Logged in before the session info was recorded.
+		s.manager.Put(ctx, createdKey, now.Unix())
+	}
+	lastSeen := time.Unix(s.manager.GetInt64(ctx, lastSeenKey), 0)
+	if now.Sub(lastSeen) < lastSeenInterval &&
+		s.manager.GetString(ctx, ipKey) == ip &&
+		s.manager.GetString(ctx, userAgentKey) == r.UserAgent() {
+		return
+	}
+	s.manager.Put(ctx, lastSeenKey, now.Unix())
+	s.manager.Put(ctx, ipKey, ip)
+	s.manager.Put(ctx, userAgentKey, r.UserAgent())
+}
+
+// Listable reports whether the session store can list the sessions.
+func (s *Session) Listable() bool {
+	switch s.manager.Store.(type) {
+	case scs.IterableStore, scs.IterableCtxStore:
+		return true
+	}
+	return false
+}
+
+// List returns the logged in sessions, most recently seen first. It returns
+// ErrNotListable if the session store cannot list the sessions.
+func (s *Session) List(r *http.Request) ([]Info, error) {
+	if !s.Listable() {
+		return nil, ErrNotListable
+	}
+
+	current := s.manager.Token(r.Context())
+	var list []Info
+	if err := s.manager.Iterate(r.Context(), func(ctx context.Context) error {
+		isCurrent := s.manager.Token(ctx) == current
+		if isCurrent {
+			// The stored one could be older than the one of the request.
+			ctx = r.Context()
+		}
+		if info, ok := s.info(ctx); ok {
+			info.Current = isCurrent
+			list = append(list, info)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(list, func(a, b Info) int {
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+	return list, nil
+}
+
+// info returns the info of the session in ctx, or false if it's not logged
+// in.
+func (s *Session) info(ctx context.Context) (Info, bool) {
+	user := s.manager.GetString(ctx, userKey)
+	if user == "" {
+		return Info{}, false
+	}
+	return Info{
+		ID:        sessionID(s.manager.Token(ctx)),
+		User:      user,
+		Created:   unixTime(s.manager.GetInt64(ctx, createdKey)),
+		LastSeen:  unixTime(s.manager.GetInt64(ctx, lastSeenKey)),
+		IP:        s.manager.GetString(ctx, ipKey),
+		UserAgent: s.manager.GetString(ctx, userAgentKey),
+		Remember:  s.manager.GetBool(ctx, rememberMeKey),
+	}, true
+}
+
+// Revoke logs out the session with the given ID, or logs out the request when
+// it's the current session. It returns ErrNotFound if there is no such
+// session.
+func (s *Session) Revoke(r *http.Request, id string) error {
+	ctx := r.Context()
+	if id == sessionID(s.manager.Token(ctx)) {
+		return s.Logout(r)
+	}
+
+	users, err := s.users(ctx)
+	if err != nil {
+		return err
+	}
+	for token := range users {
+		if sessionID(token) == id {
+			return s.deleteToken(ctx, token)
+		}
+	}
+	return ErrNotFound
+}
+
+// RevokeOthers logs out all the sessions of user except the current one, or
+// the sessions of all the users if user is empty. Stores that cannot delete a
+// single session, like CookieStore, only support all the users, otherwise it
+// returns ErrNotListable.
+func (s *Session) RevokeOthers(r *http.Request, user string) error {
+	ctx := r.Context()
+	if revoker, ok := s.manager.Store.(Revoker); ok {
+		if user != "" {
+			return ErrNotListable
+		}
+		if err := revoker.RevokeAll(ctx); err != nil {
+			return err
+		}
+		// Commit the current session again with the new generation.
+		return s.manager.RenewToken(ctx)
+	}
+
+	users, err := s.users(ctx)
+	if err != nil {
+		return err
+	}
+	current := s.manager.Token(ctx)
+	for token, u := range users {
+		if token == current || (user != "" && u != user) {
+			continue
+		}
+		if err := s.deleteToken(ctx, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// users returns the users of all the sessions by their tokens, with empty
+// users for the anonymous sessions.
+func (s *Session) users(ctx context.Context) (map[string]string, error) {
+	if !s.Listable() {
+		return nil, ErrNotListable
+	}
+	users := make(map[string]string)
+	err := s.manager.Iterate(ctx, func(ctx context.Context) error {
+		users[s.manager.Token(ctx)] = s.manager.GetString(ctx, userKey)
+		return nil
+	})
+	return users, err
+}
+
+// deleteToken deletes the session with token from the store.
+func (s *Session) deleteToken(ctx context.Context, token string) error {
+	if store, ok := s.manager.Store.(scs.CtxStore); ok {
+		return store.DeleteCtx(ctx, token)
+	}
+	return s.manager.Store.Delete(token)
+}
+
+// sessionID returns the ID of the session with token.
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
@@ -0,0 +1,130 @@
+package websession_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+
+	"go.yhsif.com/pandablog/app/lib/datastorage"
+	"go.yhsif.com/pandablog/app/lib/websession"
+)
+
+func TestSessionList(t *testing.T) {
+	store := newTestStore(t, datastorage.SessionStorage{Datastorer: datastorage.NewMemoryStorage()})
+	sessionManager := scs.New()
+	sessionManager.Lifetime = time.Hour
+	sessionManager.Store = store
+	sess := websession.New("session", sessionManager)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		user := r.FormValue("user")
+		if user == "" {
+			user = "foo"
+		}
+		sess.SetUser(r, user)
+	})
+	mux.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
+		list, err := sess.List(r)
+		if err != nil {
+			t.Errorf("Failed to list sessions: %v", err)
+		}
+		for _, info := range list {
+			io.WriteString(w, info.ID)
+			if info.Current {
+				io.WriteString(w, "*")
+			}
+			io.WriteString(w, " "+info.IP+" "+info.UserAgent+"\n")
+		}
+	})
+	mux.HandleFunc("/revoke", func(w http.ResponseWriter, r *http.Request) {
+		if err := sess.Revoke(r, r.FormValue("id")); err != nil {
+			t.Errorf("Failed to revoke session: %v", err)
+		}
+	})
+	mux.HandleFunc("/others", func(w http.ResponseWriter, r *http.Request) {
+		if err := sess.RevokeOthers(r, r.FormValue("user")); err != nil {
+			t.Errorf("Failed to revoke other sessions: %v", err)
+		}
+	})
+	h := sessionManager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess.Touch(r)
+		mux.ServeHTTP(w, r)
+	}))
+
+	do := func(path, userAgent string, cookie *http.Cookie) (string, *http.Cookie) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("User-Agent", userAgent)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		for _, c := range w.Result().Cookies() {
+			cookie = c
+		}
+		return w.Body.String(), cookie
+	}
+	lines := func(body string) []string {
+		return strings.Fields(strings.ReplaceAll(body, "\n", " | "))
+	}
+
+	// Anonymous sessions are not listed.
+	do("/anon", "anon", nil)
+	_, laptop := do("/login", "laptop", nil)
+	_, phone := do("/login", "phone", nil)
+	_, tablet := do("/login", "tablet", nil)
+	// Touch records the info on the next request.
+	do("/", "laptop", laptop)
+	do("/", "phone", phone)
+	do("/", "tablet", tablet)
+
+	body, _ := do("/list", "laptop", laptop)
+	if got := strings.Count(body, "\n"); got != 3 {
+		t.Fatalf("Listed %d sessions want 3: %q", got, body)
+	}
+	if got := strings.Count(body, "*"); got != 1 || !strings.Contains(body, "* 192.0.2.1 laptop\n") {
+		t.Errorf("Current session not marked: %q", body)
+	}
+
+	// Revoke the phone.
+	var phoneID string
+	for _, line := range strings.Split(body, "\n") {
+		if id, ok := strings.CutSuffix(line, " 192.0.2.1 phone"); ok {
+			phoneID = id
+		}
+	}
+	if phoneID == "" {
+		t.Fatalf("Phone not listed: %q", body)
+	}
+	do("/revoke?id="+phoneID, "laptop", laptop)
+	body, _ = do("/list", "laptop", laptop)
+	if strings.Contains(body, "phone") || !strings.Contains(body, "tablet") {
+		t.Errorf("Sessions after revoking the phone: %v", lines(body))
+	}
+
+	// Revoke the other sessions of foo, but not the ones of bar.
+	_, desktop := do("/login?user=bar", "desktop", nil)
+	do("/", "desktop", desktop)
+	do("/others?user=foo", "laptop", laptop)
+	body, _ = do("/list", "laptop", laptop)
+	if strings.Count(body, "\n") != 2 || !strings.Contains(body, "laptop") || !strings.Contains(body, "desktop") {
+		t.Errorf("Sessions after revoking the others of foo: %v", lines(body))
+	}
+
+	// Revoke all but the laptop.
+	do("/others", "laptop", laptop)
+	body, _ = do("/list", "laptop", laptop)
+	if strings.Count(body, "\n") != 1 || !strings.Contains(body, "laptop") {
+		t.Errorf("Sessions after revoking the others: %v", lines(body))
+	}
+	if body, _ := do("/list", "tablet", tablet); strings.Contains(body, "*") {
+		t.Errorf("Revoked tablet still logged in: %v", lines(body))
+	}
+}
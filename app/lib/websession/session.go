@@ -1,16 +1,30 @@
 package websession
 
 import (
+	"context"
 	"crypto/rand"
+	"encoding/base64"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
 )
 
 // Sessionstorer reads and writes data to an object.
 type Sessionstorer interface {
-	Save([]byte) error
-	Load() ([]byte, error)
+	Save(ctx context.Context, data []byte) error
+	Load(ctx context.Context) ([]byte, error)
+}
+
+// Updater is a Sessionstorer that can change its data without overwriting the
+// changes saved by others in the meantime.
+type Updater interface {
+	// Update calls fn with the current data and saves the data it returns,
+	// unless it's nil. If the data was saved by someone else after it was
+	// read, fn is called again with the new data.
+	Update(ctx context.Context, fn func(data []byte) ([]byte, error)) error
 }
 
 // Session stores session level information
@@ -27,25 +41,41 @@ func New(name string, manager *scs.SessionManager) *Session {
 	}
 }
 
-// RememberMe -
+// RememberMe sets whether the cookie of this session persists after the
+// browser is closed.
 func (s *Session) RememberMe(r *http.Request, value bool) {
-	s.manager.Cookie.Persist = value
+	s.manager.RememberMe(r.Context(), value)
+}
+
+// RenewToken changes the session token while keeping the session data. It must
+// be called when the privileges change, like on login, to prevent session
+// fixation.
+func (s *Session) RenewToken(r *http.Request) error {
+	return s.manager.RenewToken(r.Context())
 }
 
-// Logout -
-func (s *Session) Logout(r *http.Request) {
-	s.manager.Destroy(r.Context())
+// Logout removes all the data from the session and renews its token. With
+// stores that cannot delete a single session, like CookieStore, this only
+// replaces the cookie of the request, as revoking all the sessions would log
+// out the other users too. Use RevokeOthers to log out everywhere.
+func (s *Session) Logout(r *http.Request) error {
+	ctx := r.Context()
+	if err := s.manager.RenewToken(ctx); err != nil {
+		return err
+	}
+	return s.manager.Clear(ctx)
 }
 
 // User -
 func (s *Session) User(r *http.Request) (string, bool) {
-	u := s.manager.GetString(r.Context(), "user")
+	u := s.manager.GetString(r.Context(), userKey)
 	return u, len(u) > 0
 }
 
 // SetUser -
 func (s *Session) SetUser(r *http.Request, value string) {
-	s.manager.Put(r.Context(), "user", value)
+	s.manager.Put(r.Context(), userKey, value)
+	s.manager.Put(r.Context(), createdKey, time.Now().Unix())
 }
 
 // String -
@@ -58,11 +88,34 @@ func (s *Session) SetString(r *http.Request, name string, value string) {
 	s.manager.Put(r.Context(), name, value)
 }
 
+// maxCSRFTokens is the maximum number of CSRF tokens kept in a session, so
+// sessions stored in cookies do not grow with every page visited.
+const maxCSRFTokens = 8
+
 // SetCSRF -
 func (s *Session) SetCSRF(r *http.Request) string {
-	token := generate(32)
+	ctx := r.Context()
 	path := "csrf_" + r.URL.Path
-	s.SetString(r, path, token)
+
+	// Drop the oldest tokens of other pages over the limit.
+	var oldest string
+	var oldestIssued int64
+	n := 0
+	for _, key := range s.manager.Keys(ctx) {
+		if !strings.HasPrefix(key, "csrf_") || key == path {
+			continue
+		}
+		n++
+		if issued, _ := parseCSRF(s.String(r, key)); oldest == "" || issued < oldestIssued {
+			oldest, oldestIssued = key, issued
+		}
+	}
+	if n >= maxCSRFTokens {
+		s.manager.Remove(ctx, oldest)
+	}
+
+	token := generate(32)
+	s.SetString(r, path, strconv.FormatInt(time.Now().UnixNano(), 10)+":"+token)
 	return token
 }
 
@@ -74,7 +127,7 @@ func (s *Session) CSRF(r *http.Request) bool {
 
 	if len(v) > 0 {
 		s.manager.Remove(r.Context(), path)
-		if v == token && len(token) > 0 {
+		if _, v := parseCSRF(v); v == token && len(token) > 0 {
 			return true
 		}
 	}
@@ -82,6 +135,34 @@ func (s *Session) CSRF(r *http.Request) bool {
 	return false
 }
 
+// SetChallenge keeps the WebAuthn challenge of the page in the session, until
+// it's used by Challenge.
+func (s *Session) SetChallenge(r *http.Request, challenge []byte) {
+	s.SetString(r, "challenge_"+r.URL.Path, base64.RawURLEncoding.EncodeToString(challenge))
+}
+
+// Challenge returns the WebAuthn challenge of the page set by SetChallenge,
+// and removes it from the session so it can only be used once.
+func (s *Session) Challenge(r *http.Request) []byte {
+	v := s.manager.PopString(r.Context(), "challenge_"+r.URL.Path)
+	challenge, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil
+	}
+	return challenge
+}
+
+// parseCSRF splits a stored CSRF token into the time it was issued, in Unix
+// nanoseconds, and the token. Tokens stored without the time are issued at 0.
+func parseCSRF(v string) (issued int64, token string) {
+	before, after, found := strings.Cut(v, ":")
+	if !found {
+		return 0, v
+	}
+	issued, _ = strconv.ParseInt(before, 10, 64)
+	return issued, after
+}
+
 // Generate a token.
 // Source: https://devpy.wordpress.com/2013/10/24/create-random-string-in-golang/
 func generate(length int) string {
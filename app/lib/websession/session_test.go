@@ -51,27 +51,42 @@ func TestNewSession(t *testing.T) {
 			t.Errorf("User got %q want %q", got, want)
 		}
 
+		// Test RenewToken
+		token := sessionManager.Token(r.Context())
+		if err := sess.RenewToken(r); err != nil {
+			t.Fatalf("Failed to renew token: %v", err)
+		}
+		if got := sessionManager.Token(r.Context()); got == token {
+			t.Errorf("Token not renewed: %q", got)
+		}
+		if _, found := sess.User(r); !found {
+			t.Errorf("Did not find user after renewing token")
+		}
+
 		// Test Logout
-		sess.Logout(r)
+		token = sessionManager.Token(r.Context())
+		if err := sess.Logout(r); err != nil {
+			t.Fatalf("Failed to logout: %v", err)
+		}
 		_, found = sess.User(r)
 		if found {
 			t.Errorf("Should not find user")
 		}
+		if got := sessionManager.Token(r.Context()); got == token {
+			t.Errorf("Token not renewed on logout: %q", got)
+		}
 
-		// Test persistence
+		// Test persistence, which must only apply to this session.
+		sess.RememberMe(r, true)
 		if sessionManager.Cookie.Persist {
 			t.Error("sessionManager.Cookie.Persist should not be true")
 		}
-		sess.RememberMe(r, true)
-		if !sessionManager.Cookie.Persist {
-			t.Error("sessionManager.Cookie.Persist should not be false")
-		}
 
 		// Test CSRF
 		if got, want := sess.CSRF(r), false; got != want {
 			t.Errorf("sess.CSRF(r) got %v want %v", got, want)
 		}
-		token := sess.SetCSRF(r)
+		token = sess.SetCSRF(r)
 		r.Form = url.Values{}
 		r.Form.Set("token", token)
 		if got, want := sess.CSRF(r), true; got != want {
@@ -81,4 +96,20 @@ func TestNewSession(t *testing.T) {
 
 	mw := sessionManager.LoadAndSave(mux)
 	mw.ServeHTTP(w, r)
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge <= 0 {
+		t.Errorf("Remembered session cookie got %v want a persistent cookie", cookies)
+	}
+
+	// Another session is not remembered.
+	w = httptest.NewRecorder()
+	mw = sessionManager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess.SetUser(r, "bar")
+	}))
+	mw.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	cookies = w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge != 0 {
+		t.Errorf("Session cookie got %v want a session cookie", cookies)
+	}
 }
@@ -1,8 +1,12 @@
 package middleware
 
 import (
+	"log/slog"
 	"net/http"
 	"strings"
+
+	"go.yhsif.com/pandablog/app/lib/account"
+	"go.yhsif.com/pandablog/app/model"
 )
 
 // DisallowAuth does not allow authenticated users to access the page.
@@ -33,3 +37,78 @@ func (c *Handler) DisallowAnon(h http.Handler) http.Handler {
 		h.ServeHTTP(w, r)
 	})
 }
+
+// adminPaths are the dashboard pages, with their subpages, only admins can
+// access, besides the site settings at /dashboard.
+var adminPaths = []string{
+	"/dashboard/reload",
+	"/dashboard/styles",
+	"/dashboard/export",
+	"/dashboard/import",
+	"/dashboard/users",
+	"/dashboard/lockouts",
+}
+
+// Authorize only allows users to access the dashboard pages of their roles.
+// Admins can access all of them, while editors and authors cannot manage the
+// site, and authors can only edit their own posts.
+func (c *Handler) Authorize(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, loggedIn := c.Sess.User(r)
+		if !strings.HasPrefix(r.URL.Path, "/dashboard") || !loggedIn {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		site, err := c.Storage.Site.Load(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to load site", "err", err)
+			http.Error(w, "500 internal server error", http.StatusInternalServerError)
+			return
+		}
+		user, ok := account.Lookup(site, username)
+		if !ok {
+			// The user was deleted after logging in.
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		if !user.IsAdmin() && r.URL.Path == "/dashboard" && r.Method == http.MethodGet {
+			// Send them to the page they can use after logging in.
+			http.Redirect(w, r, "/dashboard/posts", http.StatusFound)
+			return
+		}
+		if !allowed(site, user, r.URL.Path) {
+			c.Router.Forbidden(w, r)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// allowed reports whether user can access the dashboard page at path.
+func allowed(site *model.Site, user model.UserWithName, path string) bool {
+	if user.IsAdmin() {
+		return true
+	}
+	// Don't rely on Redirect to remove the trailing slashes first.
+	path = strings.TrimRight(path, "/")
+	if path == "/dashboard" {
+		return false
+	}
+	for _, p := range adminPaths {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return false
+		}
+	}
+
+	// The pages of a post are at /dashboard/posts/:id/...
+	rest, ok := strings.CutPrefix(path, "/dashboard/posts/")
+	if id, _, _ := strings.Cut(rest, "/"); ok && id != "new" {
+		author, found := site.PostAuthor(id)
+		// Let the route show 404 for posts not found.
+		return !found || user.CanEditPost(model.Post{Author: author})
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"testing"
+
+	"go.yhsif.com/pandablog/app/model"
+)
+
+func TestAllowed(t *testing.T) {
+	site := &model.Site{
+		Posts: map[string]model.Post{
+			"own":   {Author: "alice"},
+			"other": {Author: "bob"},
+		},
+	}
+	author := model.UserWithName{User: model.User{Role: model.RoleAuthor}, Username: "alice"}
+	admin := model.UserWithName{User: model.User{Role: model.RoleAdmin}, Username: "bob"}
+	for _, c := range []struct {
+		label string
+		user  model.UserWithName
+		path  string
+		want  bool
+	}{
+		{label: "admin-settings", user: admin, path: "/dashboard", want: true},
+		{label: "settings", user: author, path: "/dashboard", want: false},
+		{label: "settings-slash", user: author, path: "/dashboard/", want: false},
+		{label: "users", user: author, path: "/dashboard/users", want: false},
+		{label: "users-slash", user: author, path: "/dashboard/users/", want: false},
+		{label: "user", user: author, path: "/dashboard/users/bob", want: false},
+		{label: "posts", user: author, path: "/dashboard/posts/", want: true},
+		{label: "own-post", user: author, path: "/dashboard/posts/own", want: true},
+		{label: "other-post", user: author, path: "/dashboard/posts/other/", want: false},
+		{label: "media", user: author, path: "/dashboard/media", want: true},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			if got := allowed(site, c.user, c.path); got != c.want {
+				t.Errorf("allowed(%q) got %v want %v", c.path, got, c.want)
+			}
+		})
+	}
+}
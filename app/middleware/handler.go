@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"go.yhsif.com/pandablog/app/lib/datastorage"
 	"go.yhsif.com/pandablog/app/lib/htmltemplate"
 	"go.yhsif.com/pandablog/app/lib/router"
 	"go.yhsif.com/pandablog/app/lib/websession"
@@ -11,16 +12,18 @@ type Handler struct {
 	Router     *router.Mux
 	Render     *htmltemplate.Engine
 	Sess       *websession.Session
+	Storage    *datastorage.Storage
 	SiteURL    string
 	SiteScheme string
 }
 
 // NewHandler -
-func NewHandler(te *htmltemplate.Engine, sess *websession.Session, mux *router.Mux, siteURL string, siteScheme string) *Handler {
+func NewHandler(te *htmltemplate.Engine, sess *websession.Session, storage *datastorage.Storage, mux *router.Mux, siteURL string, siteScheme string) *Handler {
 	return &Handler{
 		Render:     te,
 		Router:     mux,
 		Sess:       sess,
+		Storage:    storage,
 		SiteURL:    siteURL,
 		SiteScheme: siteScheme,
 	}
@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// TrackSession records the last seen time, IP and user agent of the sessions
+// of authenticated users, listed in the dashboard.
+func (c *Handler) TrackSession(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Sess.Touch(r)
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,197 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Media is an uploaded file, served at /media/<name>.
+type Media struct {
+	// Object is the name of the storage object with the file contents.
+	Object      string    `json:"object"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	Uploaded    time.Time `json:"uploaded"`
+	// Uploader is the username of the user who uploaded the file.
+	Uploader string `json:"uploader,omitempty"`
+
+	// Width and Height are the size of images, when known.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Variants are the resized variants of images, narrowest first.
+	Variants []MediaVariant `json:"variants,omitempty"`
+}
+
+// MediaVariant is a resized variant of an image.
+type MediaVariant struct {
+	Object string `json:"object"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// IsImage reports whether the media is an image.
+func (m Media) IsImage() bool {
+	return strings.HasPrefix(m.ContentType, "image/")
+}
+
+// Variant returns the variant of the given width.
+func (m Media) Variant(width int) (MediaVariant, bool) {
+	for _, v := range m.Variants {
+		if v.Width == width {
+			return v, true
+		}
+	}
+	return MediaVariant{}, false
+}
+
+// Objects returns the names of all the storage objects of the media.
+func (m Media) Objects() []string {
+	objects := []string{m.Object}
+	for _, v := range m.Variants {
+		objects = append(objects, v.Object)
+	}
+	return objects
+}
+
+// MediaWithName -
+type MediaWithName struct {
+	Media
+	Name string
+}
+
+// URL returns the path the media is served at.
+func (m MediaWithName) URL() string {
+	return "/media/" + m.Name
+}
+
+// SrcSet returns the srcset attribute of images with variants, or "" if there
+// are none.
+func (m MediaWithName) SrcSet() string {
+	if len(m.Variants) == 0 || m.Width == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, v := range m.Variants {
+		fmt.Fprintf(&sb, "%s?w=%d %dw, ", m.URL(), v.Width, v.Width)
+	}
+	fmt.Fprintf(&sb, "%s %dw", m.URL(), m.Width)
+	return sb.String()
+}
+
+// Markdown returns the Markdown snippet to use the media in a post, an image
+// for images and a link otherwise.
+func (m MediaWithName) Markdown() string {
+	if m.IsImage() {
+		return "![](" + m.URL() + ")"
+	}
+	return "[" + m.Name + "](" + m.URL() + ")"
+}
+
+// mediaTypes are the content types of the allowed media file extensions.
+var mediaTypes = map[string]string{
+	".avif": "image/avif",
+	".gif":  "image/gif",
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".svg":  "image/svg+xml",
+	".webp": "image/webp",
+	".pdf":  "application/pdf",
+	".txt":  "text/plain; charset=utf-8",
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".ogg":  "audio/ogg",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+}
+
+// MediaContentType returns the content type of the media file name, or false
+// if its extension is not allowed.
+func MediaContentType(name string) (string, bool) {
+	contentType, ok := mediaTypes[strings.ToLower(path.Ext(name))]
+	return contentType, ok
+}
+
+// CleanMediaName turns the name of an uploaded file into a media name that is
+// safe to use in URLs, by dropping any directories, lowercasing the extension
+// and replacing characters other than ASCII letters, digits, ".", "-" and "_"
+// with "-".
+func CleanMediaName(filename string) string {
+	filename = filename[strings.LastIndexAny(filename, `/\`)+1:]
+	ext := path.Ext(filename)
+	base := strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '-'
+		}
+	}, strings.TrimSuffix(filename, ext))
+	base = strings.Trim(base, ".-")
+	if base == "" {
+		base = "file"
+	}
+	return base + strings.ToLower(ext)
+}
+
+// MediaList returns all the media, newest first.
+func (s *Site) MediaList() []MediaWithName {
+	s.lock.RLock()
+	arr := make([]MediaWithName, 0, len(s.Media))
+	for k, v := range s.Media {
+		arr = append(arr, MediaWithName{Media: v, Name: k})
+	}
+	s.lock.RUnlock()
+
+	slices.SortFunc(arr, func(left, right MediaWithName) int {
+		if c := right.Uploaded.Compare(left.Uploaded); c != 0 {
+			return c
+		}
+		return strings.Compare(left.Name, right.Name)
+	})
+	return arr
+}
+
+// MediaByName returns the media with the given name.
+func (s *Site) MediaByName(name string) (Media, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	m, ok := s.Media[name]
+	return m, ok
+}
+
+// UniqueMediaName returns name, or name with a number added before its
+// extension if it's already used by another media.
+func (s *Site) UniqueMediaName(name string) string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		if _, ok := s.Media[name]; !ok {
+			return name
+		}
+		name = base + "-" + strconv.Itoa(i) + ext
+	}
+}
+
+// UpdateMedia - use nil to delete the media, otherwise add/update it.
+func (s *Site) UpdateMedia(name string, m *Media) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if m == nil {
+		delete(s.Media, name)
+		return
+	}
+	if s.Media == nil {
+		s.Media = make(map[string]Media)
+	}
+	s.Media[name] = *m
+}
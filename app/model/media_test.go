@@ -0,0 +1,104 @@
+package model_test
+
+import (
+	"testing"
+
+	"go.yhsif.com/pandablog/app/model"
+)
+
+func TestCleanMediaName(t *testing.T) {
+	for _, c := range []struct {
+		label    string
+		filename string
+		want     string
+	}{
+		{
+			label:    "simple",
+			filename: "photo.jpg",
+			want:     "photo.jpg",
+		},
+		{
+			label:    "spaces-and-case",
+			filename: "My Photo.JPG",
+			want:     "My-Photo.jpg",
+		},
+		{
+			label:    "directories",
+			filename: `C:\Users\me\..\photo.png`,
+			want:     "photo.png",
+		},
+		{
+			label:    "unicode",
+			filename: "熊猫.png",
+			want:     "file.png",
+		},
+		{
+			label:    "hidden",
+			filename: ".hidden.gif",
+			want:     "hidden.gif",
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			if got := model.CleanMediaName(c.filename); got != c.want {
+				t.Errorf("CleanMediaName(%q) got %q want %q", c.filename, got, c.want)
+			}
+		})
+	}
+}
+
+func TestMediaContentType(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"a.png", "image/png", true},
+		{"a.JPEG", "image/jpeg", true},
+		{"a.pdf", "application/pdf", true},
+		{"a.html", "", false},
+		{"a", "", false},
+	} {
+		got, ok := model.MediaContentType(c.name)
+		if got != c.want || ok != c.ok {
+			t.Errorf("MediaContentType(%q) got %q, %v want %q, %v", c.name, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestSiteMedia(t *testing.T) {
+	s := new(model.Site)
+	if got, want := s.UniqueMediaName("a.png"), "a.png"; got != want {
+		t.Errorf("UniqueMediaName on empty site got %q want %q", got, want)
+	}
+
+	s.UpdateMedia("a.png", &model.Media{ContentType: "image/png"})
+	s.UpdateMedia("a-1.png", &model.Media{ContentType: "image/png"})
+	if got, want := s.UniqueMediaName("a.png"), "a-2.png"; got != want {
+		t.Errorf("UniqueMediaName got %q want %q", got, want)
+	}
+
+	if got, want := len(s.MediaList()), 2; got != want {
+		t.Errorf("MediaList got %d media want %d", got, want)
+	}
+	s.UpdateMedia("a.png", nil)
+	if _, ok := s.MediaByName("a.png"); ok {
+		t.Error("MediaByName found deleted media")
+	}
+
+	m := model.MediaWithName{Name: "a-1.png", Media: model.Media{ContentType: "image/png"}}
+	if got, want := m.Markdown(), "![](/media/a-1.png)"; got != want {
+		t.Errorf("Markdown got %q want %q", got, want)
+	}
+	if got, want := m.SrcSet(), ""; got != want {
+		t.Errorf("SrcSet without variants got %q want %q", got, want)
+	}
+	m.Width = 1000
+	m.Variants = []model.MediaVariant{{Width: 480}, {Width: 960}}
+	if got, want := m.SrcSet(), "/media/a-1.png?w=480 480w, /media/a-1.png?w=960 960w, /media/a-1.png 1000w"; got != want {
+		t.Errorf("SrcSet got %q want %q", got, want)
+	}
+	m = model.MediaWithName{Name: "a.pdf", Media: model.Media{ContentType: "application/pdf"}}
+	if got, want := m.Markdown(), "[a.pdf](/media/a.pdf)"; got != want {
+		t.Errorf("Markdown got %q want %q", got, want)
+	}
+}
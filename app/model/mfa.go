@@ -0,0 +1,54 @@
+package model
+
+// MFA is the state of the MFA of a user.
+type MFA struct {
+	// Key is the TOTP secret enrolled in the dashboard, or "" if MFA is not
+	// enabled there.
+	Key string `json:"key,omitempty"`
+	// LastStep is the time step of the last accepted TOTP code, so it cannot
+	// be replayed.
+	LastStep int64 `json:"lastStep,omitempty"`
+	// RecoveryCodes are the hashes of the unused recovery codes generated in
+	// the dashboard.
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+	// UsedRecoveryCodes are the hashes of the used recovery codes configured
+	// by the environment variables.
+	UsedRecoveryCodes []string `json:"usedRecoveryCodes,omitempty"`
+}
+
+// UserMFA returns the MFA state of the user.
+func (s *Site) UserMFA(username string) MFA {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.MFA[username]
+}
+
+// HasMFAKeys reports whether any user enrolled MFA in the dashboard.
+func (s *Site) HasMFAKeys() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, mfa := range s.MFA {
+		if mfa.Key != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateUserMFA - use nil to delete the MFA state of the user, otherwise
+// add/update it.
+func (s *Site) UpdateUserMFA(username string, mfa *MFA) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if mfa == nil {
+		delete(s.MFA, username)
+		return
+	}
+	if s.MFA == nil {
+		s.MFA = make(map[string]MFA)
+	}
+	s.MFA[username] = *mfa
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Passkey is a WebAuthn credential a user can log in with.
+type Passkey struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	// PublicKey is in the COSE_Key format.
+	PublicKey []byte    `json:"publicKey"`
+	SignCount uint32    `json:"signCount,omitempty"`
+	Created   time.Time `json:"created"`
+	LastUsed  time.Time `json:"lastUsed,omitzero"`
+}
+
+// PasskeyWithID -
+type PasskeyWithID struct {
+	Passkey
+	// ID is the base64url encoded credential id.
+	ID string
+}
+
+// PasskeyByID returns the passkey with the base64url encoded credential id.
+func (s *Site) PasskeyByID(id string) (Passkey, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	p, ok := s.Passkeys[id]
+	return p, ok
+}
+
+// UserPasskeys returns the passkeys of the user, by the names.
+func (s *Site) UserPasskeys(username string) []PasskeyWithID {
+	s.lock.RLock()
+	var arr []PasskeyWithID
+	for k, v := range s.Passkeys {
+		if v.Username == username {
+			arr = append(arr, PasskeyWithID{Passkey: v, ID: k})
+		}
+	}
+	s.lock.RUnlock()
+
+	slices.SortFunc(arr, func(left, right PasskeyWithID) int {
+		if c := strings.Compare(left.Name, right.Name); c != 0 {
+			return c
+		}
+		return left.Created.Compare(right.Created)
+	})
+	return arr
+}
+
+// UpdatePasskey - use nil to delete the passkey, otherwise add/update it.
+func (s *Site) UpdatePasskey(id string, p *Passkey) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if p == nil {
+		delete(s.Passkeys, id)
+		return
+	}
+	if s.Passkeys == nil {
+		s.Passkeys = make(map[string]Passkey)
+	}
+	s.Passkeys[id] = *p
+}
+
+// DeleteUserPasskeys deletes all the passkeys of the user.
+func (s *Site) DeleteUserPasskeys(username string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for k, v := range s.Passkeys {
+		if v.Username == username {
+			delete(s.Passkeys, k)
+		}
+	}
+}
+
+// HasPasskeys reports whether any user has a passkey.
+func (s *Site) HasPasskeys() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return len(s.Passkeys) > 0
+}
@@ -14,10 +14,13 @@ type Post struct {
 	Updated   time.Time `json:"updated"`
 	Timestamp time.Time `json:"timestamp"`
 	Lang      string    `json:"lang"`
-	Content   string    `json:"content"`
+	Content   string    `json:"content,omitempty"`
 	Published bool      `json:"published"`
 	Page      bool      `json:"page"`
 	Tags      TagList   `json:"tags"`
+	// Author is the username of the user who created the post, empty for the
+	// posts created before there were users.
+	Author string `json:"author,omitempty"`
 }
 
 // PostWithID -
@@ -1,9 +1,11 @@
 package model
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"slices"
+	"strconv"
 	"sync"
 	"time"
 
@@ -15,6 +17,10 @@ const DefaultFooter = `Powered by [🐼](https://github.com/fishy/pandablog), th
 
 // Site -
 type Site struct {
+	// SchemaVersion is the version of the stored format of the site, see
+	// datastorage.SchemaVersion.
+	SchemaVersion int `json:"schemaVersion"`
+
 	Title             string    `json:"title"`
 	Subtitle          string    `json:"subtitle"`
 	Author            string    `json:"author"`
@@ -46,9 +52,46 @@ type Site struct {
 
 	Footer *string `json:"footer"`
 
+	// Redirects maps old paths, for example permalinks of imported posts, to
+	// the ids of the posts they should redirect to.
+	Redirects map[string]string `json:"redirects,omitempty"`
+
+	// Media are the uploaded files by their names.
+	Media map[string]Media `json:"media,omitempty"`
+
+	// SessionGeneration is bumped to revoke all the sessions stored in
+	// cookies, see websession.CookieStore.
+	SessionGeneration int64 `json:"sessionGeneration,omitempty"`
+
+	// Users are the users who can log in to the dashboard, by their
+	// usernames, besides the one configured by the environment variables.
+	Users map[string]User `json:"users,omitempty"`
+
+	// Passkeys are the WebAuthn credentials of the users, by their base64url
+	// encoded credential ids.
+	Passkeys map[string]Passkey `json:"passkeys,omitempty"`
+
+	// MFA is the state of the MFA of the users, by their usernames.
+	MFA map[string]MFA `json:"mfa,omitempty"`
+
+	// Owner are the credentials of the owner changed in the dashboard.
+	Owner OwnerCredentials `json:"owner,omitzero"`
+
+	// Tokens are the personal access tokens of the users for the API, by
+	// their hashes.
+	Tokens map[string]Token `json:"tokens,omitempty"`
+
 	lock           sync.RWMutex             `json:"-"`
 	Posts          map[string]Post          `json:"posts"`
 	emojiResources *openmoji.EmojiResources `json:"-"`
+
+	// loadContent lazily loads post contents, see SetContentLoader.
+	loadContent func(ctx context.Context, id string) (string, error) `json:"-"`
+	// loaded are the ids of the posts with their contents loaded.
+	loaded map[string]bool `json:"-"`
+	// changed are the ids of the posts added, updated or deleted by
+	// UpdatePost.
+	changed map[string]bool `json:"-"`
 }
 
 // SiteURL -
@@ -165,33 +208,93 @@ func (s *Site) Tags(onlyPublished bool) TagList {
 	return arr
 }
 
-// PostBySlug -
-func (s *Site) PostBySlug(slug string) PostWithID {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
+// SetContentLoader sets the function to lazily load the contents of posts.
+//
+// After it's set, the contents in Posts are only used for the posts updated
+// via UpdatePost, and PostByID and PostBySlug call load to get the contents
+// of other posts on first access.
+func (s *Site) SetContentLoader(load func(ctx context.Context, id string) (string, error)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.loadContent = load
+	s.loaded = make(map[string]bool)
+}
 
+// PostBySlug returns the post with the given slug, or a zero PostWithID if
+// none matches.
+func (s *Site) PostBySlug(ctx context.Context, slug string) (PostWithID, error) {
+	s.lock.RLock()
 	// FIXME: This needs to be optimized.
-	var p PostWithID
+	var id string
 	for k, v := range s.Posts {
 		if v.URL == slug {
-			p = PostWithID{
-				Post: v,
-				ID:   k,
-			}
+			id = k
 			break
 		}
 	}
+	s.lock.RUnlock()
 
-	return p
+	if id == "" {
+		return PostWithID{}, nil
+	}
+	post, ok, err := s.PostByID(ctx, id)
+	if err != nil || !ok {
+		return PostWithID{}, err
+	}
+	return PostWithID{
+		Post: post,
+		ID:   id,
+	}, nil
 }
 
-// PostByID -
-func (s *Site) PostByID(id string) (Post, bool) {
+// UniquePostSlug returns slug, or slug with a number added if it's already
+// used by another post.
+func (s *Site) UniquePostSlug(slug string) string {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
+	used := make(map[string]bool, len(s.Posts))
+	for _, v := range s.Posts {
+		used[v.URL] = true
+	}
+	base := slug
+	for i := 1; used[slug]; i++ {
+		slug = base + "-" + strconv.Itoa(i)
+	}
+	return slug
+}
+
+// PostByID returns the post with the given id, loading its content if needed.
+func (s *Site) PostByID(ctx context.Context, id string) (Post, bool, error) {
+	s.lock.RLock()
 	post, ok := s.Posts[id]
-	return post, ok
+	load := s.loadContent != nil && !s.loaded[id]
+	s.lock.RUnlock()
+
+	if !ok || !load {
+		return post, ok, nil
+	}
+
+	content, err := s.loadContent(ctx, id)
+	if err != nil {
+		return Post{}, false, fmt.Errorf("failed to load content of post %q: %w", id, err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// The post could be updated or deleted while we were loading.
+	if s.loaded[id] {
+		post, ok = s.Posts[id]
+		return post, ok, nil
+	}
+	if post, ok = s.Posts[id]; !ok {
+		return post, ok, nil
+	}
+	post.Content = content
+	s.Posts[id] = post
+	s.loaded[id] = true
+	return post, true, nil
 }
 
 // UpdatePost - use nil to delete the post, otherwise add/update it.
@@ -201,9 +304,59 @@ func (s *Site) UpdatePost(id string, post *Post) {
 
 	if post == nil {
 		delete(s.Posts, id)
+		for from, to := range s.Redirects {
+			if to == id {
+				delete(s.Redirects, from)
+			}
+		}
 	} else {
 		s.Posts[id] = *post
 	}
+	if s.loaded != nil {
+		s.loaded[id] = true
+	}
+	if s.changed == nil {
+		s.changed = make(map[string]bool)
+	}
+	s.changed[id] = true
+}
+
+// AddRedirect makes the old path from redirect to the post with the given id.
+func (s *Site) AddRedirect(from, id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.Redirects == nil {
+		s.Redirects = make(map[string]string)
+	}
+	s.Redirects[from] = id
+}
+
+// Redirect returns the post the old path redirects to.
+func (s *Site) Redirect(from string) (Post, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	id, ok := s.Redirects[from]
+	if !ok {
+		return Post{}, false
+	}
+	post, ok := s.Posts[id]
+	return post, ok
+}
+
+// ChangedPostIDs returns the ids of the posts added, updated or deleted by
+// UpdatePost, sorted.
+func (s *Site) ChangedPostIDs() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	ids := make([]string, 0, len(s.changed))
+	for id := range s.changed {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
 }
 
 // BridgyFedURL constructs bridgy fed url from BridgyFedDomain, for example
@@ -77,3 +77,42 @@ func TestSiteLastModified(t *testing.T) {
 		})
 	}
 }
+
+func TestSiteRedirect(t *testing.T) {
+	s := &model.Site{
+		Posts: make(map[string]model.Post),
+	}
+	s.UpdatePost("id", &model.Post{URL: "new"})
+	s.AddRedirect("/2020/01/02/old", "id")
+	s.AddRedirect("/gone", "missing")
+
+	if post, ok := s.Redirect("/2020/01/02/old"); !ok || post.URL != "new" {
+		t.Errorf("Redirect(old) got %q, %v want %q, true", post.URL, ok, "new")
+	}
+	if _, ok := s.Redirect("/gone"); ok {
+		t.Error("Redirect(gone) got true want false")
+	}
+	if _, ok := s.Redirect("/other"); ok {
+		t.Error("Redirect(other) got true want false")
+	}
+
+	s.UpdatePost("id", nil)
+	if got := len(s.Redirects); got != 1 {
+		t.Errorf("Redirects after deleting the post got %d want 1", got)
+	}
+}
+
+func TestSiteUniquePostSlug(t *testing.T) {
+	s := &model.Site{
+		Posts: make(map[string]model.Post),
+	}
+	if got, want := s.UniquePostSlug("a"), "a"; got != want {
+		t.Errorf("UniquePostSlug on empty site got %q want %q", got, want)
+	}
+
+	s.UpdatePost("1", &model.Post{URL: "a"})
+	s.UpdatePost("2", &model.Post{URL: "a-1"})
+	if got, want := s.UniquePostSlug("a"), "a-2"; got != want {
+		t.Errorf("UniquePostSlug got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scope is what an API token can do, besides what the role of its user
+// allows.
+type Scope string
+
+// The scopes, from the least to the most privileged.
+const (
+	// ScopeRead can read the posts, tags and site settings.
+	ScopeRead Scope = "read"
+	// ScopeWrite can also create, update and delete the posts.
+	ScopeWrite Scope = "write"
+	// ScopeAdmin can also change the site settings.
+	ScopeAdmin Scope = "admin"
+)
+
+// Scopes are all the scopes, from the least to the most privileged.
+var Scopes = []Scope{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// Valid reports whether s is one of Scopes.
+func (s Scope) Valid() bool {
+	return slices.Contains(Scopes, s)
+}
+
+// Allows reports whether s includes scope.
+func (s Scope) Allows(scope Scope) bool {
+	return s.Valid() && slices.Index(Scopes, s) >= slices.Index(Scopes, scope)
+}
+
+// Token is a personal access token of a user for the API.
+type Token struct {
+	Username string    `json:"username"`
+	Name     string    `json:"name"`
+	Scope    Scope     `json:"scope"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"lastUsed,omitzero"`
+}
+
+// TokenWithID -
+type TokenWithID struct {
+	Token
+	// ID is the hash of the token.
+	ID string
+}
+
+// TokenByID returns the token with the hash.
+func (s *Site) TokenByID(id string) (Token, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	t, ok := s.Tokens[id]
+	return t, ok
+}
+
+// UserTokens returns the tokens of the user, by the names.
+func (s *Site) UserTokens(username string) []TokenWithID {
+	s.lock.RLock()
+	var arr []TokenWithID
+	for k, v := range s.Tokens {
+		if v.Username == username {
+			arr = append(arr, TokenWithID{Token: v, ID: k})
+		}
+	}
+	s.lock.RUnlock()
+
+	slices.SortFunc(arr, func(left, right TokenWithID) int {
+		if c := strings.Compare(left.Name, right.Name); c != 0 {
+			return c
+		}
+		return left.Created.Compare(right.Created)
+	})
+	return arr
+}
+
+// UpdateToken - use nil to delete the token, otherwise add/update it.
+func (s *Site) UpdateToken(id string, t *Token) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if t == nil {
+		delete(s.Tokens, id)
+		return
+	}
+	if s.Tokens == nil {
+		s.Tokens = make(map[string]Token)
+	}
+	s.Tokens[id] = *t
+}
+
+// DeleteUserTokens deletes all the tokens of the user.
+func (s *Site) DeleteUserTokens(username string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for k, v := range s.Tokens {
+		if v.Username == username {
+			delete(s.Tokens, k)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package model_test
+
+import (
+	"testing"
+
+	"go.yhsif.com/pandablog/app/model"
+)
+
+func TestScopeAllows(t *testing.T) {
+	for _, c := range []struct {
+		scope model.Scope
+		want  model.Scope
+		ok    bool
+	}{
+		{scope: model.ScopeRead, want: model.ScopeRead, ok: true},
+		{scope: model.ScopeRead, want: model.ScopeWrite, ok: false},
+		{scope: model.ScopeWrite, want: model.ScopeRead, ok: true},
+		{scope: model.ScopeWrite, want: model.ScopeAdmin, ok: false},
+		{scope: model.ScopeAdmin, want: model.ScopeWrite, ok: true},
+		{scope: "root", want: model.ScopeRead, ok: false},
+	} {
+		if got := c.scope.Allows(c.want); got != c.ok {
+			t.Errorf("%q.Allows(%q) got %v want %v", c.scope, c.want, got, c.ok)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Role is the role of a user, deciding what they can do in the dashboard.
+type Role string
+
+// The roles, from the most to the least privileged.
+const (
+	// RoleAdmin can do everything, including managing the site and the users.
+	RoleAdmin Role = "admin"
+	// RoleEditor can edit all the posts and media.
+	RoleEditor Role = "editor"
+	// RoleAuthor can only edit their own posts and media, and upload media.
+	RoleAuthor Role = "author"
+)
+
+// Roles are all the roles, from the most to the least privileged.
+var Roles = []Role{RoleAdmin, RoleEditor, RoleAuthor}
+
+// Valid reports whether r is one of Roles.
+func (r Role) Valid() bool {
+	return slices.Contains(Roles, r)
+}
+
+// User is a user who can log in to the dashboard.
+type User struct {
+	// PasswordHash is the hash of the password in the PHC format of passhash.
+	PasswordHash string    `json:"passwordHash"`
+	DisplayName  string    `json:"displayName,omitempty"`
+	Role         Role      `json:"role"`
+	Created      time.Time `json:"created"`
+}
+
+// UserWithName -
+type UserWithName struct {
+	User
+	Username string
+}
+
+// Name returns the display name of the user, or the username if not set.
+func (u UserWithName) Name() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Username
+}
+
+// IsAdmin reports whether the user can manage the site and the users.
+func (u UserWithName) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// CanEditPost reports whether the user can edit post.
+func (u UserWithName) CanEditPost(post Post) bool {
+	switch u.Role {
+	case RoleAdmin, RoleEditor:
+		return true
+	case RoleAuthor:
+		return post.Author == u.Username
+	default:
+		return false
+	}
+}
+
+// CanEditMedia reports whether the user can rename or delete media.
+func (u UserWithName) CanEditMedia(media Media) bool {
+	switch u.Role {
+	case RoleAdmin, RoleEditor:
+		return true
+	case RoleAuthor:
+		return media.Uploader == u.Username
+	default:
+		return false
+	}
+}
+
+// ValidUsername reports whether name can be used as a username: ASCII letters,
+// digits, ".", "-" and "_".
+func ValidUsername(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// UserList returns all the users stored in the site, by username.
+func (s *Site) UserList() []UserWithName {
+	s.lock.RLock()
+	arr := make([]UserWithName, 0, len(s.Users))
+	for k, v := range s.Users {
+		arr = append(arr, UserWithName{User: v, Username: k})
+	}
+	s.lock.RUnlock()
+
+	slices.SortFunc(arr, func(left, right UserWithName) int {
+		return strings.Compare(left.Username, right.Username)
+	})
+	return arr
+}
+
+// UserByName returns the user stored in the site with the given username.
+func (s *Site) UserByName(username string) (UserWithName, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	u, ok := s.Users[username]
+	return UserWithName{User: u, Username: username}, ok
+}
+
+// AdminCount returns the number of admins stored in the site.
+func (s *Site) AdminCount() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	n := 0
+	for _, u := range s.Users {
+		if u.Role == RoleAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+// AuthorName returns the name to show for the author of post, the display
+// name of its user if it's stored in the site, or the site author otherwise.
+func (s *Site) AuthorName(post Post) string {
+	if u, ok := s.UserByName(post.Author); ok && post.Author != "" {
+		return u.Name()
+	}
+	return s.Author
+}
+
+// PostAuthor returns the username of the author of the post with id, without
+// loading its content.
+func (s *Site) PostAuthor(id string) (string, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	p, ok := s.Posts[id]
+	return p.Author, ok
+}
+
+// UpdateUser - use nil to delete the user, otherwise add/update it.
+func (s *Site) UpdateUser(username string, u *User) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if u == nil {
+		delete(s.Users, username)
+		return
+	}
+	if s.Users == nil {
+		s.Users = make(map[string]User)
+	}
+	s.Users[username] = *u
+}
+
+// OwnerCredentials are the credentials of the owner changed in the dashboard.
+// They replace the environment variables they were changed from, until those
+// change, so redeploying with new ones overrides the dashboard.
+type OwnerCredentials struct {
+	// PasswordHash replaces PBB_PASSWORD_HASH if set.
+	PasswordHash string `json:"passwordHash,omitempty"`
+	// EnvPasswordHash is PBB_PASSWORD_HASH when the password was changed.
+	EnvPasswordHash string `json:"envPasswordHash,omitempty"`
+	// MFAChanged reports whether MFA was enabled or disabled in the
+	// dashboard, replacing PBB_MFA_KEY with the key in the MFA state.
+	MFAChanged bool `json:"mfaChanged,omitempty"`
+	// EnvMFAKey is PBB_MFA_KEY when MFA was changed.
+	EnvMFAKey string `json:"envMFAKey,omitempty"`
+}
+
+// OwnerCredentials returns the credentials of the owner changed in the
+// dashboard.
+func (s *Site) OwnerCredentials() OwnerCredentials {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.Owner
+}
+
+// UpdateOwnerCredentials replaces the credentials of the owner changed in the
+// dashboard.
+func (s *Site) UpdateOwnerCredentials(creds OwnerCredentials) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Owner = creds
+}
@@ -0,0 +1,111 @@
+package model_test
+
+import (
+	"testing"
+
+	"go.yhsif.com/pandablog/app/model"
+)
+
+func TestUserCanEditPost(t *testing.T) {
+	post := model.Post{Author: "alice"}
+	for _, c := range []struct {
+		label    string
+		username string
+		role     model.Role
+		want     bool
+	}{
+		{label: "admin", username: "bob", role: model.RoleAdmin, want: true},
+		{label: "editor", username: "bob", role: model.RoleEditor, want: true},
+		{label: "author-own", username: "alice", role: model.RoleAuthor, want: true},
+		{label: "author-other", username: "bob", role: model.RoleAuthor, want: false},
+		{label: "unknown-role", username: "alice", role: "foo", want: false},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			user := model.UserWithName{
+				User:     model.User{Role: c.role},
+				Username: c.username,
+			}
+			if got := user.CanEditPost(post); got != c.want {
+				t.Errorf("CanEditPost got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestUserCanEditMedia(t *testing.T) {
+	media := model.Media{Uploader: "alice"}
+	for _, c := range []struct {
+		label    string
+		username string
+		role     model.Role
+		want     bool
+	}{
+		{label: "admin", username: "bob", role: model.RoleAdmin, want: true},
+		{label: "editor", username: "bob", role: model.RoleEditor, want: true},
+		{label: "author-own", username: "alice", role: model.RoleAuthor, want: true},
+		{label: "author-other", username: "bob", role: model.RoleAuthor, want: false},
+		{label: "unknown-role", username: "alice", role: "foo", want: false},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			user := model.UserWithName{
+				User:     model.User{Role: c.role},
+				Username: c.username,
+			}
+			if got := user.CanEditMedia(media); got != c.want {
+				t.Errorf("CanEditMedia got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestValidUsername(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		want bool
+	}{
+		{name: "", want: false},
+		{name: "alice", want: true},
+		{name: "Alice.Smith-2_b", want: true},
+		{name: "alice smith", want: false},
+		{name: "alice/bob", want: false},
+		{name: "élise", want: false},
+	} {
+		if got := model.ValidUsername(c.name); got != c.want {
+			t.Errorf("ValidUsername(%q) got %v want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSiteUsers(t *testing.T) {
+	site := &model.Site{
+		Author: "Site Author",
+		Posts: map[string]model.Post{
+			"1": {Author: "alice"},
+			"2": {Author: "bob"},
+			"3": {},
+		},
+	}
+	site.UpdateUser("alice", &model.User{DisplayName: "Alice", Role: model.RoleAdmin})
+	site.UpdateUser("bob", &model.User{Role: model.RoleAuthor})
+	site.UpdateUser("carol", &model.User{Role: model.RoleAdmin})
+	site.UpdateUser("carol", nil)
+
+	if got, want := len(site.UserList()), 2; got != want {
+		t.Errorf("UserList got %d users want %d", got, want)
+	}
+	if got, want := site.AdminCount(), 1; got != want {
+		t.Errorf("AdminCount got %d want %d", got, want)
+	}
+	for id, want := range map[string]string{
+		"1": "Alice",
+		"2": "bob",
+		"3": "Site Author",
+	} {
+		if got := site.AuthorName(site.Posts[id]); got != want {
+			t.Errorf("AuthorName of post %q got %q want %q", id, got, want)
+		}
+	}
+	if got, ok := site.PostAuthor("2"); !ok || got != "bob" {
+		t.Errorf("PostAuthor got %q, %v want %q, true", got, ok, "bob")
+	}
+}
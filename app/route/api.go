@@ -0,0 +1,542 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/way"
+
+	"go.yhsif.com/pandablog/app/lib/account"
+	"go.yhsif.com/pandablog/app/lib/router"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// API serves the JSON API at /api/v1, for the personal access tokens of the
+// users.
+type API struct {
+	*Core
+}
+
+func registerAPI(c *API) {
+	c.Router.Get("/api/v1/posts", c.auth(model.ScopeRead, c.listPosts))
+	c.Router.Post("/api/v1/posts", c.auth(model.ScopeWrite, c.createPost))
+	c.Router.Get("/api/v1/posts/:id", c.auth(model.ScopeRead, c.getPost))
+	c.Router.Put("/api/v1/posts/:id", c.auth(model.ScopeWrite, c.updatePost))
+	c.Router.Patch("/api/v1/posts/:id", c.auth(model.ScopeWrite, c.updatePost))
+	c.Router.Delete("/api/v1/posts/:id", c.auth(model.ScopeWrite, c.deletePost))
+	c.Router.Get("/api/v1/site", c.auth(model.ScopeRead, c.getSite))
+	c.Router.Put("/api/v1/site", c.auth(model.ScopeAdmin, c.updateSite))
+	c.Router.Patch("/api/v1/site", c.auth(model.ScopeAdmin, c.updateSite))
+	c.Router.Get("/api/v1/tags", c.auth(model.ScopeRead, c.listTags))
+}
+
+const (
+	// apiPrefix is the prefix of the paths of the API, which get JSON errors
+	// instead of the error pages.
+	apiPrefix = "/api/"
+
+	// maxAPIBody is the maximum size of the request bodies of the API.
+	maxAPIBody = 10 << 20
+
+	// tokenUseInterval is how often the last use of a token is saved, to
+	// avoid saving the site on every request.
+	tokenUseInterval = time.Hour
+
+	// dateFormat is the format of the published dates of the posts.
+	dateFormat = "2006-01-02"
+)
+
+// errNotAdmin is returned when a user who is not an admin accesses the site
+// settings.
+var errNotAdmin = errors.New("only admins can access the site settings")
+
+// apiHandlerFunc is an API handler for the user of the token of the request.
+type apiHandlerFunc func(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName) (status int, err error)
+
+// auth authenticates the request with a token in the Authorization header
+// that allows scope, and calls fn with the user of the token.
+func (c *API) auth(scope model.Scope, fn apiHandlerFunc) router.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) (status int, err error) {
+		site, err := c.Storage.Site.Load(r.Context())
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		t, user, ok := c.authenticateToken(r, site, bearerToken(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			return http.StatusUnauthorized, nil
+		}
+		if !t.Scope.Allows(scope) {
+			return http.StatusForbidden, fmt.Errorf("the token needs the %s scope", scope)
+		}
+
+		return fn(w, r, site, user)
+	}
+}
+
+// bearerToken returns the token in the Authorization header of the request,
+// or "" if there isn't one.
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticateToken returns the API token and its user if token is stored in
+// site, and saves when the token was last used.
+func (c *Core) authenticateToken(r *http.Request, site *model.Site, token string) (model.TokenWithID, model.UserWithName, bool) {
+	t, user, ok := account.AuthenticateToken(site, token)
+	if !ok {
+		return t, user, false
+	}
+
+	if time.Since(t.LastUsed) >= tokenUseInterval {
+		err := c.Storage.Update(r.Context(), func(site *model.Site) error {
+			stored, ok := site.TokenByID(t.ID)
+			if !ok {
+				return errNotFound
+			}
+			stored.LastUsed = time.Now()
+			site.UpdateToken(t.ID, &stored)
+			return nil
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to save the last use of the token", "err", err, "username", user.Username)
+		}
+	}
+	return t, user, true
+}
+
+// writeJSON writes v as the response with status.
+func writeJSON(w http.ResponseWriter, status int, v any) (int, error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	return status, json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes the error response of the API, with the message of err
+// for the client errors.
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	msg := strings.ToLower(http.StatusText(status))
+	switch {
+	case errors.Is(err, errEditConflict):
+		// The message of errEditConflict is about the dashboard.
+		msg = "changed by someone else after the updated time in the request"
+	case err != nil && status < http.StatusInternalServerError:
+		msg = err.Error()
+	}
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// readBody reads the JSON request body, to decode it again in every attempt
+// of Storage.Update.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("%w: the body is not valid JSON", errInvalidRequest)
+	}
+	return body, nil
+}
+
+// apiPost is a post in the API.
+type apiPost struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Slug      string `json:"slug"`
+	Canonical string `json:"canonical"`
+	// Date is the published date, like "2006-01-02".
+	Date      string   `json:"date"`
+	Lang      string   `json:"lang"`
+	Content   string   `json:"content,omitempty"`
+	Tags      []string `json:"tags"`
+	Page      bool     `json:"page"`
+	Published bool     `json:"published"`
+
+	// The fields below cannot be changed.
+	URL     string    `json:"url"`
+	Author  string    `json:"author,omitempty"`
+	Created time.Time `json:"created"`
+	// Updated is checked to be unchanged when updating the post, if sent.
+	Updated time.Time `json:"updated"`
+
+	// SkipWebmention skips sending the Bridgy Fed webmention after
+	// publishing the post.
+	SkipWebmention bool `json:"skipWebmention,omitempty"`
+}
+
+// newAPIPost returns the post with id in the API, without the content unless
+// withContent.
+func newAPIPost(site *model.Site, id string, p model.Post, withContent bool) apiPost {
+	tags := make([]string, 0, len(p.Tags))
+	for _, t := range p.Tags {
+		tags = append(tags, t.Name)
+	}
+	post := apiPost{
+		ID:        id,
+		Title:     p.Title,
+		Slug:      p.URL,
+		Canonical: p.Canonical,
+		Date:      p.Timestamp.Format(dateFormat),
+		Lang:      p.Lang,
+		Tags:      tags,
+		Page:      p.Page,
+		Published: p.Published,
+		URL:       site.SiteURL(&p),
+		Author:    p.Author,
+		Created:   p.Created,
+		Updated:   p.Updated,
+	}
+	if withContent {
+		post.Content = p.Content
+	}
+	return post
+}
+
+// apply sets the fields of in that can be changed to p.
+func (in apiPost) apply(p *model.Post) error {
+	ts, err := time.Parse(dateFormat, in.Date)
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: the date must be like %q", errInvalidRequest, dateFormat)
+	case strings.TrimSpace(in.Title) == "":
+		return fmt.Errorf("%w: the title is required", errInvalidRequest)
+	case strings.TrimSpace(in.Slug) == "":
+		return fmt.Errorf("%w: the slug is required", errInvalidRequest)
+	}
+	p.Title = in.Title
+	p.URL = in.Slug
+	p.Canonical = in.Canonical
+	p.Timestamp = ts
+	p.Lang = in.Lang
+	p.Content = in.Content
+	p.Tags = p.Tags.Split(strings.Join(in.Tags, ","))
+	p.Page = in.Page
+	p.Published = in.Published
+	return nil
+}
+
+// canEditPost returns the status to respond if user cannot access the post
+// with id, or 0 if they can.
+func canEditPost(site *model.Site, user model.UserWithName, id string) int {
+	author, ok := site.PostAuthor(id)
+	switch {
+	case !ok:
+		return http.StatusNotFound
+	case !user.CanEditPost(model.Post{Author: author}):
+		return http.StatusForbidden
+	}
+	return 0
+}
+
+// listPosts lists the posts the user can edit, without their contents,
+// optionally only the ones with the tag in the query.
+func (c *API) listPosts(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName) (status int, err error) {
+	tag := r.URL.Query().Get("tag")
+	posts := make([]apiPost, 0)
+	for _, p := range site.PostsAndPages(false) {
+		if !user.CanEditPost(p.Post) {
+			continue
+		}
+		if tag != "" && !slices.ContainsFunc(p.Tags, func(t model.Tag) bool {
+			return strings.EqualFold(t.Name, tag)
+		}) {
+			continue
+		}
+		posts = append(posts, newAPIPost(site, p.ID, p.Post, false))
+	}
+	return writeJSON(w, http.StatusOK, map[string]any{"posts": posts})
+}
+
+func (c *API) getPost(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName) (status int, err error) {
+	id := way.Param(r.Context(), "id")
+	if status := canEditPost(site, user, id); status != 0 {
+		return status, nil
+	}
+	p, ok, err := site.PostByID(r.Context(), id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !ok {
+		return http.StatusNotFound, nil
+	}
+	return writeJSON(w, http.StatusOK, newAPIPost(site, id, p, true))
+}
+
+func (c *API) createPost(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName) (status int, err error) {
+	body, err := readBody(w, r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	now := time.Now()
+	in := apiPost{Date: now.Format(dateFormat)}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+	p := model.Post{
+		Author:  user.Username,
+		Created: now,
+		Updated: now,
+	}
+	if err := in.apply(&p); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = c.Storage.Update(r.Context(), func(s *model.Site) error {
+		site = s
+		site.UpdatePost(id.String(), &p)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	if p.Published && site.BridgyFedDomain != "" && !in.SkipWebmention {
+		sendBridgyFedWebmention(r.Context(), p, site)
+	}
+
+	w.Header().Set("Location", "/api/v1/posts/"+id.String())
+	return writeJSON(w, http.StatusCreated, newAPIPost(site, id.String(), p, true))
+}
+
+// updatePost changes the fields of the post in the request body, and keeps
+// the ones left out.
+func (c *API) updatePost(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName) (status int, err error) {
+	id := way.Param(r.Context(), "id")
+	if status := canEditPost(site, user, id); status != 0 {
+		return status, nil
+	}
+	body, err := readBody(w, r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	var p model.Post
+	var skipWebmention bool
+	err = c.Storage.Update(r.Context(), func(s *model.Site) error {
+		site = s
+		var ok bool
+		var err error
+		p, ok, err = site.PostByID(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errNotFound
+		}
+
+		in := newAPIPost(site, id, p, true)
+		if err := json.Unmarshal(body, &in); err != nil {
+			return fmt.Errorf("%w: %w", errInvalidRequest, err)
+		}
+		if !in.Updated.Equal(p.Updated) {
+			return errEditConflict
+		}
+		if err := in.apply(&p); err != nil {
+			return err
+		}
+		skipWebmention = in.SkipWebmention
+		p.Updated = time.Now()
+
+		site.UpdatePost(id, &p)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	if p.Published && site.BridgyFedDomain != "" && !skipWebmention {
+		sendBridgyFedWebmention(r.Context(), p, site)
+	}
+
+	return writeJSON(w, http.StatusOK, newAPIPost(site, id, p, true))
+}
+
+func (c *API) deletePost(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName) (status int, err error) {
+	id := way.Param(r.Context(), "id")
+	if status := canEditPost(site, user, id); status != 0 {
+		return status, nil
+	}
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		if _, ok, err := site.PostByID(r.Context(), id); err != nil {
+			return err
+		} else if !ok {
+			return errNotFound
+		}
+
+		site.UpdatePost(id, nil)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return http.StatusNoContent, nil
+}
+
+// apiSite are the site settings in the API, the ones on the dashboard.
+type apiSite struct {
+	Title            string  `json:"title"`
+	Subtitle         string  `json:"subtitle"`
+	Author           string  `json:"author"`
+	FediCreator      string  `json:"fediCreator"`
+	Description      string  `json:"description"`
+	Scheme           string  `json:"scheme"`
+	Domain           string  `json:"domain"`
+	HomeURL          string  `json:"homeURL"`
+	LoginURL         string  `json:"loginURL"`
+	GoogleAnalytics  string  `json:"googleAnalytics"`
+	Disqus           string  `json:"disqus"`
+	Cactus           string  `json:"cactus"`
+	BridgyFedDomain  string  `json:"bridgyFedDomain"`
+	BridgyFedWeb     string  `json:"bridgyFedWeb"`
+	WebmentionDomain string  `json:"webmentionDomain"`
+	IndieLoginURI    string  `json:"indieLoginURI"`
+	ISODate          bool    `json:"isoDate"`
+	Lang             string  `json:"lang"`
+	Content          string  `json:"content"`
+	Footer           *string `json:"footer"`
+
+	// Updated cannot be changed, and is checked to be unchanged when updating
+	// the settings, if sent.
+	Updated time.Time `json:"updated"`
+}
+
+func newAPISite(site *model.Site) apiSite {
+	return apiSite{
+		Title:            site.Title,
+		Subtitle:         site.Subtitle,
+		Author:           site.Author,
+		FediCreator:      site.FediCreator,
+		Description:      site.Description,
+		Scheme:           site.Scheme,
+		Domain:           site.URL,
+		HomeURL:          site.HomeURL,
+		LoginURL:         site.LoginURL,
+		GoogleAnalytics:  site.GoogleAnalyticsID,
+		Disqus:           site.DisqusID,
+		Cactus:           site.CactusSiteName,
+		BridgyFedDomain:  site.BridgyFedDomain,
+		BridgyFedWeb:     site.BridgyFedWeb,
+		WebmentionDomain: site.WebmentionDomain,
+		IndieLoginURI:    site.IndieLoginURI,
+		ISODate:          site.ISODate,
+		Lang:             site.Lang,
+		Content:          site.Content,
+		Footer:           site.Footer,
+		Updated:          site.Updated,
+	}
+}
+
+// apply sets the settings of in to site.
+func (in apiSite) apply(site *model.Site) {
+	site.Title = in.Title
+	site.Subtitle = in.Subtitle
+	site.Author = in.Author
+	site.FediCreator = in.FediCreator
+	site.Description = in.Description
+	site.Scheme = in.Scheme
+	site.URL = in.Domain
+	site.HomeURL = in.HomeURL
+	site.LoginURL = in.LoginURL
+	site.GoogleAnalyticsID = in.GoogleAnalytics
+	site.DisqusID = in.Disqus
+	site.CactusSiteName = in.Cactus
+	site.BridgyFedDomain = in.BridgyFedDomain
+	site.BridgyFedWeb = in.BridgyFedWeb
+	site.WebmentionDomain = in.WebmentionDomain
+	site.IndieLoginURI = in.IndieLoginURI
+	site.ISODate = in.ISODate
+	site.Lang = in.Lang
+	site.Content = in.Content
+	site.Footer = in.Footer
+}
+
+func (c *API) getSite(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName) (status int, err error) {
+	if !user.IsAdmin() {
+		return http.StatusForbidden, errNotAdmin
+	}
+	return writeJSON(w, http.StatusOK, newAPISite(site))
+}
+
+// updateSite changes the settings in the request body, and keeps the ones
+// left out.
+func (c *API) updateSite(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName) (status int, err error) {
+	if !user.IsAdmin() {
+		return http.StatusForbidden, errNotAdmin
+	}
+	body, err := readBody(w, r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	err = c.Storage.Update(r.Context(), func(s *model.Site) error {
+		site = s
+		in := newAPISite(site)
+		if err := json.Unmarshal(body, &in); err != nil {
+			return fmt.Errorf("%w: %w", errInvalidRequest, err)
+		}
+		if !in.Updated.Equal(site.Updated) {
+			return errEditConflict
+		}
+		in.apply(site)
+
+		site.Update()
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	return writeJSON(w, http.StatusOK, newAPISite(site))
+}
+
+// apiTag is a tag in the API, with the number of its posts.
+type apiTag struct {
+	Name  string `json:"name"`
+	Posts int    `json:"posts"`
+}
+
+// listTags lists the tags of the posts the user can edit.
+func (c *API) listTags(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName) (status int, err error) {
+	counts := make(map[string]int)
+	var tags model.TagList
+	for _, p := range site.PostsAndPages(false) {
+		if !user.CanEditPost(p.Post) {
+			continue
+		}
+		for _, t := range p.Tags {
+			if counts[t.Name] == 0 {
+				tags = append(tags, t)
+			}
+			counts[t.Name]++
+		}
+	}
+	slices.SortFunc(tags, func(left, right model.Tag) int {
+		return left.Compare(right)
+	})
+
+	arr := make([]apiTag, 0, len(tags))
+	for _, t := range tags {
+		arr = append(arr, apiTag{Name: t.Name, Posts: counts[t.Name]})
+	}
+	return writeJSON(w, http.StatusOK, map[string]any{"tags": arr})
+}
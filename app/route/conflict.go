@@ -0,0 +1,60 @@
+package route
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go.yhsif.com/pandablog/app/lib/datastorage"
+)
+
+var (
+	// errEditConflict is returned when the object being edited was changed by
+	// someone else after the edit page was loaded.
+	errEditConflict = errors.New("changed by someone else after the edit page was loaded")
+
+	// errNotFound is returned by update functions when the object being
+	// updated does not exist.
+	errNotFound = errors.New("not found")
+
+	// errInvalidRequest is returned by update functions when the request
+	// cannot be applied to the object being updated.
+	errInvalidRequest = errors.New("invalid request")
+)
+
+// updatedFormValue formats t to be used as the "updated" form value in edit
+// pages.
+func updatedFormValue(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// checkUnmodified returns errEditConflict if the "updated" form value, which
+// was set by the edit page, no longer matches updated.
+//
+// Requests without the form value are not checked.
+func checkUnmodified(r *http.Request, updated time.Time) error {
+	v := r.FormValue("updated")
+	if v == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil || !t.Equal(updated) {
+		return errEditConflict
+	}
+	return nil
+}
+
+// updateErrorStatus returns the http status code for an error returned by
+// Storage.Update.
+func updateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errInvalidRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, errEditConflict), errors.Is(err, datastorage.ErrConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -12,26 +12,30 @@ import (
 	"go.yhsif.com/pandablog/app/lib/datastorage"
 	"go.yhsif.com/pandablog/app/lib/htmltemplate"
 	"go.yhsif.com/pandablog/app/lib/router"
+	"go.yhsif.com/pandablog/app/lib/throttle"
 	"go.yhsif.com/pandablog/app/lib/websession"
 	"go.yhsif.com/pandablog/assets"
 )
 
 // Core -
 type Core struct {
-	Router  *router.Mux
-	Storage *datastorage.Storage
-	Render  *htmltemplate.Engine
-	Sess    *websession.Session
+	Router   *router.Mux
+	Storage  *datastorage.Storage
+	Render   *htmltemplate.Engine
+	Sess     *websession.Session
+	Throttle *throttle.Throttle
 }
 
-// Register all routes.
-func Register(storage *datastorage.Storage, sess *websession.Session, tmpl *htmltemplate.Engine, b blocklist.Blocklist) (*Core, error) {
+// Register all routes. The failed login attempts are also kept in
+// throttleStore if it's not nil.
+func Register(storage *datastorage.Storage, sess *websession.Session, tmpl *htmltemplate.Engine, b blocklist.Blocklist, throttleStore throttle.Store) (*Core, error) {
 	// Create core app.
 	c := &Core{
-		Router:  setupRouter(tmpl, b),
-		Storage: storage,
-		Render:  tmpl,
-		Sess:    sess,
+		Router:   setupRouter(tmpl, b),
+		Storage:  storage,
+		Render:   tmpl,
+		Sess:     sess,
+		Throttle: throttle.New(loginThrottleRules, throttleStore),
 	}
 
 	// Register routes.
@@ -45,6 +49,18 @@ func Register(storage *datastorage.Storage, sess *websession.Session, tmpl *html
 	registerAuthUtil(&AuthUtil{c})
 	registerXMLUtil(&XMLUtil{c})
 	registerAdminPost(&AdminPost{c})
+	registerRevision(&Revision{c})
+	registerExport(&Export{c})
+	registerImport(&Import{c})
+	registerMedia(&Media{c})
+	registerSessions(&Sessions{c})
+	registerUsers(&Users{c})
+	registerPasskeys(&Passkeys{c})
+	registerTokens(&Tokens{c})
+	registerSecurity(&Security{c})
+	registerLockouts(&Lockouts{c})
+	registerAPI(&API{c})
+	registerMicropub(&Micropub{c})
 	registerPost(&Post{c}, site.HomeURL)
 
 	c.registerBridyFedRedirect()
@@ -55,18 +71,29 @@ func Register(storage *datastorage.Storage, sess *websession.Session, tmpl *html
 func setupRouter(tmpl *htmltemplate.Engine, b blocklist.Blocklist) *router.Mux {
 	// Set the handling of all responses.
 	customServeHTTP := func(w http.ResponseWriter, r *http.Request, status int, err error) {
-		// Handle only errors.
-		if status >= 400 {
+		// Handle only errors, in JSON for the API and Micropub.
+		if status >= 400 && isMicropub(r.URL.Path) {
+			writeMicropubError(w, status, err)
+		} else if status >= 400 && strings.HasPrefix(r.URL.Path, apiPrefix) {
+			writeAPIError(w, status, err)
+		} else if status >= 400 {
 			vars := make(map[string]any)
 			vars["title"] = fmt.Sprint(status)
 			errTemplate := "400"
-			if status == 404 {
+			switch status {
+			case http.StatusNotFound:
 				if b.CheckAfter(w, r, http.StatusNotFound, nil) {
 					return
 				}
 				errTemplate = "404"
+			case http.StatusForbidden:
+				errTemplate = "403"
+			case http.StatusConflict:
+				errTemplate = "409"
+			case http.StatusTooManyRequests:
+				errTemplate = "429"
 			}
-			status, err = tmpl.ErrorTemplate(w, r, "base", errTemplate, vars)
+			status, err = tmpl.ErrorTemplate(w, r, status, "base", errTemplate, vars)
 			if err != nil {
 				slog.ErrorContext(r.Context(), "Internal server error", "err", err)
 				http.Error(w, "500 internal server error", http.StatusInternalServerError)
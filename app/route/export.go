@@ -0,0 +1,41 @@
+package route
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.yhsif.com/pandablog/app/lib/export"
+)
+
+// Export -
+type Export struct {
+	*Core
+}
+
+func registerExport(c *Export) {
+	c.Router.Get("/dashboard/export", c.download)
+}
+
+// download sends the whole site as a zip archive of Markdown files.
+func (c *Export) download(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// Write to a buffer first so errors can still be reported properly.
+	var buf bytes.Buffer
+	if err := export.Zip(r.Context(), &buf, site); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	filename := fmt.Sprintf("pandablog-%s.zip", time.Now().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+	return http.StatusOK, nil
+}
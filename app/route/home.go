@@ -1,6 +1,7 @@
 package route
 
 import (
+	"log/slog"
 	"net/http"
 
 	"go.yhsif.com/pandablog/app/model"
@@ -57,6 +58,19 @@ func (c *HomePost) edit(w http.ResponseWriter, r *http.Request) (status int, err
 	vars["ptitle"] = site.Title
 	vars["subtitle"] = site.Subtitle
 	vars["token"] = c.Sess.SetCSRF(r)
+	vars["updated"] = updatedFormValue(site.Updated)
+
+	lockouts, err := c.Throttle.List(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load the failed login attempts", "err", err)
+	}
+	var locked int
+	for _, l := range lockouts {
+		if l.Locked {
+			locked++
+		}
+	}
+	vars["locked"] = locked
 
 	// Help the user set the domain based off the current URL.
 	if site.URL == "" {
@@ -94,38 +108,38 @@ func (c *HomePost) update(w http.ResponseWriter, r *http.Request) (status int, e
 		return http.StatusBadRequest, nil
 	}
 
-	site, err := c.Storage.Site.Load(r.Context())
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
-
-	site.Title = r.FormValue("title")
-	site.Subtitle = r.FormValue("subtitle")
-	site.URL = r.FormValue("domain")
-	site.Content = r.FormValue("content")
-	site.Scheme = r.FormValue("scheme")
-	site.Author = r.FormValue("author")
-	site.FediCreator = r.FormValue("fedicreator")
-	site.Description = r.FormValue("pdescription")
-	site.LoginURL = r.FormValue("loginurl")
-	site.HomeURL = r.FormValue("homeurl")
-	site.GoogleAnalyticsID = r.FormValue("googleanalytics")
-	site.DisqusID = r.FormValue("disqus")
-	site.CactusSiteName = r.FormValue("cactus")
-	site.BridgyFedDomain = r.FormValue("bridgy_fed_domain")
-	site.BridgyFedWeb = r.FormValue("bridgy_fed_web")
-	site.WebmentionDomain = r.FormValue("webmention_domain")
-	site.IndieLoginURI = r.FormValue("indie_login_uri")
-	site.ISODate = (r.FormValue("isodate") == "on")
-	site.Lang = r.FormValue("lang")
-	footer := r.FormValue("footer")
-	site.Footer = &footer
-
-	site.Update()
-
-	err = c.Storage.Save(site)
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		if err := checkUnmodified(r, site.Updated); err != nil {
+			return err
+		}
+
+		site.Title = r.FormValue("title")
+		site.Subtitle = r.FormValue("subtitle")
+		site.URL = r.FormValue("domain")
+		site.Content = r.FormValue("content")
+		site.Scheme = r.FormValue("scheme")
+		site.Author = r.FormValue("author")
+		site.FediCreator = r.FormValue("fedicreator")
+		site.Description = r.FormValue("pdescription")
+		site.LoginURL = r.FormValue("loginurl")
+		site.HomeURL = r.FormValue("homeurl")
+		site.GoogleAnalyticsID = r.FormValue("googleanalytics")
+		site.DisqusID = r.FormValue("disqus")
+		site.CactusSiteName = r.FormValue("cactus")
+		site.BridgyFedDomain = r.FormValue("bridgy_fed_domain")
+		site.BridgyFedWeb = r.FormValue("bridgy_fed_web")
+		site.WebmentionDomain = r.FormValue("webmention_domain")
+		site.IndieLoginURI = r.FormValue("indie_login_uri")
+		site.ISODate = (r.FormValue("isodate") == "on")
+		site.Lang = r.FormValue("lang")
+		footer := r.FormValue("footer")
+		site.Footer = &footer
+
+		site.Update()
+		return nil
+	})
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return updateErrorStatus(err), err
 	}
 
 	http.Redirect(w, r, "/dashboard", http.StatusFound)
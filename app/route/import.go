@@ -0,0 +1,85 @@
+package route
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"go.yhsif.com/pandablog/app/lib/importer"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// maxImportSize is the maximum size of an uploaded archive to import.
+const maxImportSize = 32 << 20
+
+// Import -
+type Import struct {
+	*Core
+}
+
+func registerImport(c *Import) {
+	c.Router.Get("/dashboard/import", c.form)
+	c.Router.Post("/dashboard/import", c.upload)
+}
+
+func (c *Import) form(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	vars := make(map[string]any)
+	vars["title"] = "Import"
+	vars["token"] = c.Sess.SetCSRF(r)
+
+	return c.Render.Template(w, r, "dashboard", "import", vars)
+}
+
+// upload imports posts from an uploaded WordPress export or archive of
+// Markdown files.
+func (c *Import) upload(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	// CSRF protection.
+	success := c.Sess.CSRF(r)
+	if !success {
+		return http.StatusBadRequest, nil
+	}
+
+	f, _, err := r.FormFile("archive")
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	vars := make(map[string]any)
+	vars["title"] = "Import"
+	vars["token"] = c.Sess.SetCSRF(r)
+
+	posts, err := importer.Read(b, time.Now())
+	if err != nil {
+		vars["error"] = err.Error()
+		return c.Render.Template(w, r, "dashboard", "import", vars)
+	}
+
+	var report importer.Report
+	if r.FormValue("dry_run") == "on" {
+		site, err := c.Storage.Site.Load(r.Context())
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		report = importer.Import(site, posts, true)
+	} else {
+		if err := c.Storage.Update(r.Context(), func(site *model.Site) error {
+			report = importer.Import(site, posts, false)
+			return nil
+		}); err != nil {
+			return updateErrorStatus(err), err
+		}
+	}
+	vars["report"] = report
+
+	return c.Render.Template(w, r, "dashboard", "import", vars)
+}
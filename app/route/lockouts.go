@@ -0,0 +1,63 @@
+package route
+
+import (
+	"net/http"
+
+	"go.yhsif.com/pandablog/app/lib/throttle"
+)
+
+// Lockouts -
+type Lockouts struct {
+	*Core
+}
+
+func registerLockouts(c *Lockouts) {
+	c.Router.Get("/dashboard/lockouts", c.index)
+	c.Router.Post("/dashboard/lockouts", c.clear)
+}
+
+// index lists the IPs and usernames with failed login attempts.
+func (c *Lockouts) index(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	list, err := c.Throttle.List(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	vars := make(map[string]any)
+	vars["title"] = "Lockouts"
+	vars["token"] = c.Sess.SetCSRF(r)
+	vars["lockouts"] = list
+
+	return c.Render.Template(w, r, "dashboard", "lockouts", vars)
+}
+
+// clear forgets the failed login attempts of one IP or username, or all of
+// them.
+func (c *Lockouts) clear(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	r.ParseForm()
+
+	// CSRF protection.
+	success := c.Sess.CSRF(r)
+	if !success {
+		return http.StatusBadRequest, nil
+	}
+
+	var keys []string
+	if r.FormValue("all") != "" {
+		list, err := c.Throttle.List(r.Context())
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		for _, s := range list {
+			keys = append(keys, throttle.Key(s.Kind, s.Key))
+		}
+	} else {
+		keys = append(keys, throttle.Key(r.FormValue("kind"), r.FormValue("key")))
+	}
+	if err := c.Throttle.Clear(r.Context(), keys...); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	http.Redirect(w, r, "/dashboard/lockouts", http.StatusFound)
+	return http.StatusFound, nil
+}
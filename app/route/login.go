@@ -2,18 +2,49 @@ package route
 
 import (
 	"encoding/base64"
+	"errors"
 	"log/slog"
+	"math"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/matryer/way"
+	"go.yhsif.com/ctxslog"
 
+	"go.yhsif.com/pandablog/app/lib/account"
 	"go.yhsif.com/pandablog/app/lib/envdetect"
 	"go.yhsif.com/pandablog/app/lib/passhash"
-	"go.yhsif.com/pandablog/app/lib/totp"
+	"go.yhsif.com/pandablog/app/lib/throttle"
+	"go.yhsif.com/pandablog/app/lib/webauthn"
+	"go.yhsif.com/pandablog/app/model"
 )
 
+// errMFAFailed is returned to abort the storage update when the MFA code is
+// wrong.
+var errMFAFailed = errors.New("wrong MFA code")
+
+// loginThrottleRules slow down guessing the passwords, by the IP and by the
+// username. An IP can be shared by many people, so it's allowed more
+// failures.
+var loginThrottleRules = map[string]throttle.Rule{
+	"ip": {
+		Free:         10,
+		Backoff:      time.Second,
+		LockoutAfter: 50,
+		Lockout:      time.Hour,
+		Forget:       24 * time.Hour,
+	},
+	"user": {
+		Free:         3,
+		Backoff:      time.Second,
+		LockoutAfter: 10,
+		Lockout:      15 * time.Minute,
+		Forget:       24 * time.Hour,
+	},
+}
+
 // AuthUtil -
 type AuthUtil struct {
 	*Core
@@ -40,6 +71,12 @@ func (c *AuthUtil) login(w http.ResponseWriter, r *http.Request) (status int, er
 	vars := make(map[string]any)
 	vars["title"] = "Login"
 	vars["token"] = c.Sess.SetCSRF(r)
+	if site.HasPasskeys() {
+		challenge := webauthn.NewChallenge()
+		c.Sess.SetChallenge(r, challenge)
+		vars["challenge"] = base64.RawURLEncoding.EncodeToString(challenge)
+		vars["rpID"] = relyingParty(r, site).ID
+	}
 
 	return c.Render.Template(w, r, "base", "login", vars)
 }
@@ -66,83 +103,234 @@ func (c *AuthUtil) loginPost(w http.ResponseWriter, r *http.Request) (status int
 		return http.StatusBadRequest, nil
 	}
 
+	if r.FormValue("credential") != "" {
+		return c.loginPasskey(w, r, site)
+	}
+
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 	mfa := r.FormValue("mfa")
 	remember := r.FormValue("remember") == "on"
 
-	allowedUsername := os.Getenv("PBB_USERNAME")
-	if len(allowedUsername) == 0 {
-		slog.ErrorContext(r.Context(), "Environment variable missing: PBB_USERNAME")
-		http.Redirect(w, r, "/", http.StatusFound)
-		return http.StatusFound, nil
+	keys := throttleKeys(r, username)
+	if status, wait := c.attempt(w, r, keys); wait {
+		return status, nil
 	}
 
-	hash := os.Getenv("PBB_PASSWORD_HASH")
-	if len(hash) == 0 {
-		slog.ErrorContext(r.Context(), "Environment variable missing: PBB_PASSWORD_HASH")
-		http.Redirect(w, r, "/", http.StatusFound)
-		return http.StatusFound, nil
-	}
+	user, passMatch := account.Authenticate(site, username, password)
 
-	// Get the MFA key - if the environment variable doesn't exist, then
-	// let the MFA pass.
-	mfakey := os.Getenv("PBB_MFA_KEY")
+	// Get the MFA key - if MFA is not enabled for the user, then let the
+	// MFA pass.
+	mfakey := account.MFAKey(site, username)
 	mfaSuccess := true
-	if len(mfakey) > 0 {
-		imfa := 0
-		imfa, err = strconv.Atoi(mfa)
-		if err != nil {
-			mfaSuccess = false
-		}
-
-		mfaSuccess, err = totp.Authenticate(imfa, mfakey)
-		if err != nil {
-			mfaSuccess = false
+	var recovery bool
+	switch {
+	case envdetect.RunningLocalDev():
+		// When running locally, let any MFA pass.
+	case len(mfakey) > 0 && !passMatch:
+		// Don't use up the MFA codes without the password.
+		mfaSuccess = false
+	case len(mfakey) > 0:
+		err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+			recovery, mfaSuccess = account.VerifyMFA(site, username, mfa)
+			if !mfaSuccess {
+				return errMFAFailed
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errMFAFailed) {
+			return updateErrorStatus(err), err
 		}
 	}
 
-	// When running locally, let any MFA pass.
-	if envdetect.RunningLocalDev() {
-		mfaSuccess = true
-	}
-
-	// Decode the hash - this is to allow it to be stored easily since dollar
-	// signs are difficult to work with.
-	hashDecoded, err := base64.StdEncoding.DecodeString(hash)
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
-	passMatch := passhash.MatchString(string(hashDecoded), password)
-
 	// If the username and password don't match, then just redirect.
-	if username != allowedUsername || !passMatch || !mfaSuccess {
+	if !passMatch || !mfaSuccess {
 		slog.ErrorContext(r.Context(), "Login attempt failed.", slog.Group(
 			"login",
 			"method", "password",
+			"username", username,
 			slog.Group(
 				"matched",
 				"password", passMatch,
 				"mfa", mfaSuccess,
-				slog.Group(
-					"username",
-					"got", username,
-					"want", allowedUsername,
-				),
 			),
 		))
 		http.Redirect(w, r, "/", http.StatusFound)
 		return http.StatusFound, nil
 	}
+	c.succeed(r, keys)
+	// PBB_PASSWORD_HASH cannot be changed, but the owner's password changed in
+	// the dashboard can be rehashed like the ones of the stored users.
+	if passhash.NeedsRehash(user.PasswordHash) && !account.PasswordFromEnv(site, user.Username) {
+		c.rehash(r, user, password)
+	}
 
 	slog.WarnContext(r.Context(), "Login attempt successful.", slog.Group(
 		"login",
 		"method", "password",
+		"username", user.Username,
+		"role", user.Role,
 		"mfa", len(mfakey) > 0,
+		"recoveryCode", recovery,
+		"remember", remember,
+	))
+
+	return c.logIn(w, r, user, remember)
+}
+
+// rehash replaces the password hash of the user with one of the current params,
+// unless the password was changed since it was checked.
+func (c *AuthUtil) rehash(r *http.Request, user model.UserWithName, password string) {
+	hash, err := passhash.HashString(password)
+	if err == nil {
+		err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+			u, ok := account.Lookup(site, user.Username)
+			if !ok || u.PasswordHash != user.PasswordHash {
+				return errNotFound
+			}
+			account.SetPassword(site, user.Username, hash)
+			return nil
+		})
+	}
+	if err != nil && !errors.Is(err, errNotFound) {
+		slog.ErrorContext(r.Context(), "Failed to rehash the password", "err", err, "username", user.Username)
+	}
+}
+
+// loginPasskey logs in with the passkey signed the challenge of the login page.
+func (c *AuthUtil) loginPasskey(w http.ResponseWriter, r *http.Request, site *model.Site) (status int, err error) {
+	id := r.FormValue("credential")
+	remember := r.FormValue("remember") == "on"
+
+	// The passkeys don't need the username, so only the IP is throttled.
+	keys := throttleKeys(r, "")
+	if status, wait := c.attempt(w, r, keys); wait {
+		return status, nil
+	}
+
+	fail := func(reason string, err error) (int, error) {
+		slog.ErrorContext(r.Context(), "Login attempt failed.", slog.Group(
+			"login",
+			"method", "passkey",
+			"credential", id,
+			"reason", reason,
+		), "err", err)
+		http.Redirect(w, r, "/", http.StatusFound)
+		return http.StatusFound, nil
+	}
+
+	challenge := c.Sess.Challenge(r)
+	clientDataJSON, err1 := base64.RawURLEncoding.DecodeString(r.FormValue("client_data"))
+	authData, err2 := base64.RawURLEncoding.DecodeString(r.FormValue("authenticator_data"))
+	sig, err3 := base64.RawURLEncoding.DecodeString(r.FormValue("signature"))
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	passkey, ok := site.PasskeyByID(id)
+	if !ok {
+		return fail("unknown passkey", nil)
+	}
+	user, ok := account.Lookup(site, passkey.Username)
+	if !ok {
+		return fail("unknown user", nil)
+	}
+	signCount, err := relyingParty(r, site).Login(challenge, clientDataJSON, authData, sig, webauthn.Credential{
+		PublicKey: passkey.PublicKey,
+		SignCount: passkey.SignCount,
+	})
+	if err != nil {
+		return fail("invalid assertion", err)
+	}
+
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		passkey, ok := site.PasskeyByID(id)
+		if !ok {
+			return errNotFound
+		}
+		passkey.SignCount = signCount
+		passkey.LastUsed = time.Now()
+		site.UpdatePasskey(id, &passkey)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+	c.succeed(r, keys)
+
+	slog.WarnContext(r.Context(), "Login attempt successful.", slog.Group(
+		"login",
+		"method", "passkey",
+		"username", user.Username,
+		"role", user.Role,
+		"passkey", passkey.Name,
 		"remember", remember,
 	))
 
-	c.Sess.SetUser(r, username)
+	return c.logIn(w, r, user, remember)
+}
+
+// throttleKeys returns the keys to throttle the login attempts of the
+// request with.
+func throttleKeys(r *http.Request, username string) []string {
+	var keys []string
+	if ip := ctxslog.GCPRealIP(r); ip.IsValid() {
+		keys = append(keys, throttle.Key("ip", ip.String()))
+	}
+	if username != "" {
+		keys = append(keys, throttle.Key("user", username))
+	}
+	return keys
+}
+
+// attempt returns true with the status to respond if the login attempt has
+// to wait after the failed ones of keys. Otherwise the attempt is counted as
+// failed until it succeeds, see succeed.
+func (c *AuthUtil) attempt(w http.ResponseWriter, r *http.Request, keys []string) (status int, wait bool) {
+	d, err := c.Throttle.Attempt(r.Context(), keys...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to store the login attempt", "err", err)
+	}
+	if d <= 0 {
+		return 0, false
+	}
+
+	slog.WarnContext(r.Context(), "Login attempt throttled.", slog.Group(
+		"login",
+		"keys", keys,
+		"wait", d,
+	))
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+	return http.StatusTooManyRequests, true
+}
+
+// succeed forgets the failed login attempts of the user after a successful
+// one, and takes back the attempt counted for the IP.
+func (c *AuthUtil) succeed(r *http.Request, keys []string) {
+	var clear, refund []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, throttle.Key("user", "")) {
+			clear = append(clear, key)
+		} else {
+			refund = append(refund, key)
+		}
+	}
+	err := errors.Join(
+		c.Throttle.Clear(r.Context(), clear...),
+		c.Throttle.Refund(r.Context(), refund...),
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to clear the failed login attempts", "err", err)
+	}
+}
+
+// logIn starts the session of user after a successful login.
+func (c *AuthUtil) logIn(w http.ResponseWriter, r *http.Request, user model.UserWithName, remember bool) (status int, err error) {
+	// Renew the token so a token planted before the login can't be used.
+	if err := c.Sess.RenewToken(r); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	c.Sess.SetUser(r, user.Username)
 	c.Sess.RememberMe(r, remember)
 
 	http.Redirect(w, r, "/dashboard", http.StatusFound)
@@ -150,7 +338,9 @@ func (c *AuthUtil) loginPost(w http.ResponseWriter, r *http.Request) (status int
 }
 
 func (c *AuthUtil) logout(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	c.Sess.Logout(r)
+	if err := c.Sess.Logout(r); err != nil {
+		return http.StatusInternalServerError, err
+	}
 
 	http.Redirect(w, r, "/", http.StatusFound)
 	return http.StatusFound, nil
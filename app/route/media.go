@@ -0,0 +1,227 @@
+package route
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/matryer/way"
+
+	"go.yhsif.com/pandablog/app/lib/datastorage"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// maxMediaSize is the maximum size of an upload request to the media library.
+const maxMediaSize = 32 << 20
+
+// Media -
+type Media struct {
+	*Core
+}
+
+func registerMedia(c *Media) {
+	c.Router.Get("/media/:name", c.show)
+	c.Router.Get("/dashboard/media", c.index)
+	c.Router.Post("/dashboard/media", c.upload)
+	c.Router.Get("/dashboard/media/:name", c.edit)
+	c.Router.Post("/dashboard/media/:name", c.update)
+}
+
+// show serves an uploaded file.
+func (c *Media) show(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	media, ok := site.MediaByName(way.Param(r.Context(), "name"))
+	if !ok {
+		return http.StatusNotFound, nil
+	}
+	// The resized variants of images are requested with "?w=<width>".
+	var width int
+	if v := r.FormValue("w"); v != "" {
+		if width, err = strconv.Atoi(v); err != nil {
+			return http.StatusNotFound, nil
+		}
+		if _, ok := media.Variant(width); !ok {
+			return http.StatusNotFound, nil
+		}
+	}
+	if status := handleConditionalGet(w, r, media.Uploaded); status > 0 {
+		return status, nil
+	}
+
+	b, err := c.Storage.LoadMedia(r.Context(), media, width)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", media.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if media.ContentType == "image/svg+xml" {
+		// Don't run scripts in SVG files opened directly.
+		w.Header().Set("Content-Security-Policy", "sandbox")
+	}
+	// Last-Modified is already handled by handleConditionalGet, this only
+	// adds range requests for audio and video.
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(b))
+	return http.StatusOK, nil
+}
+
+func (c *Media) index(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	return c.list(w, r, "")
+}
+
+// list renders the media library, with the upload error message if any.
+func (c *Media) list(w http.ResponseWriter, r *http.Request, errMsg string) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	user, _ := c.currentUser(r, site)
+	media := site.MediaList()
+	// Authors can only edit their own media, but still see all of them to
+	// use in posts.
+	editable := make(map[string]bool, len(media))
+	for _, m := range media {
+		editable[m.Name] = user.CanEditMedia(m.Media)
+	}
+
+	vars := make(map[string]any)
+	vars["title"] = "Media"
+	vars["token"] = c.Sess.SetCSRF(r)
+	vars["media"] = media
+	vars["editable"] = editable
+	vars["error"] = errMsg
+
+	return c.Render.Template(w, r, "dashboard", "media_list", vars)
+}
+
+// upload adds the uploaded files to the media library.
+func (c *Media) upload(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize)
+	if err := r.ParseMultipartForm(maxMediaSize); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	// CSRF protection.
+	success := c.Sess.CSRF(r)
+	if !success {
+		return http.StatusBadRequest, nil
+	}
+
+	username, _ := c.Sess.User(r)
+	for _, fh := range r.MultipartForm.File["file"] {
+		contentType, ok := model.MediaContentType(fh.Filename)
+		if !ok {
+			return c.list(w, r, fmt.Sprintf("%s: file type not allowed", fh.Filename))
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		b, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		if _, err := c.Storage.SaveMedia(r.Context(), username, fh.Filename, contentType, b); err != nil {
+			return updateErrorStatus(err), err
+		}
+	}
+
+	http.Redirect(w, r, "/dashboard/media", http.StatusFound)
+	return http.StatusFound, nil
+}
+
+func (c *Media) edit(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	name := way.Param(r.Context(), "name")
+	media, status := c.editableMedia(r, site, name)
+	if status != 0 {
+		return status, nil
+	}
+
+	vars := make(map[string]any)
+	vars["title"] = "Edit media"
+	vars["token"] = c.Sess.SetCSRF(r)
+	vars["media"] = model.MediaWithName{Media: media, Name: name}
+
+	return c.Render.Template(w, r, "dashboard", "media_edit", vars)
+}
+
+// update renames or deletes a media.
+func (c *Media) update(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	r.ParseForm()
+
+	// CSRF protection.
+	success := c.Sess.CSRF(r)
+	if !success {
+		return http.StatusBadRequest, nil
+	}
+
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	name := way.Param(r.Context(), "name")
+	media, status := c.editableMedia(r, site, name)
+	if status != 0 {
+		return status, nil
+	}
+
+	if r.FormValue("delete") != "" {
+		if err := c.Storage.DeleteMedia(r.Context(), name); err != nil {
+			return mediaErrorStatus(err), err
+		}
+		http.Redirect(w, r, "/dashboard/media", http.StatusFound)
+		return http.StatusFound, nil
+	}
+	// Only allow extensions of the same content type, as renames keep the
+	// content type.
+	to := model.CleanMediaName(r.FormValue("name"))
+	if contentType, _ := model.MediaContentType(to); contentType != media.ContentType {
+		return http.StatusBadRequest, nil
+	}
+	if to != name {
+		if to, err = c.Storage.RenameMedia(r.Context(), name, to); err != nil {
+			return mediaErrorStatus(err), err
+		}
+	}
+
+	http.Redirect(w, r, "/dashboard/media/"+to, http.StatusFound)
+	return http.StatusFound, nil
+}
+
+// editableMedia returns the media with name, or the status to respond if it's
+// not found or the logged in user cannot edit it.
+func (c *Media) editableMedia(r *http.Request, site *model.Site, name string) (model.Media, int) {
+	media, ok := site.MediaByName(name)
+	if !ok {
+		return model.Media{}, http.StatusNotFound
+	}
+	user, ok := c.currentUser(r, site)
+	if !ok || !user.CanEditMedia(media) {
+		return model.Media{}, http.StatusForbidden
+	}
+	return media, 0
+}
+
+// mediaErrorStatus returns the http status code for an error returned by the
+// media functions of datastorage.Storage.
+func mediaErrorStatus(err error) int {
+	if errors.Is(err, datastorage.ErrNotExist) {
+		return http.StatusNotFound
+	}
+	return updateErrorStatus(err)
+}
@@ -0,0 +1,505 @@
+package route
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go.yhsif.com/pandablog/app/lib/account"
+	"go.yhsif.com/pandablog/app/lib/indieauth"
+	"go.yhsif.com/pandablog/app/lib/micropub"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// Micropub serves the Micropub endpoint for the IndieWeb clients, with the
+// API tokens of the users, or the tokens of IndieAuth for the owner.
+type Micropub struct {
+	*Core
+}
+
+const (
+	// micropubPath is the Micropub endpoint, advertised in head.tmpl.
+	micropubPath = "/micropub"
+	// micropubMediaPath is the media endpoint, advertised by q=config.
+	micropubMediaPath = "/micropub/media"
+)
+
+// errInsufficientScope is returned when the token of a Micropub request
+// doesn't allow it.
+var errInsufficientScope = errors.New("insufficient scope")
+
+// micropubMediaProperties are the properties that can be uploaded as files to
+// the Micropub endpoint.
+var micropubMediaProperties = []string{"photo", "video", "audio"}
+
+func registerMicropub(c *Micropub) {
+	c.Router.Get(micropubPath, c.query)
+	c.Router.Post(micropubPath, c.post)
+	c.Router.Post(micropubMediaPath, c.media)
+}
+
+// isMicropub reports whether the path is one of the Micropub endpoints, which
+// get the errors of Micropub instead of the error pages.
+func isMicropub(path string) bool {
+	return path == micropubPath || path == micropubMediaPath
+}
+
+// writeMicropubError writes the error response of Micropub, with the message
+// of err for the client errors.
+func writeMicropubError(w http.ResponseWriter, status int, err error) {
+	var code string
+	switch {
+	case status == http.StatusUnauthorized:
+		code = "unauthorized"
+	case status == http.StatusForbidden && errors.Is(err, errInsufficientScope):
+		code = "insufficient_scope"
+	case status == http.StatusForbidden:
+		code = "forbidden"
+	case status < http.StatusInternalServerError:
+		code = "invalid_request"
+	default:
+		code = strings.ToLower(http.StatusText(status))
+	}
+	resp := map[string]string{"error": code}
+	if err != nil && status < http.StatusInternalServerError {
+		resp["error_description"] = err.Error()
+	}
+	writeJSON(w, status, resp)
+}
+
+// The scopes of IndieAuth for the Micropub requests.
+const (
+	micropubScopeCreate = "create"
+	micropubScopeUpdate = "update"
+	micropubScopeDelete = "delete"
+	micropubScopeMedia  = "media"
+)
+
+// micropubToken is the authenticated token of a Micropub request, either an
+// API token or a token of IndieAuth.
+type micropubToken struct {
+	user model.UserWithName
+	// scope is the scope of an API token, or "" for IndieAuth.
+	scope model.Scope
+	// indieAuth is the token verified by the IndieAuth token endpoint.
+	indieAuth indieauth.Token
+}
+
+// allows returns errInsufficientScope if the token doesn't allow the scope of
+// IndieAuth. API tokens need the write scope for all of them.
+func (t micropubToken) allows(scope string) error {
+	if t.scope != "" {
+		if !t.scope.Allows(model.ScopeWrite) {
+			return fmt.Errorf("%w: the token needs the %s scope", errInsufficientScope, model.ScopeWrite)
+		}
+		return nil
+	}
+	scopes := []string{scope}
+	switch scope {
+	case micropubScopeCreate:
+		// The scope of the older clients.
+		scopes = append(scopes, "post")
+	case micropubScopeMedia:
+		scopes = append(scopes, micropubScopeCreate, "post")
+	}
+	if !t.indieAuth.HasScope(scopes...) {
+		return fmt.Errorf("%w: the token needs the %s scope", errInsufficientScope, scope)
+	}
+	return nil
+}
+
+// auth authenticates the token in the Authorization header, or the
+// access_token form value of the form-urlencoded requests, which must be parsed
+// before. The other bodies are not read before the token is authenticated, so
+// they must use the header.
+//
+// The API tokens are looked up in site. Other tokens are verified by the
+// IndieAuth token endpoint, when set up, and belong to the owner when they are
+// issued to the site URL.
+func (c *Micropub) auth(w http.ResponseWriter, r *http.Request, site *model.Site) (micropubToken, int, error) {
+	token := bearerToken(r)
+	if v := r.PostForm.Get("access_token"); v != "" {
+		if token != "" {
+			return micropubToken{}, http.StatusBadRequest, errors.New("the token is in both the header and the form")
+		}
+		token = v
+	}
+	unauthorized := func(err error) (micropubToken, int, error) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="micropub"`)
+		return micropubToken{}, http.StatusUnauthorized, err
+	}
+	if token == "" {
+		return unauthorized(nil)
+	}
+
+	endpoint := indieauth.TokenEndpoint()
+	if account.IsToken(token) || endpoint == "" {
+		t, user, ok := c.authenticateToken(r, site, token)
+		if !ok {
+			return unauthorized(nil)
+		}
+		if !t.Scope.Allows(model.ScopeRead) {
+			return micropubToken{}, http.StatusForbidden, fmt.Errorf("%w: the token needs the %s scope", errInsufficientScope, model.ScopeRead)
+		}
+		return micropubToken{user: user, scope: t.Scope}, 0, nil
+	}
+
+	t, err := indieauth.Verify(r.Context(), &httpClient, endpoint, token)
+	if errors.Is(err, indieauth.ErrInvalidToken) {
+		return unauthorized(nil)
+	}
+	if err != nil {
+		return micropubToken{}, http.StatusBadGateway, err
+	}
+	owner, ok := account.Owner()
+	if !ok || !t.IsMe(site.SiteURL(nil)) {
+		return micropubToken{}, http.StatusForbidden, fmt.Errorf("the token is for %s, not this site", t.Me)
+	}
+	return micropubToken{user: owner, indieAuth: t}, 0, nil
+}
+
+// postByURL returns the id of the post at the URL, or the status to respond if
+// it's not found or user cannot edit it.
+func postByURL(site *model.Site, user model.UserWithName, rawURL string) (string, int, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	slug := strings.Trim(u.Path, "/")
+	for _, p := range site.PostsAndPages(false) {
+		if p.URL == slug {
+			return p.ID, canEditPost(site, user, p.ID), nil
+		}
+	}
+	return "", http.StatusNotFound, fmt.Errorf("no post at %s", rawURL)
+}
+
+// query answers the q=config, q=source and q=syndicate-to queries.
+func (c *Micropub) query(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	token, status, err := c.auth(w, r, site)
+	if status != 0 {
+		return status, err
+	}
+
+	query := r.URL.Query()
+	switch q := query.Get("q"); q {
+	case "config":
+		return writeJSON(w, http.StatusOK, map[string]any{
+			"media-endpoint": site.SiteURL(nil) + micropubMediaPath,
+			"syndicate-to":   []any{},
+			"q":              []string{"config", "source", "syndicate-to"},
+		})
+	case "syndicate-to":
+		return writeJSON(w, http.StatusOK, map[string]any{"syndicate-to": []any{}})
+	case "source":
+		id, status, err := postByURL(site, token.user, query.Get("url"))
+		if status != 0 {
+			return status, err
+		}
+		p, ok, err := site.PostByID(r.Context(), id)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !ok {
+			return http.StatusNotFound, nil
+		}
+
+		props := micropub.PostProperties(p)
+		names := append(query["properties"], query["properties[]"]...)
+		if len(names) == 0 {
+			return writeJSON(w, http.StatusOK, map[string]any{
+				"type":       []string{micropub.TypeEntry},
+				"properties": props,
+			})
+		}
+		only := make(micropub.Properties)
+		for _, name := range names {
+			if v, ok := props[name]; ok {
+				only[name] = v
+			}
+		}
+		return writeJSON(w, http.StatusOK, map[string]any{"properties": only})
+	default:
+		return http.StatusBadRequest, fmt.Errorf("unknown query %q", q)
+	}
+}
+
+// post creates, updates or deletes a post.
+func (c *Micropub) post(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType == "application/x-www-form-urlencoded" {
+		// The token could be in the form, which is small.
+		r.Body = http.MaxBytesReader(w, r.Body, maxAPIBody)
+		if err := r.ParseForm(); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	token, status, err := c.auth(w, r, site)
+	if status != 0 {
+		return status, err
+	}
+
+	var req micropub.Request
+	var files map[string][]*multipart.FileHeader
+	switch contentType {
+	case "application/json":
+		body, err := readBody(w, r)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		req, err = micropub.ParseJSON(body)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+	case "multipart/form-data":
+		r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize)
+		if err := r.ParseMultipartForm(maxMediaSize); err != nil {
+			return http.StatusBadRequest, err
+		}
+		req, err = micropub.ParseForm(r.PostForm)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		files = r.MultipartForm.File
+	case "application/x-www-form-urlencoded":
+		req, err = micropub.ParseForm(r.PostForm)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+	default:
+		return http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	switch req.Action {
+	case micropub.ActionCreate:
+		if err := token.allows(micropubScopeCreate); err != nil {
+			return http.StatusForbidden, err
+		}
+		// Add the uploaded files as the URLs of the properties, and delete
+		// them again if the post is not created.
+		var uploaded []string
+		for _, name := range micropubMediaProperties {
+			for _, fh := range append(files[name], files[name+"[]"]...) {
+				u, media, status, err := c.upload(r, site, token.user, fh)
+				if status != 0 {
+					c.deleteMedia(r.Context(), uploaded)
+					return status, err
+				}
+				uploaded = append(uploaded, media)
+				req.Properties[name] = append(req.Properties[name], u)
+			}
+		}
+		status, err := c.create(w, r, token.user, req)
+		if err != nil || status != http.StatusCreated {
+			c.deleteMedia(r.Context(), uploaded)
+		}
+		return status, err
+	case micropub.ActionUpdate:
+		if err := token.allows(micropubScopeUpdate); err != nil {
+			return http.StatusForbidden, err
+		}
+		return c.update(w, r, site, token.user, req)
+	case micropub.ActionDelete:
+		if err := token.allows(micropubScopeDelete); err != nil {
+			return http.StatusForbidden, err
+		}
+		return c.delete(w, r, site, token.user, req)
+	default:
+		return http.StatusBadRequest, fmt.Errorf("%s is not supported, the deleted posts are gone", req.Action)
+	}
+}
+
+func (c *Micropub) create(w http.ResponseWriter, r *http.Request, user model.UserWithName, req micropub.Request) (status int, err error) {
+	now := time.Now()
+	p := model.Post{
+		Author:  user.Username,
+		Created: now,
+		Updated: now,
+	}
+	if err := req.Properties.Apply(&p, now); err != nil {
+		return http.StatusBadRequest, err
+	}
+	slug := cmp.Or(
+		micropub.Slug(req.Properties.Value("mp-slug")),
+		micropub.Slug(p.Title),
+		now.Format("2006-01-02-150405"),
+	)
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	var site *model.Site
+	err = c.Storage.Update(r.Context(), func(s *model.Site) error {
+		site = s
+		p.URL = site.UniquePostSlug(slug)
+		site.UpdatePost(id.String(), &p)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	if p.Published && site.BridgyFedDomain != "" {
+		sendBridgyFedWebmention(r.Context(), p, site)
+	}
+
+	w.Header().Set("Location", site.SiteURL(&p))
+	w.WriteHeader(http.StatusCreated)
+	return http.StatusCreated, nil
+}
+
+// update changes the properties of the post in the replace, add and delete of
+// the request, and keeps the other ones.
+func (c *Micropub) update(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName, req micropub.Request) (status int, err error) {
+	id, status, err := postByURL(site, user, req.URL)
+	if status != 0 {
+		return status, err
+	}
+
+	var p model.Post
+	err = c.Storage.Update(r.Context(), func(s *model.Site) error {
+		site = s
+		var ok bool
+		var err error
+		p, ok, err = site.PostByID(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errNotFound
+		}
+
+		props := micropub.PostProperties(p)
+		req.Update(props)
+		now := time.Now()
+		if err := props.Apply(&p, now); err != nil {
+			return err
+		}
+		p.Updated = now
+
+		site.UpdatePost(id, &p)
+		return nil
+	})
+	if errors.Is(err, micropub.ErrInvalidRequest) {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	if p.Published && site.BridgyFedDomain != "" {
+		sendBridgyFedWebmention(r.Context(), p, site)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return http.StatusNoContent, nil
+}
+
+func (c *Micropub) delete(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName, req micropub.Request) (status int, err error) {
+	id, status, err := postByURL(site, user, req.URL)
+	if status != 0 {
+		return status, err
+	}
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		if _, ok, err := site.PostByID(r.Context(), id); err != nil {
+			return err
+		} else if !ok {
+			return errNotFound
+		}
+
+		site.UpdatePost(id, nil)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return http.StatusNoContent, nil
+}
+
+// media adds the file uploaded to the media endpoint to the media library.
+// The token must be in the header, as the body is only read after it's
+// authenticated.
+func (c *Micropub) media(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	token, status, err := c.auth(w, r, site)
+	if status != 0 {
+		return status, err
+	}
+	if err := token.allows(micropubScopeMedia); err != nil {
+		return http.StatusForbidden, err
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize)
+	if err := r.ParseMultipartForm(maxMediaSize); err != nil {
+		return http.StatusBadRequest, err
+	}
+	files := r.MultipartForm.File["file"]
+	if len(files) != 1 {
+		return http.StatusBadRequest, errors.New("exactly one file is required")
+	}
+	u, _, status, err := c.upload(r, site, token.user, files[0])
+	if status != 0 {
+		return status, err
+	}
+
+	w.Header().Set("Location", u)
+	w.WriteHeader(http.StatusCreated)
+	return http.StatusCreated, nil
+}
+
+// upload adds the file uploaded by user to the media library, and returns its
+// URL and name, or the status to respond.
+func (c *Micropub) upload(r *http.Request, site *model.Site, user model.UserWithName, fh *multipart.FileHeader) (string, string, int, error) {
+	contentType, ok := model.MediaContentType(fh.Filename)
+	if !ok {
+		return "", "", http.StatusBadRequest, fmt.Errorf("%s: file type not allowed", fh.Filename)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return "", "", http.StatusBadRequest, err
+	}
+	b, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return "", "", http.StatusBadRequest, err
+	}
+	name, err := c.Storage.SaveMedia(r.Context(), user.Username, fh.Filename, contentType, b)
+	if err != nil {
+		return "", "", updateErrorStatus(err), err
+	}
+	return site.SiteURL(nil) + "/media/" + name, name, 0, nil
+}
+
+// deleteMedia deletes the media uploaded with a post that was not created.
+func (c *Micropub) deleteMedia(ctx context.Context, names []string) {
+	for _, name := range names {
+		if err := c.Storage.DeleteMedia(ctx, name); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete the media of a post not created", "err", err, "media", name)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package route
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.yhsif.com/pandablog/app/lib/webauthn"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// Passkeys -
+type Passkeys struct {
+	*Core
+}
+
+func registerPasskeys(c *Passkeys) {
+	c.Router.Get("/dashboard/passkeys", c.index)
+	c.Router.Post("/dashboard/passkeys", c.update)
+}
+
+// relyingParty returns the WebAuthn relying party of the site, on the host of
+// the request if the domain of the site is not set.
+func relyingParty(r *http.Request, site *model.Site) webauthn.RelyingParty {
+	host := site.URL
+	if host == "" {
+		host = r.Host
+	}
+	return webauthn.NewRelyingParty(site.Scheme, host)
+}
+
+// userHandle returns the WebAuthn user handle of username, which must not
+// reveal the username.
+func userHandle(username string) []byte {
+	h := sha256.Sum256([]byte("pandablog user: " + username))
+	return h[:16]
+}
+
+func (c *Passkeys) index(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	return c.list(w, r, "")
+}
+
+// list renders the passkeys of the user, with the error message of adding a
+// passkey if any.
+func (c *Passkeys) list(w http.ResponseWriter, r *http.Request, errMsg string) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	user, ok := c.currentUser(r, site)
+	if !ok {
+		return http.StatusForbidden, nil
+	}
+
+	passkeys := site.UserPasskeys(user.Username)
+	exclude := make([]string, 0, len(passkeys))
+	for _, p := range passkeys {
+		exclude = append(exclude, p.ID)
+	}
+	challenge := webauthn.NewChallenge()
+	c.Sess.SetChallenge(r, challenge)
+	rp := relyingParty(r, site)
+
+	vars := make(map[string]any)
+	vars["title"] = "Passkeys"
+	vars["token"] = c.Sess.SetCSRF(r)
+	vars["passkeys"] = passkeys
+	vars["error"] = errMsg
+	vars["challenge"] = base64.RawURLEncoding.EncodeToString(challenge)
+	vars["rpID"] = rp.ID
+	vars["rpName"] = site.Title
+	vars["userID"] = base64.RawURLEncoding.EncodeToString(userHandle(user.Username))
+	vars["username"] = user.Username
+	vars["displayName"] = user.Name()
+	vars["algorithms"] = webauthn.Algorithms
+	vars["exclude"] = exclude
+
+	return c.Render.Template(w, r, "dashboard", "passkeys", vars)
+}
+
+// update adds a passkey for the user, or deletes one of theirs.
+func (c *Passkeys) update(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	r.ParseForm()
+
+	// CSRF protection.
+	success := c.Sess.CSRF(r)
+	if !success {
+		return http.StatusBadRequest, nil
+	}
+
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	user, ok := c.currentUser(r, site)
+	if !ok {
+		return http.StatusForbidden, nil
+	}
+
+	if id := r.FormValue("delete"); id != "" {
+		err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+			if p, ok := site.PasskeyByID(id); !ok || p.Username != user.Username {
+				return errNotFound
+			}
+			site.UpdatePasskey(id, nil)
+			return nil
+		})
+		if err != nil {
+			return updateErrorStatus(err), err
+		}
+		http.Redirect(w, r, "/dashboard/passkeys", http.StatusFound)
+		return http.StatusFound, nil
+	}
+
+	challenge := c.Sess.Challenge(r)
+	clientDataJSON, err1 := base64.RawURLEncoding.DecodeString(r.FormValue("client_data"))
+	attestationObject, err2 := base64.RawURLEncoding.DecodeString(r.FormValue("attestation_object"))
+	if err := errors.Join(err1, err2); err != nil {
+		return http.StatusBadRequest, err
+	}
+	cred, err := relyingParty(r, site).Register(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to register passkey", "err", err, "username", user.Username)
+		return c.list(w, r, "failed to verify the passkey, please try again")
+	}
+	name := r.FormValue("name")
+	if name == "" {
+		name = "Passkey"
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(cred.ID)
+	var exists bool
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		if _, exists = site.PasskeyByID(id); exists {
+			return nil
+		}
+		site.UpdatePasskey(id, &model.Passkey{
+			Username:  user.Username,
+			Name:      name,
+			PublicKey: cred.PublicKey,
+			SignCount: cred.SignCount,
+			Created:   time.Now(),
+		})
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+	if exists {
+		return c.list(w, r, "the passkey is already registered")
+	}
+
+	http.Redirect(w, r, "/dashboard/passkeys", http.StatusFound)
+	return http.StatusFound, nil
+}
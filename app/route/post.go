@@ -75,7 +75,10 @@ func (c *Post) show(w http.ResponseWriter, r *http.Request) (status int, err err
 	}
 
 	slug := way.Param(r.Context(), "slug")
-	p := site.PostBySlug(slug)
+	p, err := site.PostBySlug(r.Context(), slug)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
 
 	// Determine if in preview mode.
 	preview := false
@@ -104,6 +107,7 @@ func (c *Post) show(w http.ResponseWriter, r *http.Request) (status int, err err
 		vars["title"] = p.Title
 		vars["pubdate"] = p.Timestamp
 	}
+	vars["author"] = site.AuthorName(p.Post)
 
 	vars["tags"] = p.Tags
 	vars["fedicreator"] = site.FediCreator
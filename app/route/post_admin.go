@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
@@ -36,9 +37,24 @@ func (c *AdminPost) index(w http.ResponseWriter, r *http.Request) (status int, e
 		return http.StatusInternalServerError, err
 	}
 
+	user, ok := c.currentUser(r, site)
+	if !ok {
+		return http.StatusForbidden, nil
+	}
+
+	// Authors only see their own posts.
+	posts := slices.DeleteFunc(site.PostsAndPages(false), func(p model.PostWithID) bool {
+		return !user.CanEditPost(p.Post)
+	})
+	authors := make(map[string]string, len(posts))
+	for _, p := range posts {
+		authors[p.ID] = site.AuthorName(p.Post)
+	}
+
 	vars := make(map[string]any)
 	vars["title"] = "Posts"
-	vars["posts"] = site.PostsAndPages(false)
+	vars["posts"] = posts
+	vars["authors"] = authors
 
 	return c.Render.Template(w, r, "dashboard", "bloglist_edit", vars)
 }
@@ -59,12 +75,6 @@ func (c *AdminPost) create(w http.ResponseWriter, r *http.Request) (status int,
 }
 
 func (c *AdminPost) store(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	site, err := c.Storage.Site.Load(r.Context())
-	if err != nil {
-		slog.ErrorContext(r.Context(), "Failed to load site", "err", err)
-		return http.StatusInternalServerError, err
-	}
-
 	id, err := uuid.NewRandom()
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -81,6 +91,7 @@ func (c *AdminPost) store(w http.ResponseWriter, r *http.Request) (status int, e
 	now := time.Now()
 
 	var p model.Post
+	p.Author, _ = c.Sess.User(r)
 	p.Title = r.FormValue("title")
 	p.URL = r.FormValue("slug")
 	p.Canonical = r.FormValue("canonical_url")
@@ -102,9 +113,14 @@ func (c *AdminPost) store(w http.ResponseWriter, r *http.Request) (status int, e
 	p.Published = r.FormValue("publish") == "on"
 
 	// Save to storage.
-	site.UpdatePost(id.String(), &p)
-	if err := c.Storage.Save(site); err != nil {
-		return http.StatusInternalServerError, err
+	var site *model.Site
+	err = c.Storage.Update(r.Context(), func(s *model.Site) error {
+		site = s
+		site.UpdatePost(id.String(), &p)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
 	}
 
 	if p.Published && site.BridgyFedDomain != "" && r.FormValue("skip_webmention") != "on" {
@@ -127,12 +143,17 @@ func (c *AdminPost) edit(w http.ResponseWriter, r *http.Request) (status int, er
 	vars["token"] = c.Sess.SetCSRF(r)
 
 	id := way.Param(r.Context(), "id")
-	p, ok := site.PostByID(id)
+	p, ok, err := site.PostByID(r.Context(), id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
 	if !ok {
 		return http.StatusNotFound, nil
 	}
 
 	vars["id"] = id
+	vars["author"] = site.AuthorName(p)
+	vars["updated"] = updatedFormValue(p.Updated)
 	vars["ptitle"] = p.Title
 	vars["url"] = p.URL
 	vars["canonical"] = p.Canonical
@@ -148,17 +169,7 @@ func (c *AdminPost) edit(w http.ResponseWriter, r *http.Request) (status int, er
 }
 
 func (c *AdminPost) update(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	site, err := c.Storage.Site.Load(r.Context())
-	if err != nil {
-		slog.ErrorContext(r.Context(), "Failed to load site", "err", err)
-		return http.StatusInternalServerError, err
-	}
-
 	id := way.Param(r.Context(), "id")
-	p, ok := site.PostByID(id)
-	if !ok {
-		return http.StatusNotFound, nil
-	}
 
 	// Save the site.
 	r.ParseForm()
@@ -169,28 +180,45 @@ func (c *AdminPost) update(w http.ResponseWriter, r *http.Request) (status int,
 		return http.StatusBadRequest, nil
 	}
 
-	now := time.Now()
-
-	p.Title = r.FormValue("title")
-	p.URL = r.FormValue("slug")
-	p.Canonical = r.FormValue("canonical_url")
-	p.Updated = now
 	pubDate := r.FormValue("published_date")
 	ts, err := time.Parse("2006-01-02", pubDate)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	p.Timestamp = ts
-	p.Lang = r.FormValue("lang")
-	p.Content = r.FormValue("content")
-	p.Tags = p.Tags.Split(r.FormValue("tags"))
-	p.Page = r.FormValue("is_page") == "on"
-	p.Published = r.FormValue("publish") == "on"
-
-	site.UpdatePost(id, &p)
 
-	if err := c.Storage.Save(site); err != nil {
-		return http.StatusInternalServerError, err
+	var site *model.Site
+	var p model.Post
+	err = c.Storage.Update(r.Context(), func(s *model.Site) error {
+		site = s
+		var ok bool
+		var err error
+		p, ok, err = site.PostByID(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errNotFound
+		}
+		if err := checkUnmodified(r, p.Updated); err != nil {
+			return err
+		}
+
+		p.Title = r.FormValue("title")
+		p.URL = r.FormValue("slug")
+		p.Canonical = r.FormValue("canonical_url")
+		p.Updated = time.Now()
+		p.Timestamp = ts
+		p.Lang = r.FormValue("lang")
+		p.Content = r.FormValue("content")
+		p.Tags = p.Tags.Split(r.FormValue("tags"))
+		p.Page = r.FormValue("is_page") == "on"
+		p.Published = r.FormValue("publish") == "on"
+
+		site.UpdatePost(id, &p)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
 	}
 
 	if p.Published && site.BridgyFedDomain != "" && r.FormValue("skip_webmention") != "on" {
@@ -202,20 +230,19 @@ func (c *AdminPost) update(w http.ResponseWriter, r *http.Request) (status int,
 }
 
 func (c *AdminPost) destroy(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	site, err := c.Storage.Site.Load(r.Context())
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
-
 	id := way.Param(r.Context(), "id")
-	if _, ok := site.PostByID(id); !ok {
-		return http.StatusNotFound, nil
-	}
-
-	site.UpdatePost(id, nil)
-
-	if err := c.Storage.Save(site); err != nil {
-		return http.StatusInternalServerError, err
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		if _, ok, err := site.PostByID(r.Context(), id); err != nil {
+			return err
+		} else if !ok {
+			return errNotFound
+		}
+
+		site.UpdatePost(id, nil)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
 	}
 
 	http.Redirect(w, r, "/dashboard/posts", http.StatusFound)
@@ -31,3 +31,33 @@ func (c *Core) registerBridyFedRedirect() {
 	c.Router.Get("/.well-known/host-meta", redir)
 	c.Router.Get("/.well-known/webfinger", redir)
 }
+
+// LegacyRedirect redirects the old paths in Site.Redirects, for example the
+// permalinks of posts imported from WordPress, to the current URLs of the
+// posts.
+func (c *Core) LegacyRedirect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		site, err := c.Storage.Site.Load(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to load site", "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		from := r.URL.Path
+		if r.URL.RawQuery != "" {
+			from += "?" + r.URL.RawQuery
+		}
+		post, ok := site.Redirect(from)
+		if !ok || !post.Published || from == "/"+post.URL {
+			next.ServeHTTP(w, r)
+			return
+		}
+		http.Redirect(w, r, "/"+post.URL, http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,139 @@
+package route
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/matryer/way"
+
+	"go.yhsif.com/pandablog/app/lib/datastorage"
+	"go.yhsif.com/pandablog/app/lib/linediff"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// Revision -
+type Revision struct {
+	*Core
+}
+
+func registerRevision(c *Revision) {
+	c.Router.Get("/dashboard/posts/:id/revisions", c.index)
+	c.Router.Post("/dashboard/posts/:id/revisions", c.restore)
+	c.Router.Get("/dashboard/posts/:id/revisions/:rev", c.show)
+	c.Router.Post("/dashboard/posts/:id/revisions/:rev", c.restore)
+}
+
+func (c *Revision) index(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	id := way.Param(r.Context(), "id")
+	p, ok, err := site.PostByID(r.Context(), id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !ok {
+		return http.StatusNotFound, nil
+	}
+
+	revisions, err := c.Storage.Revisions(r.Context(), id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	vars := make(map[string]any)
+	vars["title"] = "Revisions"
+	vars["token"] = c.Sess.SetCSRF(r)
+	vars["id"] = id
+	vars["ptitle"] = p.Title
+	vars["updated"] = p.Updated
+	vars["revisions"] = revisions
+
+	return c.Render.Template(w, r, "dashboard", "revision_list", vars)
+}
+
+func (c *Revision) show(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	id := way.Param(r.Context(), "id")
+	p, ok, err := site.PostByID(r.Context(), id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !ok {
+		return http.StatusNotFound, nil
+	}
+
+	rev := way.Param(r.Context(), "rev")
+	old, err := c.Storage.Revision(r.Context(), id, rev)
+	if err != nil {
+		if errors.Is(err, datastorage.ErrNotExist) {
+			return http.StatusNotFound, nil
+		}
+		return http.StatusInternalServerError, err
+	}
+
+	diff := linediff.Diff(old.Content, p.Content)
+
+	vars := make(map[string]any)
+	vars["title"] = "Revision"
+	vars["token"] = c.Sess.SetCSRF(r)
+	vars["id"] = id
+	vars["rev"] = rev
+	vars["ptitle"] = p.Title
+	vars["oldtitle"] = old.Title
+	vars["revupdated"] = old.Updated
+	vars["diff"] = diff
+	vars["changed"] = linediff.Changed(diff)
+
+	return c.Render.Template(w, r, "dashboard", "revision_show", vars)
+}
+
+// restore replaces the post with one of its prior revisions, which turns the
+// current one into a prior revision.
+func (c *Revision) restore(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	r.ParseForm()
+
+	// CSRF protection.
+	success := c.Sess.CSRF(r)
+	if !success {
+		return http.StatusBadRequest, nil
+	}
+
+	id := way.Param(r.Context(), "id")
+	rev := way.Param(r.Context(), "rev")
+	if rev == "" {
+		rev = r.FormValue("rev")
+	}
+	p, err := c.Storage.Revision(r.Context(), id, rev)
+	if err != nil {
+		if errors.Is(err, datastorage.ErrNotExist) {
+			return http.StatusNotFound, nil
+		}
+		return http.StatusInternalServerError, err
+	}
+
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		if _, ok, err := site.PostByID(r.Context(), id); err != nil {
+			return err
+		} else if !ok {
+			return errNotFound
+		}
+
+		p.Updated = time.Now()
+		site.UpdatePost(id, &p)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	http.Redirect(w, r, "/dashboard/posts/"+id, http.StatusFound)
+	return http.StatusFound, nil
+}
@@ -0,0 +1,238 @@
+package route
+
+import (
+	"encoding/base64"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"go.yhsif.com/pandablog/app/lib/account"
+	"go.yhsif.com/pandablog/app/lib/passhash"
+	"go.yhsif.com/pandablog/app/lib/throttle"
+	"go.yhsif.com/pandablog/app/lib/totp"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// Security -
+type Security struct {
+	*Core
+}
+
+func registerSecurity(c *Security) {
+	c.Router.Get("/dashboard/security", c.index)
+	c.Router.Post("/dashboard/security", c.update)
+}
+
+func (c *Security) index(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	return c.show(w, r, make(map[string]any))
+}
+
+// show renders the security page of the user, with vars like the message of
+// a change, the error message of a failed one, the new recovery codes, or the
+// TOTP secret being enrolled.
+func (c *Security) show(w http.ResponseWriter, r *http.Request, vars map[string]any) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	user, ok := c.currentUser(r, site)
+	if !ok {
+		return http.StatusForbidden, nil
+	}
+
+	if secret, ok := vars["secret"].(string); ok {
+		issuer := os.Getenv("PBB_ISSUER")
+		if issuer == "" {
+			issuer = site.Title
+		}
+		png, err := totp.QRCode(totp.URL(user.Username, issuer, secret))
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		vars["qr"] = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	}
+
+	vars["title"] = "Security"
+	vars["token"] = c.Sess.SetCSRF(r)
+	vars["enabled"] = account.MFAKey(site, user.Username) != ""
+	vars["left"] = account.RecoveryCodesLeft(site, user.Username)
+	vars["owner"] = account.IsOwner(user.Username)
+
+	return c.Render.Template(w, r, "dashboard", "security", vars)
+}
+
+// update changes the password or the MFA of the user.
+func (c *Security) update(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	r.ParseForm()
+
+	// CSRF protection.
+	success := c.Sess.CSRF(r)
+	if !success {
+		return http.StatusBadRequest, nil
+	}
+
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	user, ok := c.currentUser(r, site)
+	if !ok {
+		return http.StatusForbidden, nil
+	}
+
+	switch r.FormValue("action") {
+	case "password":
+		return c.changePassword(w, r, site, user)
+	case "enroll":
+		_, secret, err := totp.GenerateURL(user.Username, "")
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return c.show(w, r, map[string]any{"secret": secret})
+	case "enable":
+		return c.enableMFA(w, r, site, user)
+	case "disable":
+		return c.disableMFA(w, r, site, user)
+	case "codes":
+		return c.generateCodes(w, r, site, user)
+	}
+	return http.StatusBadRequest, nil
+}
+
+// checkPassword returns the error message to show if password is not the
+// current password of user. The failures are throttled like the logins.
+func (c *Security) checkPassword(r *http.Request, site *model.Site, user model.UserWithName, password string) string {
+	key := throttle.Key("user", user.Username)
+	wait, err := c.Throttle.Attempt(r.Context(), key)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to store the login attempt", "err", err)
+	}
+	if wait > 0 {
+		return "too many wrong passwords, please try again later"
+	}
+	if _, ok := account.Authenticate(site, user.Username, password); !ok {
+		return "the current password is wrong"
+	}
+	if err := c.Throttle.Clear(r.Context(), key); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to clear the failed login attempts", "err", err)
+	}
+	return ""
+}
+
+// changePassword replaces the password of the user, and logs out their other
+// sessions.
+func (c *Security) changePassword(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName) (status int, err error) {
+	password := r.FormValue("password")
+	switch {
+	case len(password) == 0:
+		return c.show(w, r, map[string]any{"error": "the new password is required"})
+	case password != r.FormValue("confirm"):
+		return c.show(w, r, map[string]any{"error": "the new passwords don't match"})
+	}
+	if errMsg := c.checkPassword(r, site, user, r.FormValue("current")); errMsg != "" {
+		return c.show(w, r, map[string]any{"error": errMsg})
+	}
+
+	hash, err := passhash.HashString(password)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		account.SetPassword(site, user.Username, hash)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	message := "Your password is changed."
+	// Sessions in cookies can only be logged out all together.
+	if c.Sess.Listable() {
+		if err := c.Sess.RevokeOthers(r, user.Username); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to log out the other sessions", "err", err, "username", user.Username)
+		} else {
+			message = "Your password is changed, and your other sessions are logged out."
+		}
+	}
+	slog.WarnContext(r.Context(), "Password changed.", "username", user.Username)
+	return c.show(w, r, map[string]any{"message": message})
+}
+
+// enableMFA enables MFA with the TOTP secret being enrolled, after the user
+// enters a code of it, and shows the new recovery codes once.
+func (c *Security) enableMFA(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName) (status int, err error) {
+	secret := r.FormValue("secret")
+	if secret == "" {
+		return http.StatusBadRequest, nil
+	}
+	step, ok := totp.Verify(r.FormValue("mfa"), secret, 0)
+	if !ok {
+		return c.show(w, r, map[string]any{
+			"secret": secret,
+			"error":  "the MFA token is wrong, please try again",
+		})
+	}
+	if errMsg := c.checkPassword(r, site, user, r.FormValue("current")); errMsg != "" {
+		return c.show(w, r, map[string]any{"secret": secret, "error": errMsg})
+	}
+
+	codes, hashes := totp.GenerateRecoveryCodes()
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		account.SetMFAKey(site, user.Username, secret, step, hashes)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	slog.WarnContext(r.Context(), "MFA enabled.", "username", user.Username)
+	return c.show(w, r, map[string]any{
+		"message": "MFA is enabled.",
+		"codes":   codes,
+	})
+}
+
+// disableMFA disables MFA for the user, and deletes their recovery codes
+// generated in the dashboard.
+func (c *Security) disableMFA(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName) (status int, err error) {
+	if errMsg := c.checkPassword(r, site, user, r.FormValue("current")); errMsg != "" {
+		return c.show(w, r, map[string]any{"error": errMsg})
+	}
+
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		account.SetMFAKey(site, user.Username, "", 0, nil)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	slog.WarnContext(r.Context(), "MFA disabled.", "username", user.Username)
+	return c.show(w, r, map[string]any{"message": "MFA is disabled."})
+}
+
+// generateCodes replaces the recovery codes of the user generated in the
+// dashboard, and shows the new ones once.
+func (c *Security) generateCodes(w http.ResponseWriter, r *http.Request, site *model.Site, user model.UserWithName) (status int, err error) {
+	if account.MFAKey(site, user.Username) == "" {
+		return http.StatusForbidden, nil
+	}
+	// The codes get past MFA, so they need the password too.
+	if errMsg := c.checkPassword(r, site, user, r.FormValue("current")); errMsg != "" {
+		return c.show(w, r, map[string]any{"error": errMsg})
+	}
+
+	codes, hashes := totp.GenerateRecoveryCodes()
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		mfa := site.UserMFA(user.Username)
+		mfa.RecoveryCodes = hashes
+		site.UpdateUserMFA(user.Username, &mfa)
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	return c.show(w, r, map[string]any{"codes": codes})
+}
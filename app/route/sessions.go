@@ -0,0 +1,111 @@
+package route
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"go.yhsif.com/pandablog/app/lib/websession"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// Sessions -
+type Sessions struct {
+	*Core
+}
+
+func registerSessions(c *Sessions) {
+	c.Router.Get("/dashboard/sessions", c.index)
+	c.Router.Post("/dashboard/sessions", c.revoke)
+}
+
+// index lists the logged in sessions.
+func (c *Sessions) index(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	user, ok := c.currentUser(r, site)
+	if !ok {
+		return http.StatusForbidden, nil
+	}
+
+	vars := make(map[string]any)
+	vars["title"] = "Sessions"
+	vars["token"] = c.Sess.SetCSRF(r)
+	vars["listable"] = c.Sess.Listable()
+	// Sessions in cookies can only be revoked all together.
+	vars["revokeOthers"] = c.Sess.Listable() || user.IsAdmin()
+	if c.Sess.Listable() {
+		sessions, err := c.sessions(r, user)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		vars["sessions"] = sessions
+	}
+
+	return c.Render.Template(w, r, "dashboard", "sessions", vars)
+}
+
+// revoke logs out one session, or all the other sessions of the user.
+func (c *Sessions) revoke(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	r.ParseForm()
+
+	// CSRF protection.
+	success := c.Sess.CSRF(r)
+	if !success {
+		return http.StatusBadRequest, nil
+	}
+
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	user, ok := c.currentUser(r, site)
+	if !ok {
+		return http.StatusForbidden, nil
+	}
+
+	switch {
+	case r.FormValue("others") != "" && c.Sess.Listable():
+		err = c.Sess.RevokeOthers(r, user.Username)
+	case r.FormValue("others") != "":
+		if !user.IsAdmin() {
+			return http.StatusForbidden, nil
+		}
+		err = c.Sess.RevokeOthers(r, "")
+	default:
+		id := r.FormValue("id")
+		var sessions []websession.Info
+		if sessions, err = c.sessions(r, user); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !slices.ContainsFunc(sessions, func(info websession.Info) bool {
+			return info.ID == id
+		}) {
+			return http.StatusNotFound, nil
+		}
+		err = c.Sess.Revoke(r, id)
+	}
+	switch {
+	case errors.Is(err, websession.ErrNotFound):
+		return http.StatusNotFound, err
+	case err != nil:
+		return http.StatusInternalServerError, err
+	}
+
+	http.Redirect(w, r, "/dashboard/sessions", http.StatusFound)
+	return http.StatusFound, nil
+}
+
+// sessions returns the sessions user can see, all of them for admins and
+// their own ones otherwise.
+func (c *Sessions) sessions(r *http.Request, user model.UserWithName) ([]websession.Info, error) {
+	sessions, err := c.Sess.List(r)
+	if err != nil || user.IsAdmin() {
+		return sessions, err
+	}
+	return slices.DeleteFunc(sessions, func(info websession.Info) bool {
+		return info.User != user.Username
+	}), nil
+}
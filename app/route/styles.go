@@ -2,6 +2,8 @@ package route
 
 import (
 	"net/http"
+
+	"go.yhsif.com/pandablog/app/model"
 )
 
 // Styles -
@@ -23,6 +25,7 @@ func (c *Styles) edit(w http.ResponseWriter, r *http.Request) (status int, err e
 	vars := make(map[string]any)
 	vars["title"] = "Site styles"
 	vars["token"] = c.Sess.SetCSRF(r)
+	vars["updated"] = updatedFormValue(site.Updated)
 	vars["favicon"] = site.Favicon
 	vars["styles"] = site.Styles
 	vars["stylesappend"] = site.StylesAppend
@@ -33,11 +36,6 @@ func (c *Styles) edit(w http.ResponseWriter, r *http.Request) (status int, err e
 }
 
 func (c *Styles) update(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	site, err := c.Storage.Site.Load(r.Context())
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
-
 	r.ParseForm()
 
 	// CSRF protection.
@@ -46,16 +44,22 @@ func (c *Styles) update(w http.ResponseWriter, r *http.Request) (status int, err
 		return http.StatusBadRequest, nil
 	}
 
-	site.Favicon = r.FormValue("favicon")
-	site.Styles = r.FormValue("styles")
-	site.StylesAppend = (r.FormValue("stylesappend") == "on")
-	site.StackEdit = (r.FormValue("stackedit") == "on")
-	site.Prism = (r.FormValue("prism") == "on")
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		if err := checkUnmodified(r, site.Updated); err != nil {
+			return err
+		}
 
-	site.Update()
+		site.Favicon = r.FormValue("favicon")
+		site.Styles = r.FormValue("styles")
+		site.StylesAppend = (r.FormValue("stylesappend") == "on")
+		site.StackEdit = (r.FormValue("stackedit") == "on")
+		site.Prism = (r.FormValue("prism") == "on")
 
-	if err := c.Storage.Save(site); err != nil {
-		return http.StatusInternalServerError, err
+		site.Update()
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
 	}
 
 	http.Redirect(w, r, "/dashboard/styles", http.StatusFound)
@@ -0,0 +1,113 @@
+package route
+
+import (
+	"net/http"
+	"time"
+
+	"go.yhsif.com/pandablog/app/lib/account"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// Tokens -
+type Tokens struct {
+	*Core
+}
+
+func registerTokens(c *Tokens) {
+	c.Router.Get("/dashboard/tokens", c.index)
+	c.Router.Post("/dashboard/tokens", c.update)
+}
+
+func (c *Tokens) index(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	return c.list(w, r, "", "")
+}
+
+// list renders the API tokens of the user, with the new token to show once,
+// or the error message of adding a token if any.
+func (c *Tokens) list(w http.ResponseWriter, r *http.Request, token, errMsg string) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	user, ok := c.currentUser(r, site)
+	if !ok {
+		return http.StatusForbidden, nil
+	}
+
+	scopes := model.Scopes
+	if !user.IsAdmin() {
+		scopes = []model.Scope{model.ScopeRead, model.ScopeWrite}
+	}
+
+	vars := make(map[string]any)
+	vars["title"] = "API Tokens"
+	vars["token"] = c.Sess.SetCSRF(r)
+	vars["tokens"] = site.UserTokens(user.Username)
+	vars["scopes"] = scopes
+	vars["new"] = token
+	vars["error"] = errMsg
+
+	return c.Render.Template(w, r, "dashboard", "tokens", vars)
+}
+
+// update adds a token for the user, or deletes one of theirs.
+func (c *Tokens) update(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	r.ParseForm()
+
+	// CSRF protection.
+	success := c.Sess.CSRF(r)
+	if !success {
+		return http.StatusBadRequest, nil
+	}
+
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	user, ok := c.currentUser(r, site)
+	if !ok {
+		return http.StatusForbidden, nil
+	}
+
+	if id := r.FormValue("delete"); id != "" {
+		err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+			if t, ok := site.TokenByID(id); !ok || t.Username != user.Username {
+				return errNotFound
+			}
+			site.UpdateToken(id, nil)
+			return nil
+		})
+		if err != nil {
+			return updateErrorStatus(err), err
+		}
+		http.Redirect(w, r, "/dashboard/tokens", http.StatusFound)
+		return http.StatusFound, nil
+	}
+
+	name := r.FormValue("name")
+	scope := model.Scope(r.FormValue("scope"))
+	switch {
+	case name == "":
+		return c.list(w, r, "", "the name is required")
+	case !scope.Valid():
+		return http.StatusBadRequest, nil
+	case scope == model.ScopeAdmin && !user.IsAdmin():
+		return c.list(w, r, "", "only admins can add tokens with the admin scope")
+	}
+
+	token, id := account.GenerateToken()
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		site.UpdateToken(id, &model.Token{
+			Username: user.Username,
+			Name:     name,
+			Scope:    scope,
+			Created:  time.Now(),
+		})
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	return c.list(w, r, token, "")
+}
@@ -0,0 +1,198 @@
+package route
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/matryer/way"
+
+	"go.yhsif.com/pandablog/app/lib/account"
+	"go.yhsif.com/pandablog/app/lib/passhash"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// errLastAdmin is returned when the change would leave no admin to manage the
+// site.
+var errLastAdmin = errors.New("cannot remove the last admin")
+
+// Users -
+type Users struct {
+	*Core
+}
+
+func registerUsers(c *Users) {
+	c.Router.Get("/dashboard/users", c.index)
+	c.Router.Post("/dashboard/users", c.store)
+	c.Router.Get("/dashboard/users/:name", c.edit)
+	c.Router.Post("/dashboard/users/:name", c.update)
+}
+
+// currentUser returns the logged in user of the request.
+func (c *Core) currentUser(r *http.Request, site *model.Site) (model.UserWithName, bool) {
+	username, ok := c.Sess.User(r)
+	if !ok {
+		return model.UserWithName{}, false
+	}
+	return account.Lookup(site, username)
+}
+
+func (c *Users) index(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	return c.list(w, r, "")
+}
+
+// list renders the users, with the error message of adding a user if any.
+func (c *Users) list(w http.ResponseWriter, r *http.Request, errMsg string) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	vars := make(map[string]any)
+	vars["title"] = "Users"
+	vars["token"] = c.Sess.SetCSRF(r)
+	vars["users"] = site.UserList()
+	vars["roles"] = model.Roles
+	vars["error"] = errMsg
+	if owner, ok := account.Owner(); ok {
+		vars["owner"] = owner.Username
+	}
+
+	return c.Render.Template(w, r, "dashboard", "users_list", vars)
+}
+
+// store adds a user.
+func (c *Users) store(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	r.ParseForm()
+
+	// CSRF protection.
+	success := c.Sess.CSRF(r)
+	if !success {
+		return http.StatusBadRequest, nil
+	}
+
+	username := r.FormValue("username")
+	role := model.Role(r.FormValue("role"))
+	password := r.FormValue("password")
+	switch {
+	case !model.ValidUsername(username):
+		return c.list(w, r, "usernames can only have letters, digits, \".\", \"-\" and \"_\"")
+	case account.IsOwner(username):
+		return c.list(w, r, "username "+username+" is already used")
+	case !role.Valid():
+		return http.StatusBadRequest, nil
+	case len(password) == 0:
+		return c.list(w, r, "the password is required")
+	}
+	hash, err := passhash.HashString(password)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	var exists bool
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		if _, exists = site.UserByName(username); exists {
+			return nil
+		}
+		site.UpdateUser(username, &model.User{
+			PasswordHash: hash,
+			DisplayName:  r.FormValue("display_name"),
+			Role:         role,
+			Created:      time.Now(),
+		})
+		return nil
+	})
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+	if exists {
+		return c.list(w, r, "username "+username+" is already used")
+	}
+
+	http.Redirect(w, r, "/dashboard/users", http.StatusFound)
+	return http.StatusFound, nil
+}
+
+func (c *Users) edit(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	site, err := c.Storage.Site.Load(r.Context())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	user, ok := site.UserByName(way.Param(r.Context(), "name"))
+	if !ok {
+		return http.StatusNotFound, nil
+	}
+
+	vars := make(map[string]any)
+	vars["title"] = "Edit user"
+	vars["token"] = c.Sess.SetCSRF(r)
+	vars["user"] = user
+	vars["roles"] = model.Roles
+
+	return c.Render.Template(w, r, "dashboard", "user_edit", vars)
+}
+
+// update changes or deletes a user.
+func (c *Users) update(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	r.ParseForm()
+
+	// CSRF protection.
+	success := c.Sess.CSRF(r)
+	if !success {
+		return http.StatusBadRequest, nil
+	}
+
+	username := way.Param(r.Context(), "name")
+	remove := r.FormValue("delete") != ""
+	role := model.Role(r.FormValue("role"))
+	if !remove && !role.Valid() {
+		return http.StatusBadRequest, nil
+	}
+	var hash string
+	if password := r.FormValue("password"); len(password) > 0 && !remove {
+		if hash, err = passhash.HashString(password); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	err = c.Storage.Update(r.Context(), func(site *model.Site) error {
+		user, ok := site.UserByName(username)
+		if !ok {
+			return errNotFound
+		}
+		// Without the owner, there must be an admin left to manage the site.
+		if _, hasOwner := account.Owner(); !hasOwner && user.IsAdmin() &&
+			(remove || role != model.RoleAdmin) && site.AdminCount() <= 1 {
+			return errLastAdmin
+		}
+
+		if remove {
+			site.UpdateUser(username, nil)
+			site.DeleteUserPasskeys(username)
+			site.DeleteUserTokens(username)
+			site.UpdateUserMFA(username, nil)
+			return nil
+		}
+		user.DisplayName = r.FormValue("display_name")
+		user.Role = role
+		if len(hash) > 0 {
+			user.PasswordHash = hash
+		}
+		site.UpdateUser(username, &user.User)
+		return nil
+	})
+	if errors.Is(err, errLastAdmin) {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return updateErrorStatus(err), err
+	}
+
+	if remove {
+		http.Redirect(w, r, "/dashboard/users", http.StatusFound)
+	} else {
+		http.Redirect(w, r, "/dashboard/users/"+username, http.StatusFound)
+	}
+	return http.StatusFound, nil
+}
@@ -183,7 +183,11 @@ func (c *XMLUtil) rss(w http.ResponseWriter, r *http.Request) (status int, err e
 	}
 
 	for _, v := range posts {
-		html := c.Render.RenderMarkdown(v.Post.Content)
+		p, _, err := site.PostByID(r.Context(), v.ID)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		html := c.Render.RenderMarkdown(p.Content)
 		m.Items = append(m.Items, Item{
 			Title:   v.Title,
 			Link:    site.SiteURL(&v.Post),
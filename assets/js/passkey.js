@@ -0,0 +1,89 @@
+// Passkey registration and login with WebAuthn. The responses are filled in
+// the hidden inputs of the form of the button, which is then submitted.
+(function () {
+  const timeout = 5 * 60 * 1000;
+
+  function decode(s) {
+    const b = atob(s.replace(/-/g, '+').replace(/_/g, '/'));
+    return Uint8Array.from(b, (c) => c.charCodeAt(0));
+  }
+
+  function encode(buf) {
+    const b = String.fromCharCode(...new Uint8Array(buf));
+    return btoa(b).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+  }
+
+  function list(s) {
+    return s ? s.split(',') : [];
+  }
+
+  async function register(button) {
+    const form = button.form;
+    if (!form.reportValidity()) {
+      return;
+    }
+    const d = button.dataset;
+    const cred = await navigator.credentials.create({
+      publicKey: {
+        challenge: decode(d.challenge),
+        rp: { id: d.rpId, name: d.rpName || d.rpId },
+        user: {
+          id: decode(d.userId),
+          name: d.userName,
+          displayName: d.userDisplayName,
+        },
+        pubKeyCredParams: list(d.algorithms).map((alg) => ({ type: 'public-key', alg: Number(alg) })),
+        excludeCredentials: list(d.exclude).map((id) => ({ type: 'public-key', id: decode(id) })),
+        authenticatorSelection: {
+          residentKey: 'required',
+          requireResidentKey: true,
+          userVerification: 'required',
+        },
+        attestation: 'none',
+        timeout: timeout,
+      },
+    });
+    form.elements.client_data.value = encode(cred.response.clientDataJSON);
+    form.elements.attestation_object.value = encode(cred.response.attestationObject);
+    form.submit();
+  }
+
+  async function login(button) {
+    const form = button.form;
+    const d = button.dataset;
+    const cred = await navigator.credentials.get({
+      publicKey: {
+        challenge: decode(d.challenge),
+        rpId: d.rpId,
+        userVerification: 'required',
+        timeout: timeout,
+      },
+    });
+    form.elements.credential.value = cred.id;
+    form.elements.client_data.value = encode(cred.response.clientDataJSON);
+    form.elements.authenticator_data.value = encode(cred.response.authenticatorData);
+    form.elements.signature.value = encode(cred.response.signature);
+    // Skip the validation of the password inputs.
+    form.submit();
+  }
+
+  function bind(selector, ceremony) {
+    document.querySelectorAll(selector).forEach((button) => {
+      if (!window.PublicKeyCredential) {
+        button.disabled = true;
+        button.title = 'Passkeys are not supported by this browser';
+        return;
+      }
+      button.addEventListener('click', () => {
+        ceremony(button).catch((err) => {
+          if (err.name !== 'NotAllowedError') {
+            alert('Passkey failed: ' + err.message);
+          }
+        });
+      });
+    });
+  }
+
+  bind('[data-passkey-register]', register);
+  bind('[data-passkey-login]', login);
+})();
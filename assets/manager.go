@@ -2,5 +2,5 @@ package assets
 
 import "embed"
 
-//go:embed css/* cactus/* webmention.js/*
+//go:embed css/* cactus/* js/* webmention.js/*
 var Assets embed.FS
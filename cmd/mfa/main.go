@@ -5,6 +5,7 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/mdp/qrterminal/v3"
 
@@ -50,4 +51,14 @@ func main() {
 		QuietZone: 1,
 	}
 	qrterminal.GenerateWithConfig(URI, config)
+
+	// Generate the recovery codes, only their hashes are stored.
+	codes, hashes := totp.GenerateRecoveryCodes()
+	fmt.Println("")
+	fmt.Println("Keep these recovery codes somewhere safe. Each of them can be used once instead of the MFA token:")
+	for _, code := range codes {
+		fmt.Println(code)
+	}
+	fmt.Println("")
+	fmt.Printf("PBB_MFA_RECOVERY_CODES=%v\n", strings.Join(hashes, ","))
 }
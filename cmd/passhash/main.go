@@ -2,9 +2,11 @@ package main
 
 import (
 	"encoding/base64"
+	"flag"
 	"fmt"
 	"log"
 	"log/slog"
+	"math"
 	"os"
 	"syscall"
 
@@ -22,9 +24,25 @@ func init() {
 }
 
 func main() {
+	params := passhash.DefaultParams
+	flag.StringVar(&params.Algorithm, "algorithm", params.Algorithm, "algorithm to hash with, argon2id or bcrypt")
+	flag.IntVar(&params.Cost, "cost", params.Cost, "bcrypt cost")
+	time := flag.Uint("time", uint(params.Time), "argon2id time cost, the number of passes")
+	memory := flag.Uint("memory", uint(params.Memory), "argon2id memory cost in KiB")
+	threads := flag.Uint("threads", uint(params.Threads), "argon2id parallelism, up to 255")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [password]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *time > math.MaxUint32 || *memory > math.MaxUint32 || *threads > math.MaxUint8 {
+		log.Fatalln("The argon2id costs are out of range.")
+	}
+	params.Time, params.Memory, params.Threads = uint32(*time), uint32(*memory), uint8(*threads)
+
 	var pass string
-	if len(os.Args) >= 2 {
-		pass = os.Args[1]
+	if flag.NArg() >= 1 {
+		pass = flag.Arg(0)
 	} else {
 		fmt.Print("Please input your desired password: ")
 		p, err := term.ReadPassword(syscall.Stdin)
@@ -35,8 +53,8 @@ func main() {
 		pass = string(p)
 	}
 
-	// Generate a new private key.
-	s, err := passhash.HashString(pass)
+	// Generate a new password hash.
+	s, err := params.HashString(pass)
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.yhsif.com/pandablog/app"
+	"go.yhsif.com/pandablog/app/lib/export"
+)
+
+// runExport implements the export subcommand, which writes the whole site as a
+// zip archive of Markdown files.
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String(
+		"o",
+		fmt.Sprintf("pandablog-%s.zip", time.Now().Format("20060102")),
+		`output file, "-" for stdout`,
+	)
+	fs.Parse(args)
+
+	storage, err := app.NewStorage(ctx)
+	if err != nil {
+		return err
+	}
+	site, err := storage.Site.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := export.Zip(ctx, w, site); err != nil {
+		return err
+	}
+	if f, ok := w.(*os.File); ok && f != os.Stdout {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	slog.InfoContext(ctx, "Exported site", "output", *output)
+	return nil
+}
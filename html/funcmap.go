@@ -3,11 +3,12 @@ package html
 import (
 	"html/template"
 	"net/http"
-	"os"
 	"time"
 
+	"go.yhsif.com/pandablog/app/lib/account"
 	"go.yhsif.com/pandablog/app/lib/datastorage"
 	"go.yhsif.com/pandablog/app/lib/envdetect"
+	"go.yhsif.com/pandablog/app/lib/indieauth"
 	"go.yhsif.com/pandablog/app/lib/websession"
 	"go.yhsif.com/pandablog/app/model"
 )
@@ -27,6 +28,9 @@ func FuncMap(
 	fm["Stamp"] = func(t time.Time) string {
 		return t.Format("2006-01-02")
 	}
+	fm["StampTime"] = func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05")
+	}
 	fm["StampHuman"] = func(t time.Time) string {
 		if site.ISODate {
 			return t.Format("2006-01-02")
@@ -68,6 +72,14 @@ func FuncMap(
 		_, loggedIn := sess.User(r)
 		return loggedIn
 	}
+	fm["IsAdmin"] = func() bool {
+		username, ok := sess.User(r)
+		if !ok {
+			return false
+		}
+		user, ok := account.Lookup(site, username)
+		return ok && user.IsAdmin()
+	}
 	fm["GoogleAnalyticsID"] = func() string {
 		if envdetect.RunningLocalDev() {
 			return ""
@@ -95,8 +107,14 @@ func FuncMap(
 	fm["IndieLoginURI"] = func() string {
 		return site.IndieLoginURI
 	}
+	fm["IndieAuthAuthorizationEndpoint"] = func() string {
+		return indieauth.AuthorizationEndpoint()
+	}
+	fm["IndieAuthTokenEndpoint"] = func() string {
+		return indieauth.TokenEndpoint()
+	}
 	fm["MFAEnabled"] = func() bool {
-		return len(os.Getenv("PBB_MFA_KEY")) > 0
+		return account.HasMFA(site)
 	}
 	fm["AssetStamp"] = func(f string) string {
 		return assetTimePath(f)
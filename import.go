@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"go.yhsif.com/pandablog/app"
+	"go.yhsif.com/pandablog/app/lib/importer"
+	"go.yhsif.com/pandablog/app/model"
+)
+
+// runImport implements the import subcommand, which imports posts from a
+// directory or an archive of Markdown files with front matter, or a WordPress
+// eXtended RSS (WXR) export.
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only report what would be imported")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s import [-dry-run] <directory, archive or WordPress export>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	src := fs.Arg(0)
+
+	now := time.Now()
+	var posts []importer.Post
+	if info, err := os.Stat(src); err != nil {
+		return err
+	} else if info.IsDir() {
+		posts, err = importer.ReadFS(os.DirFS(src), now)
+		if err != nil {
+			return err
+		}
+	} else {
+		b, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		posts, err = importer.Read(b, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	storage, err := app.NewStorage(ctx)
+	if err != nil {
+		return err
+	}
+
+	var report importer.Report
+	if *dryRun {
+		site, err := storage.Site.Load(ctx)
+		if err != nil {
+			return err
+		}
+		report = importer.Import(site, posts, true)
+	} else {
+		if err := storage.Update(ctx, func(site *model.Site) error {
+			report = importer.Import(site, posts, false)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	printReport(os.Stdout, report)
+	return nil
+}
+
+func printReport(w io.Writer, report importer.Report) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, r := range report.Results {
+		if r.Err != nil {
+			fmt.Fprintf(tw, "skipped\t%s\t%v\n", r.Source, r.Err)
+		} else {
+			fmt.Fprintf(tw, "imported\t%s\t/%s\n", r.Source, r.Slug)
+		}
+	}
+	tw.Flush()
+
+	verb := "Imported"
+	if report.DryRun {
+		verb = "Would import"
+	}
+	fmt.Fprintf(w, "%s %d posts, skipped %d.\n", verb, report.Imported(), report.Skipped())
+}
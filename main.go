@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime/debug"
+	"syscall"
+	"time"
 
 	"go.yhsif.com/pandablog/app"
 	"go.yhsif.com/pandablog/app/lib/envdetect"
@@ -40,7 +44,36 @@ func main() {
 		slog.Warn("Unable to read build info")
 	}
 
-	handler, err := app.Boot(context.Background())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+		// Run the web server.
+	case "export":
+		if err := runExport(ctx, flag.Args()[1:]); err != nil {
+			slog.Error("Failed to export", "err", err)
+			os.Exit(1)
+		}
+		return
+	case "import":
+		if err := runImport(ctx, flag.Args()[1:]); err != nil {
+			slog.Error("Failed to import", "err", err)
+			os.Exit(1)
+		}
+		return
+	case "rotate-key":
+		if err := app.RotateSessionKey(ctx); err != nil {
+			slog.Error("Failed to rotate session key", "err", err)
+			os.Exit(1)
+		}
+		slog.Info("Re-encrypted sessions with the new key")
+		return
+	default:
+		slog.Error("Unknown subcommand", "subcommand", cmd)
+		os.Exit(2)
+	}
+
+	handler, shutdown, err := app.Boot(ctx)
 	if err != nil {
 		slog.Error("Failed to boot", "err", err)
 		os.Exit(1)
@@ -51,7 +84,33 @@ func main() {
 	if port == "" {
 		port = "8080"
 	}
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: handler,
+	}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		// Cloud Run gives 10 seconds after SIGTERM.
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Error("Failed to shut down web server", "err", err)
+		}
+	}()
 
 	slog.Info("Web server running", "port", port)
-	slog.Info("Web server exited", "err", http.ListenAndServe(":"+port, handler))
+	if err := server.ListenAndServe(); errors.Is(err, http.ErrServerClosed) {
+		<-drained
+	} else {
+		slog.Error("Web server exited", "err", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		slog.Error("Failed to shut down", "err", err)
+	}
+	slog.Info("Web server exited")
 }